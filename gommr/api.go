@@ -0,0 +1,175 @@
+package gommr
+
+import "sync"
+
+// MMR is a merkle mountain range backed by a Store. It is safe for
+// concurrent use.
+type MMR struct {
+	lock sync.RWMutex
+	m    *mmr
+}
+
+// NewMMR opens an mmr on store, continuing at the size of the store.
+func NewMMR(store Store, opts ...Option) (*MMR, error) {
+	if size := store.Size(); size != 0 && !ValidSize(size) {
+		return nil, ErrBadSize
+	}
+	c, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	m := new_mmr_with_store(store)
+	m.merger, m.scheme, m.history, m.now = c.merger, c.scheme, c.history, c.now
+	if m.history != nil {
+		if err := m.replay_history(); err != nil {
+			return nil, err
+		}
+	}
+	return &MMR{m: m}, nil
+}
+
+// Push appends a leaf and returns its position.
+func (m *MMR) Push(leaf Hash) (uint64, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	n, err := m.m.push(&Node{value: leaf})
+	if err != nil {
+		return 0, err
+	}
+	return n.index, nil
+}
+
+// Size returns the number of nodes.
+func (m *MMR) Size() uint64 {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.m.cur_size
+}
+
+// LeafCount returns the number of leaves.
+func (m *MMR) LeafCount() uint64 {
+	return SizeToLeafCount(m.Size())
+}
+
+// Get returns the node hash at pos.
+func (m *MMR) Get(pos uint64) (Hash, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.m.get(pos)
+}
+
+// Root returns the root, peaks are bagged from right to left.
+func (m *MMR) Root() (Hash, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.m.getRoot()
+}
+
+// RootAt returns the root of the earlier mmr of size nodes.
+func (m *MMR) RootAt(size uint64) (Hash, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	if size > m.m.cur_size || size != 0 && !ValidSize(size) {
+		return Hash{}, ErrBadSize
+	}
+	view := *m.m
+	view.cur_size = size
+	return view.getRoot()
+}
+
+// GenProof returns an inclusion proof for the node at pos.
+func (m *MMR) GenProof(pos uint64) (*MerkleProof, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.m.gen_proof(pos)
+}
+
+// Rewind drops all nodes from size on.
+func (m *MMR) Rewind(size uint64) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.m.rewind(size)
+}
+
+// Merger returns the merger the mmr was built with.
+func (m *MMR) Merger() Merger {
+	return m.m.merger
+}
+
+// Store returns the backing store.
+func (m *MMR) Store() Store {
+	return m.m.store
+}
+
+// Append is Push for the Accumulator interface, it returns the leaf index.
+func (m *MMR) Append(leaf Hash) (uint64, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	index := SizeToLeafCount(m.m.cur_size)
+	if _, err := m.m.push(&Node{value: leaf}); err != nil {
+		return 0, err
+	}
+	return index, nil
+}
+
+// LeafProof returns an inclusion proof for the leaf at index.
+func (m *MMR) LeafProof(index uint64) (LeafProof, error) {
+	p, err := m.GenProof(LeafIndexToPos(index))
+	if err != nil {
+		return nil, err
+	}
+	return mmrLeafProof{p, m.m.merger}, nil
+}
+
+type mmrLeafProof struct {
+	proof  *MerkleProof
+	merger Merger
+}
+
+func (p mmrLeafProof) Verify(root Hash, index uint64, leaf Hash) bool {
+	return p.proof.VerifyWith(p.merger, root, LeafIndexToPos(index), leaf)
+}
+
+// LeafProof returns an inclusion proof for the leaf at index.
+func (b *Belt) LeafProof(index uint64) (LeafProof, error) {
+	p, err := b.GenProof(index)
+	if err != nil {
+		return nil, err
+	}
+	return beltLeafProof{p, b.merger}, nil
+}
+
+type beltLeafProof struct {
+	proof  *BeltProof
+	merger Merger
+}
+
+func (p beltLeafProof) Verify(root Hash, index uint64, leaf Hash) bool {
+	return p.proof.VerifyWith(p.merger, root, index, leaf)
+}
+
+// LeafProof proves a leaf by its index, with the merger it was built with.
+type LeafProof interface {
+	Verify(root Hash, index uint64, leaf Hash) bool
+}
+
+// Accumulator is the surface MMR and Belt share, with leaves addressed by
+// their index.
+type Accumulator interface {
+	Append(leaf Hash) (uint64, error)
+	LeafCount() uint64
+	Root() (Hash, error)
+	LeafProof(index uint64) (LeafProof, error)
+}
+
+// New opens an mmr on store, or a belt if WithBelt is given.
+func New(store Store, opts ...Option) (Accumulator, error) {
+	c, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	if c.belt {
+		return NewBelt(store, opts...)
+	}
+	return NewMMR(store, opts...)
+}
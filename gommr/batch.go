@@ -0,0 +1,336 @@
+package gommr
+
+import (
+	"errors"
+	"sort"
+)
+
+var (
+	ErrCorruptedProof = errors.New("gommr: corrupted proof")
+	ErrNodeProof      = errors.New("gommr: proofs for inner nodes are not supported")
+	ErrNoLeaves       = errors.New("gommr: no leaves to prove")
+)
+
+// Leaf is a leaf hash with its position.
+type Leaf struct {
+	Pos  uint64
+	Hash Hash
+}
+
+// BatchProof proves several leaves at once. Items follows the layout of
+// the nervos crate: for every peak from left to right the siblings needed
+// by the proven leaves below it, or the peak itself if none is proven,
+// with the peaks right of the last proven one bagged into a single item.
+type BatchProof struct {
+	MmrSize uint64
+	Items   []Hash
+}
+
+func sortedPositions(positions []uint64) []uint64 {
+	res := append([]uint64{}, positions...)
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	n := 0
+	for i, p := range res {
+		if i == 0 || p != res[n-1] {
+			res[n] = p
+			n++
+		}
+	}
+	return res[:n]
+}
+
+func (m *mmr) gen_batch_proof(positions []uint64) (*BatchProof, error) {
+	if len(positions) == 0 {
+		return nil, ErrNoLeaves
+	}
+	positions = sortedPositions(positions)
+	for _, pos := range positions {
+		if pos >= m.cur_size {
+			return nil, ErrOutOfRange
+		}
+		if pos_height_in_tree(pos) > 0 {
+			return nil, ErrNodeProof
+		}
+	}
+	if m.cur_size == 1 {
+		return &BatchProof{MmrSize: 1}, nil
+	}
+	items := make([]Hash, 0)
+	bagging_track := 0
+	for _, peak := range get_peaks(m.cur_size) {
+		n := 0
+		for n < len(positions) && positions[n] <= peak {
+			n++
+		}
+		below := positions[:n]
+		positions = positions[n:]
+		if len(below) == 0 {
+			bagging_track++
+		} else {
+			bagging_track = 0
+		}
+		var err error
+		if items, err = m.gen_proof_for_peak(items, below, peak); err != nil {
+			return nil, err
+		}
+	}
+	if bagging_track > 1 {
+		rhs := items[len(items)-bagging_track:]
+		items = append(items[:len(items)-bagging_track], m.bag_peak_hashes(rhs))
+	}
+	return &BatchProof{MmrSize: m.cur_size, Items: items}, nil
+}
+
+type queued struct {
+	pos    uint64
+	hash   Hash
+	height int
+}
+
+func (m *mmr) gen_proof_for_peak(items []Hash, positions []uint64, peak uint64) ([]Hash, error) {
+	if len(positions) == 1 && positions[0] == peak {
+		return items, nil
+	}
+	if len(positions) == 0 {
+		h, err := m.get(peak)
+		if err != nil {
+			return nil, err
+		}
+		return append(items, h), nil
+	}
+	queue := make([]queued, 0, len(positions))
+	for _, pos := range positions {
+		queue = append(queue, queued{pos: pos})
+	}
+	for len(queue) > 0 {
+		q := queue[0]
+		queue = queue[1:]
+		if q.pos == peak {
+			if len(queue) == 0 {
+				break
+			}
+			return nil, ErrNodeProof
+		}
+		sib_pos, parent_pos := sibling_and_parent(q.pos, q.height)
+		if len(queue) > 0 && queue[0].pos == sib_pos {
+			queue = queue[1:]
+		} else {
+			h, err := m.get(sib_pos)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, h)
+		}
+		if parent_pos < peak {
+			queue = append(queue, queued{pos: parent_pos, height: q.height + 1})
+		}
+	}
+	return items, nil
+}
+
+func sibling_and_parent(pos uint64, height int) (uint64, uint64) {
+	if pos_height_in_tree(pos+1) > height {
+		// pos is a right child
+		return pos - sibling_offset(height), pos + 1
+	}
+	return pos + sibling_offset(height), pos + parent_offset(height)
+}
+
+// bag_peak_hashes bags hashes of consecutive peaks from right to left.
+func (m *mmr) bag_peak_hashes(hashes []Hash) Hash {
+	return bag_hashes(m.merger, m.cur_size, hashes)
+}
+
+func bag_hashes(merger Merger, mmrSize uint64, hashes []Hash) Hash {
+	acc := hashes[len(hashes)-1]
+	for i := len(hashes) - 2; i >= 0; i-- {
+		acc = merger.BagPeaks(mmrSize, hashes[i], acc)
+	}
+	return acc
+}
+
+// CalculateRoot recomputes the root from the proven leaves.
+func (p *BatchProof) CalculateRoot(merger Merger, leaves []Leaf) (Hash, error) {
+	items := p.Items
+	peak_hashes, err := calculate_peaks_hashes(merger, leaves, p.MmrSize, &items)
+	if err != nil {
+		return Hash{}, err
+	}
+	if len(items) != 0 {
+		return Hash{}, ErrCorruptedProof
+	}
+	return bag_hashes(merger, p.MmrSize, peak_hashes), nil
+}
+
+// CalculateRootWithNewLeaf returns the root after new_leaf was pushed at
+// new_pos, growing the mmr to new_size. This is
+// calculate_root_with_new_leaf of the nervos crate.
+func (p *BatchProof) CalculateRootWithNewLeaf(merger Merger, leaves []Leaf, new_pos uint64, new_leaf Hash, new_size uint64) (Hash, error) {
+	if new_pos != p.MmrSize || new_size <= new_pos || !ValidSize(new_size) {
+		return Hash{}, ErrCorruptedProof
+	}
+	if pos_height_in_tree(new_pos+1) <= pos_height_in_tree(new_pos) {
+		// the new leaf becomes a peak on its own
+		leaves = append(append([]Leaf{}, leaves...), Leaf{new_pos, new_leaf})
+		return (&BatchProof{MmrSize: new_size, Items: p.Items}).CalculateRoot(merger, leaves)
+	}
+	items := p.Items
+	peak_hashes, err := calculate_peaks_hashes(merger, leaves, p.MmrSize, &items)
+	if err != nil {
+		return Hash{}, err
+	}
+	if len(items) != 0 {
+		return Hash{}, ErrCorruptedProof
+	}
+	// the peaks merged by the new leaf are its path, lowest first
+	i := 0
+	for _, peak := range get_peaks(new_size) {
+		if peak >= new_pos {
+			break
+		}
+		i++
+	}
+	if i > len(peak_hashes) {
+		return Hash{}, ErrCorruptedProof
+	}
+	for l, r := i, len(peak_hashes)-1; l < r; l, r = l+1, r-1 {
+		peak_hashes[l], peak_hashes[r] = peak_hashes[r], peak_hashes[l]
+	}
+	return (&BatchProof{MmrSize: new_size, Items: peak_hashes}).CalculateRoot(merger, []Leaf{{new_pos, new_leaf}})
+}
+
+// calculate_peaks_hashes recomputes the peak hashes from the proven leaves,
+// consuming the used proof items. The last hash may be the bag of all
+// peaks right of the last proven one.
+func calculate_peaks_hashes(merger Merger, leaves []Leaf, mmrSize uint64, items *[]Hash) ([]Hash, error) {
+	if len(leaves) == 0 {
+		return nil, ErrNoLeaves
+	}
+	if mmrSize == 0 {
+		return nil, ErrCorruptedProof
+	}
+	leaves = append([]Leaf{}, leaves...)
+	sort.Slice(leaves, func(i, j int) bool { return leaves[i].Pos < leaves[j].Pos })
+	for i := 1; i < len(leaves); i++ {
+		if leaves[i].Pos == leaves[i-1].Pos {
+			if leaves[i].Hash != leaves[i-1].Hash {
+				return nil, ErrCorruptedProof
+			}
+			leaves = append(leaves[:i], leaves[i+1:]...)
+			i--
+		}
+	}
+	next := func() (Hash, bool) {
+		if len(*items) == 0 {
+			return Hash{}, false
+		}
+		h := (*items)[0]
+		*items = (*items)[1:]
+		return h, true
+	}
+	peak_hashes := make([]Hash, 0)
+peaks:
+	for _, peak := range get_peaks(mmrSize) {
+		n := 0
+		for n < len(leaves) && leaves[n].Pos <= peak {
+			n++
+		}
+		below := leaves[:n]
+		leaves = leaves[n:]
+		switch {
+		case len(below) == 1 && below[0].Pos == peak:
+			peak_hashes = append(peak_hashes, below[0].Hash)
+		case len(below) == 0:
+			h, ok := next()
+			if !ok {
+				// the remaining peaks were bagged
+				break peaks
+			}
+			peak_hashes = append(peak_hashes, h)
+		default:
+			h, err := calculate_peak_root(merger, below, peak, next)
+			if err != nil {
+				return nil, err
+			}
+			peak_hashes = append(peak_hashes, h)
+		}
+	}
+	if len(leaves) != 0 {
+		return nil, ErrCorruptedProof
+	}
+	if h, ok := next(); ok {
+		peak_hashes = append(peak_hashes, h)
+	}
+	if len(peak_hashes) == 0 {
+		return nil, ErrCorruptedProof
+	}
+	return peak_hashes, nil
+}
+
+func calculate_peak_root(merger Merger, leaves []Leaf, peak uint64, next func() (Hash, bool)) (Hash, error) {
+	queue := make([]queued, 0, len(leaves))
+	for _, l := range leaves {
+		if pos_height_in_tree(l.Pos) > 0 {
+			return Hash{}, ErrNodeProof
+		}
+		queue = append(queue, queued{pos: l.Pos, hash: l.Hash})
+	}
+	for len(queue) > 0 {
+		q := queue[0]
+		queue = queue[1:]
+		if q.pos == peak {
+			if len(queue) == 0 {
+				return q.hash, nil
+			}
+			return Hash{}, ErrCorruptedProof
+		}
+		sib_pos, parent_pos := sibling_and_parent(q.pos, q.height)
+		var sib Hash
+		if len(queue) > 0 && queue[0].pos == sib_pos {
+			sib = queue[0].hash
+			queue = queue[1:]
+		} else {
+			h, ok := next()
+			if !ok {
+				return Hash{}, ErrCorruptedProof
+			}
+			sib = h
+		}
+		var parent Hash
+		if sib_pos < q.pos {
+			parent = merger.Merge(parent_pos, sib, q.hash)
+		} else {
+			parent = merger.Merge(parent_pos, q.hash, sib)
+		}
+		if parent_pos > peak {
+			return Hash{}, ErrCorruptedProof
+		}
+		queue = append(queue, queued{pos: parent_pos, hash: parent, height: q.height + 1})
+	}
+	return Hash{}, ErrCorruptedProof
+}
+
+// Verify reports whether the leaves lead to root.
+func (p *BatchProof) Verify(merger Merger, root Hash, leaves []Leaf) bool {
+	h, err := p.CalculateRoot(merger, leaves)
+	return err == nil && h == root
+}
+
+// GenBatchProof returns a proof for the leaves at positions.
+func (m *MMR) GenBatchProof(positions []uint64) (*BatchProof, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.m.gen_batch_proof(positions)
+}
+
+// GenBatchProofAt returns a proof against the earlier mmr of mmrSize nodes.
+func (m *MMR) GenBatchProofAt(positions []uint64, mmrSize uint64) (*BatchProof, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	if mmrSize > m.m.cur_size || !ValidSize(mmrSize) {
+		return nil, ErrBadSize
+	}
+	view := *m.m
+	view.cur_size = mmrSize
+	return view.gen_batch_proof(positions)
+}
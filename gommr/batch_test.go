@@ -0,0 +1,72 @@
+package gommr
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestBatchProof(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, count := range []int{1, 2, 3, 7, 8, 11, 33, 100} {
+		m := buildMMR(t, NewMemStore(), count)
+		root, _ := m.Root()
+		for round := 0; round < 30; round++ {
+			n := 1 + rnd.Intn(count)
+			if n > 5 {
+				n = 5
+			}
+			var (
+				positions []uint64
+				leaves    []Leaf
+			)
+			for i := 0; i < n; i++ {
+				index := rnd.Intn(count)
+				pos := LeafIndexToPos(uint64(index))
+				positions = append(positions, pos)
+				leaves = append(leaves, Leaf{pos, leafHash(index)})
+			}
+			proof, err := m.GenBatchProof(positions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !proof.Verify(DefaultMerger, root, leaves) {
+				t.Fatalf("%d leaves: batch proof for %v failed", count, positions)
+			}
+			leaves[0].Hash[0] ^= 1
+			if proof.Verify(DefaultMerger, root, leaves) {
+				t.Fatalf("%d leaves: batch proof accepted wrong leaf", count)
+			}
+		}
+	}
+}
+
+func TestBatchProofAllLeaves(t *testing.T) {
+	m := buildMMR(t, NewMemStore(), 19)
+	root, _ := m.Root()
+	var (
+		positions []uint64
+		leaves    []Leaf
+	)
+	for i := 0; i < 19; i++ {
+		pos := LeafIndexToPos(uint64(i))
+		positions = append(positions, pos)
+		leaves = append(leaves, Leaf{pos, leafHash(i)})
+	}
+	proof, err := m.GenBatchProof(positions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proof.Items) != 0 {
+		t.Fatalf("proof for all leaves has %d items", len(proof.Items))
+	}
+	if !proof.Verify(DefaultMerger, root, leaves) {
+		t.Fatal("proof for all leaves failed")
+	}
+	if _, err := m.GenBatchProof([]uint64{2}); err != ErrNodeProof {
+		t.Fatalf("proof for inner node: %v", err)
+	}
+	proof.Items = append(proof.Items, Hash{})
+	if proof.Verify(DefaultMerger, root, leaves) {
+		t.Fatal("proof with extra item accepted")
+	}
+}
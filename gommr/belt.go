@@ -0,0 +1,377 @@
+package gommr
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrBeltHistory = errors.New("gommr: a belt keeps no root history")
+
+// A merkle mountain belt defers the merges of an mmr: the node of height g
+// over the aligned leaves from start only exists once the newest of them
+// is 2^(g-1)-1 leaves old. Recent leaves therefore stay in low mountains.
+// Peaks of equal height form a range, the peaks of a range and then the
+// ranges are bagged from left to right, so the newest peaks and ranges sit
+// right below the root. A leaf d leaves from the end has a proof of about
+// 2*log2(d+1)+3 hashes, however large the belt.
+//
+// Nodes are stored in the order they are created, the leaf first.
+
+//          7
+//        /   \
+//       2     5     9
+//      / \   / \   / \
+//     0   1 3   4 6   8  10
+//
+// 7 is created along with the fifth leaf at 6, one append after the mmr
+// would have created it.
+
+// beltCreated returns the leaf count at which the node of height over the
+// aligned leaves from start is created.
+func beltCreated(start uint64, height int) uint64 {
+	if height == 0 {
+		return start + 1
+	}
+	return start + (uint64(1) << uint64(height)) + (uint64(1) << uint64(height-1)) - 1
+}
+
+// beltMerges returns the heights of the inner nodes created by appending
+// leaf number leaves, lowest first.
+func beltMerges(leaves uint64) []int {
+	heights := make([]int, 0, 0)
+	for g := 1; g < 64; g++ {
+		first := beltCreated(0, g)
+		if first > leaves {
+			break
+		}
+		if (leaves-first)&((uint64(1)<<uint64(g))-1) == 0 {
+			heights = append(heights, g)
+		}
+	}
+	return heights
+}
+
+// BeltSize returns the number of nodes of a belt with leaves leaves.
+func BeltSize(leaves uint64) uint64 {
+	size := leaves
+	for g := 1; g < 64; g++ {
+		first := beltCreated(0, g)
+		if first > leaves {
+			break
+		}
+		size += (leaves-first)>>uint64(g) + 1
+	}
+	return size
+}
+
+// beltPos returns the position of the node of height over the leaves from
+// start.
+func beltPos(start uint64, height int) uint64 {
+	created := beltCreated(start, height)
+	pos := BeltSize(created - 1)
+	if height == 0 {
+		return pos
+	}
+	pos++
+	for _, g := range beltMerges(created) {
+		if g == height {
+			break
+		}
+		pos++
+	}
+	return pos
+}
+
+type beltPeak struct {
+	start  uint64
+	height int
+}
+
+// beltRanges returns the peaks of a belt with leaves leaves, grouped in
+// ranges of equal height, from left to right.
+func beltRanges(leaves uint64) [][]beltPeak {
+	ranges := make([][]beltPeak, 0, 0)
+	for start := uint64(0); start < leaves; {
+		height := 0
+		for start&((uint64(2)<<uint64(height))-1) == 0 && beltCreated(start, height+1) <= leaves {
+			height++
+		}
+		peak := beltPeak{start, height}
+		if last := len(ranges) - 1; last >= 0 && ranges[last][0].height == height {
+			ranges[last] = append(ranges[last], peak)
+		} else {
+			ranges = append(ranges, []beltPeak{peak})
+		}
+		start += uint64(1) << uint64(height)
+	}
+	return ranges
+}
+
+// beltLeafCount returns the number of leaves of a belt of size nodes.
+func beltLeafCount(size uint64) (uint64, bool) {
+	lo, hi := uint64(0), size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		if BeltSize(mid) < size {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, BeltSize(lo) == size
+}
+
+// bagBelt folds hashes from left to right in a belt of size nodes.
+func bagBelt(merger Merger, size uint64, hashes []Hash) Hash {
+	acc := hashes[0]
+	for _, h := range hashes[1:] {
+		acc = merger.BagPeaks(size, acc, h)
+	}
+	return acc
+}
+
+// Belt is a merkle mountain belt backed by a Store. It is safe for
+// concurrent use.
+type Belt struct {
+	lock   sync.RWMutex
+	store  Store
+	merger Merger
+	leaves uint64
+}
+
+// NewBelt opens a belt on store, continuing at the size of the store. A
+// belt only takes its merger from opts, WithHistory is refused.
+func NewBelt(store Store, opts ...Option) (*Belt, error) {
+	leaves, ok := beltLeafCount(store.Size())
+	if !ok {
+		return nil, ErrBadSize
+	}
+	c, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	if c.history != nil {
+		return nil, ErrBeltHistory
+	}
+	return &Belt{store: store, merger: c.merger, leaves: leaves}, nil
+}
+
+// node returns the node of height over the leaves from start, looking in
+// batch for nodes from size on.
+func (b *Belt) node(start uint64, height int, size uint64, batch []Hash) (Hash, error) {
+	pos := beltPos(start, height)
+	if pos >= size {
+		return batch[pos-size], nil
+	}
+	return b.store.Get(pos)
+}
+
+// Append adds a leaf and returns its index.
+func (b *Belt) Append(leaf Hash) (uint64, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	index, size := b.leaves, b.store.Size()
+	batch := []Hash{leaf}
+	for _, g := range beltMerges(index + 1) {
+		start := index + 1 - beltCreated(0, g)
+		left, err := b.node(start, g-1, size, batch)
+		if err != nil {
+			return 0, err
+		}
+		right, err := b.node(start+(uint64(1)<<uint64(g-1)), g-1, size, batch)
+		if err != nil {
+			return 0, err
+		}
+		batch = append(batch, b.merger.Merge(size+uint64(len(batch)), left, right))
+	}
+	if err := b.store.Append(size, batch); err != nil {
+		return 0, err
+	}
+	b.leaves++
+	return index, nil
+}
+
+// LeafCount returns the number of leaves.
+func (b *Belt) LeafCount() uint64 {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.leaves
+}
+
+// Size returns the number of nodes.
+func (b *Belt) Size() uint64 {
+	return BeltSize(b.LeafCount())
+}
+
+// Get returns the node hash at pos.
+func (b *Belt) Get(pos uint64) (Hash, error) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if pos >= BeltSize(b.leaves) {
+		return Hash{}, ErrOutOfRange
+	}
+	return b.store.Get(pos)
+}
+
+// rangeHashes returns the hashes of the peaks of each range.
+func (b *Belt) rangeHashes(ranges [][]beltPeak) ([][]Hash, error) {
+	hashes := make([][]Hash, len(ranges))
+	for i, r := range ranges {
+		for _, peak := range r {
+			h, err := b.store.Get(beltPos(peak.start, peak.height))
+			if err != nil {
+				return nil, err
+			}
+			hashes[i] = append(hashes[i], h)
+		}
+	}
+	return hashes, nil
+}
+
+// Root returns the root, zero for an empty belt.
+func (b *Belt) Root() (Hash, error) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if b.leaves == 0 {
+		return Hash{0}, nil
+	}
+	hashes, err := b.rangeHashes(beltRanges(b.leaves))
+	if err != nil {
+		return Hash{}, err
+	}
+	size := BeltSize(b.leaves)
+	roots := make([]Hash, len(hashes))
+	for i, h := range hashes {
+		roots[i] = bagBelt(b.merger, size, h)
+	}
+	return bagBelt(b.merger, size, roots), nil
+}
+
+// BeltProof proves a leaf of a belt with LeafCount leaves. Items are the
+// siblings up to the peak, then the bags of the peaks and ranges on the
+// left, if any, followed by each one on the right.
+type BeltProof struct {
+	LeafCount uint64
+	Items     []Hash
+}
+
+// foldProof appends the proof of hashes[i] in bagBelt(hashes).
+func foldProof(merger Merger, size uint64, hashes []Hash, i int, items []Hash) []Hash {
+	if i > 0 {
+		items = append(items, bagBelt(merger, size, hashes[:i]))
+	}
+	return append(items, hashes[i+1:]...)
+}
+
+// locate returns the range and the peak within it holding leaf index.
+func locate(ranges [][]beltPeak, index uint64) (int, int) {
+	for i, r := range ranges {
+		for j, peak := range r {
+			if index < peak.start+(uint64(1)<<uint64(peak.height)) {
+				return i, j
+			}
+		}
+	}
+	return -1, -1
+}
+
+// GenProof returns an inclusion proof for the leaf at index.
+func (b *Belt) GenProof(index uint64) (*BeltProof, error) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if index >= b.leaves {
+		return nil, ErrOutOfRange
+	}
+	ranges := beltRanges(b.leaves)
+	i, j := locate(ranges, index)
+	items := make([]Hash, 0, 0)
+	for h := 0; h < ranges[i][j].height; h++ {
+		sib, err := b.store.Get(beltPos((index>>uint64(h)^1)<<uint64(h), h))
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, sib)
+	}
+	hashes, err := b.rangeHashes(ranges)
+	if err != nil {
+		return nil, err
+	}
+	size := BeltSize(b.leaves)
+	items = foldProof(b.merger, size, hashes[i], j, items)
+	roots := make([]Hash, len(hashes))
+	for k, h := range hashes {
+		roots[k] = bagBelt(b.merger, size, h)
+	}
+	items = foldProof(b.merger, size, roots, i, items)
+	return &BeltProof{LeafCount: b.leaves, Items: items}, nil
+}
+
+// Merger returns the merger the belt was built with.
+func (b *Belt) Merger() Merger {
+	return b.merger
+}
+
+// Store returns the backing store.
+func (b *Belt) Store() Store {
+	return b.store
+}
+
+// Verify reports whether leaf at index leads to root.
+func (p *BeltProof) Verify(root Hash, index uint64, leaf Hash) bool {
+	return p.VerifyWith(DefaultMerger, root, index, leaf)
+}
+
+// VerifyWith is like Verify for a belt built with merger.
+func (p *BeltProof) VerifyWith(merger Merger, root Hash, index uint64, leaf Hash) bool {
+	if index >= p.LeafCount {
+		return false
+	}
+	ranges := beltRanges(p.LeafCount)
+	i, j := locate(ranges, index)
+	size := BeltSize(p.LeafCount)
+	items := p.Items
+	take := func() (Hash, bool) {
+		if len(items) == 0 {
+			return Hash{}, false
+		}
+		h := items[0]
+		items = items[1:]
+		return h, true
+	}
+	unfold := func(cur Hash, i, n int) (Hash, bool) {
+		if i > 0 {
+			left, ok := take()
+			if !ok {
+				return Hash{}, false
+			}
+			cur = merger.BagPeaks(size, left, cur)
+		}
+		for k := i + 1; k < n; k++ {
+			right, ok := take()
+			if !ok {
+				return Hash{}, false
+			}
+			cur = merger.BagPeaks(size, cur, right)
+		}
+		return cur, true
+	}
+	cur := leaf
+	for h := 0; h < ranges[i][j].height; h++ {
+		sib, ok := take()
+		if !ok {
+			return false
+		}
+		parent := beltPos(index>>uint64(h+1)<<uint64(h+1), h+1)
+		if (index>>uint64(h))&1 == 0 {
+			cur = merger.Merge(parent, cur, sib)
+		} else {
+			cur = merger.Merge(parent, sib, cur)
+		}
+	}
+	cur, ok := unfold(cur, j, len(ranges[i]))
+	if !ok {
+		return false
+	}
+	cur, ok = unfold(cur, i, len(ranges))
+	return ok && len(items) == 0 && equal_hash(cur, root)
+}
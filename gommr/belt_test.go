@@ -0,0 +1,167 @@
+package gommr
+
+import (
+	"math/bits"
+	"testing"
+)
+
+func TestBeltLayout(t *testing.T) {
+	b, err := NewBelt(NewMemStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 300; i++ {
+		if _, err := b.Append(leafHash(i)); err != nil {
+			t.Fatal(err)
+		}
+		leaves := uint64(i + 1)
+		if b.Store().Size() != BeltSize(leaves) {
+			t.Fatalf("%d leaves: %d nodes stored, want %d", leaves, b.Store().Size(), BeltSize(leaves))
+		}
+		if n, ok := beltLeafCount(BeltSize(leaves)); !ok || n != leaves {
+			t.Fatalf("leaf count of size %d is %d", BeltSize(leaves), n)
+		}
+		if _, ok := beltLeafCount(BeltSize(leaves) - 1); ok && BeltSize(leaves)-1 != BeltSize(leaves-1) {
+			t.Fatalf("size %d accepted", BeltSize(leaves)-1)
+		}
+		// every node is created where beltPos expects it
+		if h, _ := b.Get(beltPos(uint64(i), 0)); h != leafHash(i) {
+			t.Fatalf("leaf %d not at %d", i, beltPos(uint64(i), 0))
+		}
+		covered := uint64(0)
+		for _, r := range beltRanges(leaves) {
+			for _, peak := range r {
+				if peak.start != covered || peak.height != r[0].height {
+					t.Fatalf("%d leaves: bad peak %v", leaves, peak)
+				}
+				covered += 1 << uint64(peak.height)
+			}
+		}
+		if covered != leaves {
+			t.Fatalf("%d leaves: peaks cover %d", leaves, covered)
+		}
+	}
+	// the merges of leaves 0..4, see the picture in belt.go
+	want := []Hash{leafHash(0), leafHash(1)}
+	want = append(want, merge2(want[0], want[1]), leafHash(2), leafHash(3))
+	want = append(want, merge2(want[3], want[4]), leafHash(4))
+	want = append(want, merge2(want[2], want[5]))
+	for pos, h := range want {
+		if got, _ := b.Get(uint64(pos)); got != h {
+			t.Fatalf("node %d differs", pos)
+		}
+	}
+}
+
+func TestBeltProofs(t *testing.T) {
+	b, _ := NewBelt(NewMemStore())
+	for i := 0; i < 200; i++ {
+		b.Append(leafHash(i))
+		root, err := b.Root()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for index := 0; index <= i; index++ {
+			proof, err := b.GenProof(uint64(index))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !proof.Verify(root, uint64(index), leafHash(index)) {
+				t.Fatalf("%d leaves: proof of leaf %d failed", i+1, index)
+			}
+			if proof.Verify(root, uint64(index), leafHash(index+1)) {
+				t.Fatalf("%d leaves: proof of leaf %d accepted a wrong leaf", i+1, index)
+			}
+			dist := i - index
+			if max := 2*bits.Len(uint(dist)) + 3; len(proof.Items) > max {
+				t.Fatalf("%d leaves: proof of leaf %d at distance %d has %d items", i+1, index, dist, len(proof.Items))
+			}
+		}
+	}
+	proof, _ := b.GenProof(10)
+	root, _ := b.Root()
+	short := &BeltProof{LeafCount: proof.LeafCount, Items: proof.Items[1:]}
+	if short.Verify(root, 10, leafHash(10)) {
+		t.Fatal("truncated proof accepted")
+	}
+	if _, err := b.GenProof(200); err != ErrOutOfRange {
+		t.Fatalf("proof of a missing leaf: %v", err)
+	}
+}
+
+// sizeMerger hashes the mmrSize into every bag.
+type sizeMerger struct{}
+
+func (sizeMerger) Merge(pos uint64, left, right Hash) Hash {
+	return merge2(left, right)
+}
+
+func (sizeMerger) BagPeaks(mmrSize uint64, left, right Hash) Hash {
+	return RlpHash([]interface{}{mmrSize, left, right})
+}
+
+func TestBeltBagSize(t *testing.T) {
+	b, _ := NewBelt(NewMemStore(), WithMerger(sizeMerger{}))
+	for i := 0; i < 7; i++ {
+		b.Append(leafHash(i))
+	}
+	// 7 leaves are the peaks of heights 2, 1 and 0 in 11 nodes
+	hashes, _ := b.rangeHashes(beltRanges(7))
+	var peaks []Hash
+	for _, r := range hashes {
+		peaks = append(peaks, r...)
+	}
+	want := RlpHash([]interface{}{uint64(11), RlpHash([]interface{}{uint64(11), peaks[0], peaks[1]}), peaks[2]})
+	if root, _ := b.Root(); BeltSize(7) != 11 || len(peaks) != 3 || root != want {
+		t.Fatalf("root %x, want the peaks bagged with size 11", root)
+	}
+	proof, _ := b.GenProof(3)
+	if !proof.VerifyWith(sizeMerger{}, want, 3, leafHash(3)) {
+		t.Fatal("proof does not bag with the size")
+	}
+}
+
+func TestBeltHistory(t *testing.T) {
+	if _, err := New(NewMemStore(), WithBelt(), WithHistory(NewHistory())); err != ErrBeltHistory {
+		t.Fatalf("belt opened with a history: %v", err)
+	}
+}
+
+func TestAccumulator(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithBelt()}} {
+		store := NewMemStore()
+		acc, err := New(store, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 50; i++ {
+			index, err := acc.Append(leafHash(i))
+			if err != nil || index != uint64(i) {
+				t.Fatalf("append %d returned %d, %v", i, index, err)
+			}
+		}
+		root, _ := acc.Root()
+		for i := uint64(0); i < acc.LeafCount(); i++ {
+			proof, err := acc.LeafProof(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !proof.Verify(root, i, leafHash(int(i))) {
+				t.Fatalf("belt %v: proof of leaf %d failed", opts != nil, i)
+			}
+		}
+		// reopening continues with the same layout
+		again, err := New(store, opts...)
+		if err != nil || again.LeafCount() != 50 {
+			t.Fatalf("reopened with %d leaves: %v", again.LeafCount(), err)
+		}
+		if r, _ := again.Root(); r != root {
+			t.Fatal("root changed on reopen")
+		}
+	}
+	store := NewMemStore()
+	store.Append(0, []Hash{leafHash(0), leafHash(1)})
+	if _, err := NewBelt(store); err != ErrBadSize {
+		t.Fatalf("belt of 2 nodes opened: %v", err)
+	}
+}
@@ -0,0 +1,267 @@
+package gommr
+
+import (
+	"container/list"
+	"sync"
+)
+
+// CachedStore sits in front of another store and keeps its hottest
+// positions in memory. Every proof and root reads the peaks and the levels
+// right below them, so these are pinned for as long as they stay near the
+// top; other reads go through an LRU of recently read nodes.
+//
+// The pinned nodes follow the peaks as pushes merge mountains, which
+// assumes the mmr layout of positions; it does not fit the store of a belt.
+type CachedStore struct {
+	lock     sync.Mutex
+	store    Store
+	levels   int
+	capacity int
+	pinned   map[uint64]Hash
+	lru      *list.List // of *cacheEntry, most recent first
+	entries  map[uint64]*list.Element
+	// gen changes on Truncate, a read that raced with it is not cached
+	gen    uint64
+	hits   uint64
+	misses uint64
+}
+
+type cacheEntry struct {
+	pos  uint64
+	hash Hash
+}
+
+// CacheStats counts the reads served from memory and from the store, and
+// the nodes held in memory.
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+	Pinned int
+	Cached int
+}
+
+// NewCachedStore caches store, pinning the peaks and the levels nodes
+// below each of them, and keeping up to capacity other nodes.
+func NewCachedStore(store Store, levels, capacity int) (*CachedStore, error) {
+	size := store.Size()
+	if size != 0 && !ValidSize(size) {
+		return nil, ErrBadSize
+	}
+	s := &CachedStore{
+		store:    store,
+		levels:   levels,
+		capacity: capacity,
+		pinned:   make(map[uint64]Hash),
+		lru:      list.New(),
+		entries:  make(map[uint64]*list.Element),
+	}
+	if err := s.pinAll(size); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// walkLevels calls f on the nodes of the subtree at pos of height h that
+// are from to to levels below pos, both included.
+func walkLevels(pos uint64, h, from, to int, f func(pos uint64)) {
+	if to < 0 {
+		return
+	}
+	if from <= 0 {
+		f(pos)
+	}
+	if h == 0 {
+		return
+	}
+	walkLevels(pos-(uint64(1)<<uint(h)), h-1, from-1, to-1, f)
+	walkLevels(pos-1, h-1, from-1, to-1, f)
+}
+
+func cachePeaks(size uint64) []uint64 {
+	if size == 0 {
+		return nil
+	}
+	return get_peaks(size)
+}
+
+// pinAll pins the nodes near the peaks of size from scratch, moving the
+// nodes that are no longer near a peak to the LRU.
+func (s *CachedStore) pinAll(size uint64) error {
+	pinned := make(map[uint64]Hash, len(s.pinned))
+	var err error
+	for _, peak := range cachePeaks(size) {
+		walkLevels(peak, pos_height_in_tree(peak), 0, s.levels, func(pos uint64) {
+			if h, ok := s.pinned[pos]; ok {
+				pinned[pos] = h
+				return
+			}
+			if e, ok := s.entries[pos]; ok {
+				pinned[pos] = e.Value.(*cacheEntry).hash
+				s.forget(pos)
+				return
+			}
+			h, gerr := s.store.Get(pos)
+			if gerr != nil && err == nil {
+				err = gerr
+			}
+			pinned[pos] = h
+		})
+	}
+	if err != nil {
+		return err
+	}
+	old := s.pinned
+	s.pinned = pinned
+	for pos, h := range old {
+		if _, ok := pinned[pos]; !ok && pos < size {
+			s.remember(pos, h)
+		}
+	}
+	return nil
+}
+
+func (s *CachedStore) unpin(pos uint64) {
+	if h, ok := s.pinned[pos]; ok {
+		delete(s.pinned, pos)
+		s.remember(pos, h)
+	}
+}
+
+func (s *CachedStore) remember(pos uint64, h Hash) {
+	if s.capacity <= 0 {
+		return
+	}
+	if e, ok := s.entries[pos]; ok {
+		s.lru.MoveToFront(e)
+		return
+	}
+	s.entries[pos] = s.lru.PushFront(&cacheEntry{pos, h})
+	for s.lru.Len() > s.capacity {
+		s.forget(s.lru.Back().Value.(*cacheEntry).pos)
+	}
+}
+
+func (s *CachedStore) forget(pos uint64) {
+	if e, ok := s.entries[pos]; ok {
+		s.lru.Remove(e)
+		delete(s.entries, pos)
+	}
+}
+
+func (s *CachedStore) Get(pos uint64) (Hash, error) {
+	s.lock.Lock()
+	if h, ok := s.pinned[pos]; ok {
+		s.hits++
+		s.lock.Unlock()
+		return h, nil
+	}
+	if e, ok := s.entries[pos]; ok {
+		s.hits++
+		s.lru.MoveToFront(e)
+		s.lock.Unlock()
+		return e.Value.(*cacheEntry).hash, nil
+	}
+	s.misses++
+	gen := s.gen
+	s.lock.Unlock()
+
+	h, err := s.store.Get(pos)
+	if err != nil {
+		return h, err
+	}
+	s.lock.Lock()
+	if _, ok := s.pinned[pos]; !ok && s.gen == gen {
+		s.remember(pos, h)
+	}
+	s.lock.Unlock()
+	return h, nil
+}
+
+// Append writes through to the store. The nodes that the new peaks lift
+// more than levels below the top are unpinned, the new nodes near the top
+// are pinned.
+func (s *CachedStore) Append(pos uint64, hashes []Hash) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.store.Append(pos, hashes); err != nil {
+		return err
+	}
+	end := pos + uint64(len(hashes))
+	old, peaks := cachePeaks(pos), cachePeaks(end)
+	for _, peak := range peaks {
+		h := pos_height_in_tree(peak)
+		start := peak + 2 - 2<<uint(h)
+		for _, q := range old {
+			if q >= start && q < peak {
+				// the old peak is now shift levels deeper
+				shift := h - pos_height_in_tree(q)
+				walkLevels(q, pos_height_in_tree(q), s.levels-shift+1, s.levels, s.unpin)
+			}
+		}
+	}
+	for i, hash := range hashes {
+		p := pos + uint64(i)
+		for _, peak := range peaks {
+			if peak >= p {
+				if pos_height_in_tree(peak)-pos_height_in_tree(p) <= s.levels {
+					s.pinned[p] = hash
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (s *CachedStore) Size() uint64 {
+	return s.store.Size()
+}
+
+// Truncate drops the cached nodes from size on and pins the nodes near the
+// peaks of the smaller mmr, reading those not in memory from the store.
+func (s *CachedStore) Truncate(size uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.store.Truncate(size); err != nil {
+		return err
+	}
+	s.gen++
+	for e := s.lru.Front(); e != nil; {
+		next := e.Next()
+		if pos := e.Value.(*cacheEntry).pos; pos >= size {
+			s.forget(pos)
+		}
+		e = next
+	}
+	return s.pinAll(size)
+}
+
+// Rewrite writes through to the store, which has to be a Rewriter, and
+// updates the node if it is held.
+func (s *CachedStore) Rewrite(pos uint64, h Hash) error {
+	w, ok := s.store.(Rewriter)
+	if !ok {
+		return ErrNoRewrite
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := w.Rewrite(pos, h); err != nil {
+		return err
+	}
+	// reads of the old hash in flight are not remembered
+	s.gen++
+	if _, ok := s.pinned[pos]; ok {
+		s.pinned[pos] = h
+	}
+	if e, ok := s.entries[pos]; ok {
+		e.Value.(*cacheEntry).hash = h
+	}
+	return nil
+}
+
+// Stats returns the hit and miss counts and the number of nodes held.
+func (s *CachedStore) Stats() CacheStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return CacheStats{Hits: s.hits, Misses: s.misses, Pinned: len(s.pinned), Cached: s.lru.Len()}
+}
@@ -0,0 +1,107 @@
+package gommr
+
+import "testing"
+
+// countingStore counts the reads that reach the store.
+type countingStore struct {
+	*MemStore
+	gets int
+}
+
+func (s *countingStore) Get(pos uint64) (Hash, error) {
+	s.gets++
+	return s.MemStore.Get(pos)
+}
+
+// checkPinned compares the pinned nodes with those at most levels below a
+// peak.
+func checkPinned(t *testing.T, s *CachedStore, levels int) {
+	t.Helper()
+	size := s.Size()
+	want := 0
+	for _, peak := range cachePeaks(size) {
+		start := peak + 2 - 2<<uint(pos_height_in_tree(peak))
+		for pos := start; pos <= peak; pos++ {
+			if pos_height_in_tree(peak)-pos_height_in_tree(pos) > levels {
+				continue
+			}
+			want++
+			h, ok := s.pinned[pos]
+			if stored, _ := s.store.Get(pos); !ok || h != stored {
+				t.Fatalf("size %d: node %d not pinned", size, pos)
+			}
+		}
+	}
+	if len(s.pinned) != want {
+		t.Fatalf("size %d: %d nodes pinned, want %d", size, len(s.pinned), want)
+	}
+}
+
+func TestCachedStore(t *testing.T) {
+	backing := &countingStore{MemStore: NewMemStore()}
+	buildMMR(t, backing, 20)
+	cache, err := NewCachedStore(backing, 2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPinned(t, cache, 2)
+	m := buildMMR(t, cache, 20)
+	for i := 20; i < 300; i++ {
+		m.Push(leafHash(i))
+		checkPinned(t, cache, 2)
+	}
+
+	backing.gets = 0
+	want, _ := buildMMR(t, NewMemStore(), 300).Root()
+	if root, _ := m.Root(); root != want || backing.gets != 0 {
+		t.Fatalf("root %x read %d nodes from the store", root, backing.gets)
+	}
+
+	// the lowest nodes are neither pinned nor kept once evicted
+	for _, pos := range []uint64{0, 1, 3, 4, 7, 0} {
+		cache.Get(pos)
+	}
+	if backing.gets != 6 {
+		t.Fatalf("%d reads reached the store, want 6", backing.gets)
+	}
+	cache.Get(7)
+	st := cache.Stats()
+	if backing.gets != 6 || st.Cached != 4 || st.Misses != 6 || st.Hits == 0 {
+		t.Fatalf("stats %+v, %d store reads", st, backing.gets)
+	}
+
+	if err := m.Rewind(LeafCountToSize(123)); err != nil {
+		t.Fatal(err)
+	}
+	checkPinned(t, cache, 2)
+	want, _ = buildMMR(t, NewMemStore(), 123).Root()
+	if root, _ := m.Root(); root != want {
+		t.Fatal("root after rewind")
+	}
+	for pos := range cache.entries {
+		if pos >= cache.Size() {
+			t.Fatalf("dropped node %d still cached", pos)
+		}
+	}
+	for i := 123; i < 200; i++ {
+		m.Push(leafHash(i))
+		checkPinned(t, cache, 2)
+	}
+
+	// a rewrite reaches the store and the pinned or cached copy
+	cache.Get(0)
+	for _, pos := range []uint64{Peaks(m.Size())[0], 0} {
+		if err := cache.Rewrite(pos, Hash{1}); err != nil {
+			t.Fatal(err)
+		}
+		h, _ := cache.Get(pos)
+		b, _ := backing.Get(pos)
+		if h != (Hash{1}) || b != (Hash{1}) {
+			t.Fatalf("node %d not rewritten", pos)
+		}
+	}
+	hidden, _ := NewCachedStore(noRewriteStore{NewMemStore()}, 2, 4)
+	if err := hidden.Rewrite(0, Hash{}); err != ErrNoRewrite {
+		t.Fatalf("rewrite without Rewrite: %v", err)
+	}
+}
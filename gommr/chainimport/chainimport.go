@@ -0,0 +1,315 @@
+// Package chainimport builds an mmr of block header hashes from chain files
+// in the format written by geth export: a plain concatenation of rlp
+// encoded blocks, each a list starting with the header.
+package chainimport
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/go-mmr/gommr"
+	"github.com/go-mmr/gommr/rlp"
+	"golang.org/x/crypto/sha3"
+)
+
+var (
+	ErrGap          = errors.New("chainimport: block number gap")
+	ErrUnknownBlock = errors.New("chainimport: block not imported")
+	ErrParent       = errors.New("chainimport: parent hash mismatch")
+)
+
+// the header fields used by the importer, by list index
+const (
+	parentHashField = 0
+	numberField     = 8
+)
+
+// Header is the part of a block header the importer needs.
+type Header struct {
+	Hash       gommr.Hash // keccak256 of the rlp encoded header
+	ParentHash gommr.Hash
+	Number     uint64
+}
+
+// Checkpoint is the persisted import state. The leaves of the mmr are the
+// header hashes, so the mapping from block number to leaf index is
+// First + index.
+type Checkpoint struct {
+	First uint64
+	Size  uint64
+	Root  gommr.Hash
+}
+
+// Importer appends header hashes of a chain to a file backed mmr in dir.
+type Importer struct {
+	dir   string
+	store *gommr.FileStore
+	mmr   *gommr.MMR
+	first uint64
+	// CheckpointEvery makes ImportChain checkpoint after that many blocks,
+	// zero only checkpoints at the end of the input.
+	CheckpointEvery uint64
+}
+
+// Open opens the import state in dir, creating it if needed. Nodes written
+// after the last checkpoint are discarded, so an interrupted import resumes
+// from the checkpoint.
+func Open(dir string) (*Importer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	store, err := gommr.OpenFileStore(filepath.Join(dir, "nodes"))
+	if err != nil {
+		return nil, err
+	}
+	cp, err := readCheckpoint(filepath.Join(dir, "checkpoint"))
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	if cp.Size > store.Size() {
+		store.Close()
+		return nil, fmt.Errorf("chainimport: checkpoint size %d beyond stored %d nodes", cp.Size, store.Size())
+	}
+	if err := store.Truncate(cp.Size); err != nil {
+		store.Close()
+		return nil, err
+	}
+	m, err := gommr.NewMMR(store)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	if root, err := m.Root(); err != nil || root != cp.Root {
+		store.Close()
+		return nil, fmt.Errorf("chainimport: checkpoint root mismatch")
+	}
+	return &Importer{dir: dir, store: store, mmr: m, first: cp.First}, nil
+}
+
+func readCheckpoint(path string) (*Checkpoint, error) {
+	cp := new(Checkpoint)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return cp, rlp.Decode(f, cp)
+}
+
+// Checkpoint syncs the nodes and atomically records the current state.
+func (im *Importer) Checkpoint() error {
+	if err := im.store.Sync(); err != nil {
+		return err
+	}
+	root, err := im.mmr.Root()
+	if err != nil {
+		return err
+	}
+	enc, err := rlp.EncodeToBytes(&Checkpoint{First: im.first, Size: im.mmr.Size(), Root: root})
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(im.dir, "checkpoint.tmp")
+	if err := os.WriteFile(tmp, enc, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(im.dir, "checkpoint"))
+}
+
+// Close checkpoints and closes the store.
+func (im *Importer) Close() error {
+	err := im.Checkpoint()
+	if cerr := im.store.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// MMR returns the header mmr.
+func (im *Importer) MMR() *gommr.MMR {
+	return im.mmr
+}
+
+// Len returns the number of imported blocks.
+func (im *Importer) Len() uint64 {
+	return im.mmr.LeafCount()
+}
+
+// Head returns the number of the last imported block, ok is false if
+// nothing was imported yet.
+func (im *Importer) Head() (number uint64, ok bool) {
+	n := im.Len()
+	if n == 0 {
+		return 0, false
+	}
+	return im.first + n - 1, true
+}
+
+// LeafIndex returns the leaf index of block number.
+func (im *Importer) LeafIndex(number uint64) (uint64, bool) {
+	if number < im.first || number-im.first >= im.Len() {
+		return 0, false
+	}
+	return number - im.first, true
+}
+
+// HashOf returns the header hash of block number.
+func (im *Importer) HashOf(number uint64) (gommr.Hash, error) {
+	index, ok := im.LeafIndex(number)
+	if !ok {
+		return gommr.Hash{}, ErrUnknownBlock
+	}
+	return im.mmr.Get(gommr.LeafIndexToPos(index))
+}
+
+// Rewind drops every block above number and checkpoints, so that nodes of
+// the dropped branch are never mistaken for checkpointed ones.
+func (im *Importer) Rewind(number uint64) error {
+	index, ok := im.LeafIndex(number)
+	if !ok {
+		return ErrUnknownBlock
+	}
+	if err := im.mmr.Rewind(gommr.LeafCountToSize(index + 1)); err != nil {
+		return err
+	}
+	return im.Checkpoint()
+}
+
+// Append adds a header. A header at or below the head replaces the
+// imported branch from its number on if its hash differs and it connects
+// to the block below, a reorg. Known headers are skipped.
+func (im *Importer) Append(h *Header) error {
+	head, ok := im.Head()
+	if !ok {
+		im.first = h.Number
+		_, err := im.mmr.Push(h.Hash)
+		return err
+	}
+	if h.Number < im.first || h.Number > head+1 {
+		return ErrGap
+	}
+	if h.Number <= head {
+		known, err := im.HashOf(h.Number)
+		if err != nil {
+			return err
+		}
+		if known == h.Hash {
+			return nil
+		}
+		if h.Number == im.first {
+			return fmt.Errorf("chainimport: reorg of first block %d", h.Number)
+		}
+	}
+	// a header that does not connect is rejected before a reorg drops
+	// anything
+	parent, err := im.HashOf(h.Number - 1)
+	if err != nil {
+		return err
+	}
+	if parent != h.ParentHash {
+		return ErrParent
+	}
+	if h.Number <= head {
+		if err := im.Rewind(h.Number - 1); err != nil {
+			return err
+		}
+	}
+	_, err = im.mmr.Push(h.Hash)
+	return err
+}
+
+// ImportChain reads blocks from r until EOF and returns the number of
+// blocks read.
+func (im *Importer) ImportChain(r io.Reader) (int, error) {
+	stream := rlp.NewStream(bufio.NewReader(r), 0)
+	count := 0
+	for {
+		h, err := ReadBlockHeader(stream)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, fmt.Errorf("block %d of input: %v", count, err)
+		}
+		if err := im.Append(h); err != nil {
+			return count, fmt.Errorf("block %d: %v", h.Number, err)
+		}
+		count++
+		if im.CheckpointEvery != 0 && uint64(count)%im.CheckpointEvery == 0 {
+			if err := im.Checkpoint(); err != nil {
+				return count, err
+			}
+		}
+	}
+	return count, im.Checkpoint()
+}
+
+// ReadBlockHeader reads the next block from stream and returns its header.
+// The block body is skipped.
+func ReadBlockHeader(stream *rlp.Stream) (*Header, error) {
+	if _, err := stream.List(); err != nil {
+		return nil, err
+	}
+	raw, err := stream.Raw()
+	if err != nil {
+		return nil, err
+	}
+	// skip transactions, uncles and whatever later forks added
+	for {
+		if _, err := stream.Raw(); err == rlp.EOL {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if err := stream.ListEnd(); err != nil {
+		return nil, err
+	}
+	return DecodeHeader(raw)
+}
+
+// DecodeHeader extracts the fields of an rlp encoded header.
+func DecodeHeader(raw []byte) (*Header, error) {
+	h := &Header{}
+	hw := sha3.NewLegacyKeccak256()
+	hw.Write(raw)
+	hw.Sum(h.Hash[:0])
+
+	s := rlp.NewStream(bytes.NewReader(raw), uint64(len(raw)))
+	if _, err := s.List(); err != nil {
+		return nil, err
+	}
+	for i := 0; i <= numberField; i++ {
+		switch i {
+		case parentHashField:
+			b, err := s.Bytes()
+			if err != nil {
+				return nil, err
+			}
+			if len(b) != len(h.ParentHash) {
+				return nil, fmt.Errorf("chainimport: parent hash has %d bytes", len(b))
+			}
+			copy(h.ParentHash[:], b)
+		case numberField:
+			n, err := s.Uint()
+			if err != nil {
+				return nil, err
+			}
+			h.Number = n
+		default:
+			if _, err := s.Raw(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return h, nil
+}
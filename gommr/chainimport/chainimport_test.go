@@ -0,0 +1,224 @@
+package chainimport
+
+import (
+	"bytes"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-mmr/gommr"
+	"github.com/go-mmr/gommr/rlp"
+	"golang.org/x/crypto/sha3"
+)
+
+// testHeader has the field layout of an ethereum header.
+type testHeader struct {
+	ParentHash  gommr.Hash
+	UncleHash   gommr.Hash
+	Coinbase    [20]byte
+	Root        gommr.Hash
+	TxHash      gommr.Hash
+	ReceiptHash gommr.Hash
+	Bloom       [256]byte
+	Difficulty  *big.Int
+	Number      *big.Int
+	GasLimit    uint64
+	GasUsed     uint64
+	Time        uint64
+	Extra       []byte
+	MixDigest   gommr.Hash
+	Nonce       [8]byte
+}
+
+type testBlock struct {
+	Header *testHeader
+	Txs    [][]byte
+	Uncles []*testHeader
+}
+
+func keccak(b []byte) (h gommr.Hash) {
+	hw := sha3.NewLegacyKeccak256()
+	hw.Write(b)
+	hw.Sum(h[:0])
+	return h
+}
+
+// makeChain returns count blocks following parent, starting at number.
+// extra distinguishes forks.
+func makeChain(t *testing.T, parent gommr.Hash, number uint64, count int, extra string) ([]*testBlock, []gommr.Hash) {
+	var (
+		blocks []*testBlock
+		hashes []gommr.Hash
+	)
+	for i := 0; i < count; i++ {
+		h := &testHeader{
+			ParentHash: parent,
+			Difficulty: big.NewInt(131072),
+			Number:     new(big.Int).SetUint64(number + uint64(i)),
+			GasLimit:   8000000,
+			Time:       1600000000 + number + uint64(i),
+			Extra:      []byte(extra),
+		}
+		enc, err := rlp.EncodeToBytes(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parent = keccak(enc)
+		blocks = append(blocks, &testBlock{Header: h, Txs: [][]byte{[]byte("tx")}})
+		hashes = append(hashes, parent)
+	}
+	return blocks, hashes
+}
+
+func encodeChain(t *testing.T, blocks []*testBlock) []byte {
+	var buf bytes.Buffer
+	for _, b := range blocks {
+		if err := rlp.Encode(&buf, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func checkChain(t *testing.T, im *Importer, first uint64, hashes []gommr.Hash) {
+	if head, ok := im.Head(); !ok || head != first+uint64(len(hashes))-1 {
+		t.Fatalf("head %d, want %d", head, first+uint64(len(hashes))-1)
+	}
+	want, _ := gommr.NewMMR(gommr.NewMemStore())
+	for _, h := range hashes {
+		want.Push(h)
+	}
+	wantRoot, _ := want.Root()
+	root, _ := im.MMR().Root()
+	if root != wantRoot {
+		t.Fatalf("root %x, want %x", root, wantRoot)
+	}
+	for i, h := range hashes {
+		number := first + uint64(i)
+		index, ok := im.LeafIndex(number)
+		if !ok || index != uint64(i) {
+			t.Fatalf("block %d: leaf index %d, want %d", number, index, i)
+		}
+		got, err := im.HashOf(number)
+		if err != nil || got != h {
+			t.Fatalf("block %d: hash %x, want %x", number, got, h)
+		}
+		pos := gommr.LeafIndexToPos(index)
+		proof, err := im.MMR().GenProof(pos)
+		if err != nil || !proof.Verify(root, pos, h) {
+			t.Fatalf("block %d: proof failed", number)
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	dir := t.TempDir()
+	blocks, hashes := makeChain(t, gommr.Hash{}, 0, 100, "")
+	im, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := im.ImportChain(bytes.NewReader(encodeChain(t, blocks)))
+	if err != nil || n != 100 {
+		t.Fatalf("imported %d blocks: %v", n, err)
+	}
+	checkChain(t, im, 0, hashes)
+
+	// importing the same file again changes nothing
+	if _, err := im.ImportChain(bytes.NewReader(encodeChain(t, blocks))); err != nil {
+		t.Fatal(err)
+	}
+	checkChain(t, im, 0, hashes)
+	im.Close()
+
+	im, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer im.Close()
+	checkChain(t, im, 0, hashes)
+}
+
+func TestResume(t *testing.T) {
+	dir := t.TempDir()
+	blocks, hashes := makeChain(t, gommr.Hash{1}, 500, 60, "")
+	im, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	im.CheckpointEvery = 25
+	if _, err := im.ImportChain(bytes.NewReader(encodeChain(t, blocks[:40]))); err != nil {
+		t.Fatal(err)
+	}
+	im.Checkpoint()
+	// simulate a crash: blocks after the checkpoint reach the node file but
+	// no checkpoint is written
+	for _, b := range blocks[40:50] {
+		enc, _ := rlp.EncodeToBytes(b.Header)
+		h, _ := DecodeHeader(enc)
+		if err := im.Append(h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	im.store.Close()
+	if info, _ := os.Stat(filepath.Join(dir, "nodes")); uint64(info.Size()) != gommr.LeafCountToSize(50)*32 {
+		t.Fatalf("node file has %d bytes", info.Size())
+	}
+
+	im, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer im.Close()
+	checkChain(t, im, 500, hashes[:40])
+	if _, err := im.ImportChain(bytes.NewReader(encodeChain(t, blocks))); err != nil {
+		t.Fatal(err)
+	}
+	checkChain(t, im, 500, hashes)
+}
+
+func TestReorg(t *testing.T) {
+	im, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer im.Close()
+	blocks, hashes := makeChain(t, gommr.Hash{}, 0, 50, "")
+	if _, err := im.ImportChain(bytes.NewReader(encodeChain(t, blocks))); err != nil {
+		t.Fatal(err)
+	}
+	// a longer fork branching off after block 29
+	fork, forkHashes := makeChain(t, hashes[29], 30, 35, "fork")
+	if _, err := im.ImportChain(bytes.NewReader(encodeChain(t, fork))); err != nil {
+		t.Fatal(err)
+	}
+	checkChain(t, im, 0, append(hashes[:30:30], forkHashes...))
+
+	// a block that does not connect to the imported chain is rejected
+	orphan, _ := makeChain(t, gommr.Hash{9}, 65, 1, "")
+	if _, err := im.ImportChain(bytes.NewReader(encodeChain(t, orphan))); err == nil {
+		t.Fatal("orphan block imported")
+	}
+	// so is one within the chain, without dropping the blocks above it
+	orphan, _ = makeChain(t, gommr.Hash{9}, 20, 1, "")
+	enc, _ := rlp.EncodeToBytes(orphan[0].Header)
+	h, _ := DecodeHeader(enc)
+	if err := im.Append(h); err != ErrParent {
+		t.Fatalf("orphan reorg: %v", err)
+	}
+	checkChain(t, im, 0, append(hashes[:30:30], forkHashes...))
+
+	gap, _ := makeChain(t, forkHashes[34], 70, 1, "")
+	if _, err := im.ImportChain(bytes.NewReader(encodeChain(t, gap))); err == nil {
+		t.Fatal("block after gap imported")
+	}
+
+	if err := im.Rewind(10); err != nil {
+		t.Fatal(err)
+	}
+	checkChain(t, im, 0, hashes[:11])
+	if err := im.Rewind(11); err != ErrUnknownBlock {
+		t.Fatalf("rewind beyond head: %v", err)
+	}
+}
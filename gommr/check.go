@@ -0,0 +1,231 @@
+package gommr
+
+import (
+	"errors"
+	"sort"
+)
+
+var (
+	ErrSuspectLeaf     = errors.New("gommr: leaves may be corrupt, refusing to rebuild")
+	ErrHistoryMismatch = errors.New("gommr: rebuilt roots disagree with the root history")
+)
+
+// CheckReport is the outcome of a check. Corrupt lists the inner nodes,
+// lowest position first, whose stored hash differs from the hash
+// recomputed from the leaves below them, while the nodes above them still
+// agree with the leaves. Suspect lists the leaves that may have changed: a
+// changed leaf makes every node above it up to its peak disagree, and of
+// the two leaves of a pair the hashes cannot tell which one it was.
+//
+// A mountain of two leaves has no node above its peak, so a wrong peak
+// looks like a changed leaf. It is told apart with the root history if
+// the mmr has one, and its leaves are suspect otherwise.
+type CheckReport struct {
+	Size    uint64
+	Leaves  uint64
+	Corrupt []uint64
+	Suspect []uint64
+
+	// fixes holds the recomputed hashes of the corrupt nodes
+	fixes map[uint64]Hash
+}
+
+// OK reports whether no corrupt node and no suspect leaf was found.
+func (r *CheckReport) OK() bool {
+	return len(r.Corrupt) == 0 && len(r.Suspect) == 0
+}
+
+// repairedStore reads the recomputed hashes of corrupt nodes in place of
+// the stored ones.
+type repairedStore struct {
+	Store
+	fixes map[uint64]Hash
+}
+
+func (s repairedStore) Get(pos uint64) (Hash, error) {
+	if h, ok := s.fixes[pos]; ok {
+		return h, nil
+	}
+	return s.Store.Get(pos)
+}
+
+// repaired returns a view of the mmr with the corrupt nodes of r fixed.
+func (m *mmr) repaired(r *CheckReport) *mmr {
+	view := *m
+	view.store = repairedStore{m.store, r.fixes}
+	return &view
+}
+
+// leavesUnder returns the positions of the leaves below the node at pos.
+func leavesUnder(pos uint64) []uint64 {
+	height := pos_height_in_tree(pos)
+	var leaves []uint64
+	for p := pos + 2 - 2<<uint(height); p <= pos; p++ {
+		if pos_height_in_tree(p) == 0 {
+			leaves = append(leaves, p)
+		}
+	}
+	return leaves
+}
+
+// check recomputes every inner node bottom up with the merger, the way
+// push builds them, keeping the pending subtree roots on a stack. The
+// mismatching nodes are then told apart: a node whose child mismatches
+// only inherits the mismatch, the lowest node of a chain reaching its
+// parent sits above a changed leaf, and any other one is corrupt itself.
+func (m *mmr) check() (*CheckReport, error) {
+	if m.store.Size() != m.cur_size || m.cur_size != 0 && !ValidSize(m.cur_size) {
+		return nil, ErrBadSize
+	}
+	r := &CheckReport{Size: m.cur_size, Leaves: SizeToLeafCount(m.cur_size), fixes: make(map[uint64]Hash)}
+	mismatch := make(map[uint64]Hash)
+	var order []uint64
+	stack := make([]Hash, 0, 64)
+	for pos := uint64(0); pos < m.cur_size; pos++ {
+		stored, err := m.store.Get(pos)
+		if err != nil {
+			return nil, err
+		}
+		if pos_height_in_tree(pos) == 0 {
+			stack = append(stack, stored)
+			continue
+		}
+		if len(stack) < 2 {
+			return nil, ErrBadSize
+		}
+		left, right := stack[len(stack)-2], stack[len(stack)-1]
+		h := m.merger.Merge(pos, left, right)
+		if h != stored {
+			mismatch[pos] = h
+			order = append(order, pos)
+		}
+		stack = append(stack[:len(stack)-2], h)
+	}
+	// what is left on the stack are the peaks
+	if m.cur_size != 0 && len(stack) != len(get_peaks(m.cur_size)) {
+		return nil, ErrBadSize
+	}
+
+	var pairPeaks []uint64
+	for _, pos := range order {
+		height := pos_height_in_tree(pos)
+		_, leftBad := mismatch[pos-1<<uint(height)]
+		_, rightBad := mismatch[pos-1]
+		if leftBad || rightBad {
+			continue
+		}
+		parent := pos + parent_offset(height)
+		if pos_height_in_tree(pos+1) > height {
+			parent = pos + 1
+		}
+		switch {
+		case parent < m.cur_size:
+			if _, ok := mismatch[parent]; ok {
+				r.Suspect = append(r.Suspect, leavesUnder(pos)...)
+			} else {
+				r.Corrupt = append(r.Corrupt, pos)
+			}
+		case height > 1:
+			r.Corrupt = append(r.Corrupt, pos)
+		default:
+			pairPeaks = append(pairPeaks, pos)
+		}
+	}
+	for _, pos := range r.Corrupt {
+		r.fixes[pos] = mismatch[pos]
+	}
+	for _, pos := range pairPeaks {
+		if m.peakRecorded(r, pos, mismatch[pos]) {
+			r.Corrupt = append(r.Corrupt, pos)
+			r.fixes[pos] = mismatch[pos]
+		} else {
+			r.Suspect = append(r.Suspect, leavesUnder(pos)...)
+		}
+	}
+	sort.Slice(r.Corrupt, func(i, j int) bool { return r.Corrupt[i] < r.Corrupt[j] })
+	sort.Slice(r.Suspect, func(i, j int) bool { return r.Suspect[i] < r.Suspect[j] })
+	return r, nil
+}
+
+// peakRecorded reports whether the root history recorded the root the mmr
+// has with the peak at pos recomputed as h, so that the stored peak and
+// not one of its leaves is wrong.
+func (m *mmr) peakRecorded(r *CheckReport, pos uint64, h Hash) bool {
+	if m.history == nil {
+		return false
+	}
+	want, ok := m.history.ByLeafCount(r.Leaves)
+	if !ok {
+		return false
+	}
+	fixes := map[uint64]Hash{pos: h}
+	for p, fix := range r.fixes {
+		fixes[p] = fix
+	}
+	view := m.repaired(&CheckReport{fixes: fixes})
+	root, err := view.getRoot()
+	return err == nil && root == want.Root
+}
+
+// rebuild overwrites the corrupt inner nodes with the hashes check
+// recomputed for them. It refuses to when leaves are suspect, as that
+// would make the nodes commit to the changed leaves, and when the repaired
+// nodes would not give the recorded roots; the history is never changed.
+// Leaves are never written, so a rebuild cut short leaves only nodes for
+// the next one to repair.
+func (m *mmr) rebuild() (*CheckReport, error) {
+	r, err := m.check()
+	if err != nil || r.OK() {
+		return r, err
+	}
+	if len(r.Suspect) != 0 {
+		return r, ErrSuspectLeaf
+	}
+	w, ok := m.store.(Rewriter)
+	if !ok {
+		return nil, ErrNoRewrite
+	}
+	if m.history != nil {
+		view := m.repaired(r)
+		for n := uint64(1); n <= m.history.Len() && n <= r.Leaves; n++ {
+			view.cur_size = LeafCountToSize(n)
+			if view.cur_size <= r.Corrupt[0] {
+				continue
+			}
+			e, _ := m.history.ByLeafCount(n)
+			root, err := view.getRoot()
+			if err != nil {
+				return nil, err
+			}
+			if root != e.Root {
+				return r, ErrHistoryMismatch
+			}
+		}
+	}
+	for _, pos := range r.Corrupt {
+		if err := w.Rewrite(pos, r.fixes[pos]); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Check recomputes every inner node from the leaves and reports the nodes
+// that do not match. It fails with ErrBadSize if the store does not hold a
+// whole mmr of the expected size.
+func (m *MMR) Check() (*CheckReport, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.m.check()
+}
+
+// Rebuild checks the mmr and overwrites the corrupt inner nodes with the
+// hashes recomputed from the leaves. It returns the report of the check
+// before the rebuild. It fails with ErrSuspectLeaf if leaves may have
+// changed, with ErrHistoryMismatch if the repaired nodes do not give the
+// roots in the history, and with ErrNoRewrite if the store is no Rewriter.
+func (m *MMR) Rebuild() (*CheckReport, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.m.rebuild()
+}
@@ -0,0 +1,181 @@
+package gommr
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nodes")
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	m := buildMMR(t, store, 100)
+	want, _ := m.Root()
+	if r, err := m.Check(); err != nil || !r.OK() || r.Leaves != 100 {
+		t.Fatalf("clean mmr: %+v %v", r, err)
+	}
+
+	// flip bytes on disk behind the store
+	corrupt := func(positions ...uint64) {
+		f, err := os.OpenFile(path, os.O_RDWR, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		for _, pos := range positions {
+			var b [1]byte
+			f.ReadAt(b[:], int64(pos*32+5))
+			b[0] ^= 0x40
+			f.WriteAt(b[:], int64(pos*32+5))
+		}
+	}
+	// inner nodes of several mountains, one of them a peak
+	corrupt(5, 126, 188)
+	r, err := m.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r.Corrupt, []uint64{5, 126, 188}) {
+		t.Fatalf("corrupt positions %v", r.Corrupt)
+	}
+	if got, _ := m.Root(); got == want {
+		t.Fatal("corruption did not change the root")
+	}
+	if _, err := m.Rebuild(); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := m.Check(); err != nil || !r.OK() {
+		t.Fatalf("after rebuild: %+v %v", r, err)
+	}
+	if got, _ := m.Root(); got != want || m.LeafCount() != 100 {
+		t.Fatalf("root after rebuild %x, want %x", got, want)
+	}
+
+	// a changed leaf shows in all nodes above it, which must keep
+	// committing to the leaf they were built from
+	corrupt(LeafIndexToPos(9))
+	r, _ = m.Check()
+	if len(r.Corrupt) != 0 || !reflect.DeepEqual(r.Suspect, []uint64{15, 16}) {
+		t.Fatalf("leaf 9 changed: corrupt %v, suspect %v", r.Corrupt, r.Suspect)
+	}
+	before, _ := m.Get(126)
+	if _, err := m.Rebuild(); err != ErrSuspectLeaf {
+		t.Fatalf("rebuild over a changed leaf: %v", err)
+	}
+	if after, _ := m.Get(126); after != before {
+		t.Fatal("rebuild rewrote the nodes above a changed leaf")
+	}
+	corrupt(LeafIndexToPos(9))
+	if got, _ := m.Root(); got != want {
+		t.Fatal("nodes changed while a leaf was corrupt")
+	}
+
+	store.Append(store.Size(), []Hash{{}})
+	if _, err := m.Check(); err != ErrBadSize {
+		t.Fatalf("store grown behind the mmr: %v", err)
+	}
+}
+
+// flakyStore fails every rewrite after the first ok ones.
+type flakyStore struct {
+	*MemStore
+	ok int
+}
+
+func (s *flakyStore) Rewrite(pos uint64, h Hash) error {
+	if s.ok == 0 {
+		return ErrOutOfRange
+	}
+	s.ok--
+	return s.MemStore.Rewrite(pos, h)
+}
+
+// noRewriteStore hides the Rewrite of its MemStore.
+type noRewriteStore struct {
+	Store
+}
+
+func TestRebuildInPlace(t *testing.T) {
+	store := &flakyStore{MemStore: NewMemStore(), ok: 1}
+	m := buildMMR(t, store, 100)
+	want, _ := m.Root()
+	for _, pos := range []uint64{5, 126, 188} {
+		store.MemStore.Rewrite(pos, Hash{1})
+	}
+	// a rebuild cut short keeps all nodes and repairs the rest next time
+	if _, err := m.Rebuild(); err != ErrOutOfRange {
+		t.Fatalf("failing rewrite: %v", err)
+	}
+	r, _ := m.Check()
+	if store.Size() != m.Size() || !reflect.DeepEqual(r.Corrupt, []uint64{126, 188}) {
+		t.Fatalf("after a failed rebuild: %d nodes, corrupt %v", store.Size(), r.Corrupt)
+	}
+	store.ok = 2
+	if r, err := m.Rebuild(); err != nil || len(r.Corrupt) != 2 {
+		t.Fatalf("rebuild: %+v %v", r, err)
+	}
+	if got, _ := m.Root(); got != want {
+		t.Fatalf("root after rebuild %x, want %x", got, want)
+	}
+
+	plain := NewMemStore()
+	buildMMR(t, plain, 10)
+	plain.Rewrite(2, Hash{1})
+	pm, _ := NewMMR(noRewriteStore{plain})
+	if _, err := pm.Rebuild(); err != ErrNoRewrite {
+		t.Fatalf("rebuild without Rewrite: %v", err)
+	}
+}
+
+func TestRebuildHistory(t *testing.T) {
+	// 6 leaves, a mountain of 4 and one of 2 with its peak at 9
+	store := NewMemStore()
+	h := NewHistory()
+	m, _ := NewMMR(store, WithHistory(h))
+	for i := 0; i < 6; i++ {
+		m.Push(leafHash(i))
+	}
+	want, _ := m.Root()
+
+	// without a history a wrong peak of a pair looks like a changed leaf
+	plain, _ := NewMMR(store)
+	store.Rewrite(9, Hash{1})
+	if r, _ := plain.Check(); len(r.Corrupt) != 0 || !reflect.DeepEqual(r.Suspect, []uint64{7, 8}) {
+		t.Fatalf("pair peak without history: %+v", r)
+	}
+	r, err := m.Rebuild()
+	if err != nil || !reflect.DeepEqual(r.Corrupt, []uint64{9}) {
+		t.Fatalf("pair peak with history: %+v %v", r, err)
+	}
+	if got, _ := m.Root(); got != want {
+		t.Fatal("root not repaired")
+	}
+
+	// a changed leaf under it is still refused
+	leaf, _ := store.Get(7)
+	store.Rewrite(7, Hash{2})
+	if r, err := m.Rebuild(); err != ErrSuspectLeaf || !reflect.DeepEqual(r.Suspect, []uint64{7, 8}) {
+		t.Fatalf("changed leaf: %+v %v", r, err)
+	}
+	store.Rewrite(7, leaf)
+
+	// nodes whose repair does not give the recorded roots stay as they are
+	e, _ := h.ByLeafCount(4)
+	h.entries[3].Root = Hash{3}
+	store.Rewrite(2, Hash{4})
+	if _, err := m.Rebuild(); err != ErrHistoryMismatch {
+		t.Fatalf("history mismatch: %v", err)
+	}
+	if got, _ := store.Get(2); got != (Hash{4}) || h.entries[3].Root != (Hash{3}) {
+		t.Fatal("rebuild changed nodes or history it disagreed with")
+	}
+	h.entries[3] = e
+	if _, err := m.Rebuild(); err != nil {
+		t.Fatal(err)
+	}
+}
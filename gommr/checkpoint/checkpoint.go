@@ -0,0 +1,105 @@
+// Package checkpoint signs and verifies mmr checkpoints, signed tree heads
+// in the text format of C2SP tlog-checkpoint wrapped in a C2SP signed note:
+//
+//	example.com/log
+//	18
+//	Ia1ye5e0mN/7rd+8+RjrIiGSDzVNjOqyWOkBpnUbDgs=
+//	1700000000
+//
+//	— example.com/log Az3grlzVbZ1Ni+GFK5bT...
+//
+// The lines are the origin, the mmr size, the base64 root and the unix
+// time. Signatures are Ed25519, identified by the key name and key hash.
+package checkpoint
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-mmr/gommr"
+)
+
+var (
+	ErrCheckpoint = errors.New("checkpoint: malformed checkpoint")
+	ErrOrigin     = errors.New("checkpoint: origin does not match the log key")
+)
+
+// Checkpoint is the state of an mmr at a point in time.
+type Checkpoint struct {
+	Origin string
+	Size   uint64
+	Root   gommr.Hash
+	Time   time.Time
+}
+
+// Marshal returns the checkpoint text.
+func (c *Checkpoint) Marshal() string {
+	return c.Origin + "\n" +
+		strconv.FormatUint(c.Size, 10) + "\n" +
+		base64.StdEncoding.EncodeToString(c.Root[:]) + "\n" +
+		strconv.FormatInt(c.Time.Unix(), 10) + "\n"
+}
+
+// ParseCheckpoint parses a checkpoint text.
+func ParseCheckpoint(text string) (*Checkpoint, error) {
+	lines := strings.Split(text, "\n")
+	if len(lines) != 5 || lines[4] != "" || lines[0] == "" {
+		return nil, ErrCheckpoint
+	}
+	size, err := strconv.ParseUint(lines[1], 10, 64)
+	if err != nil || strconv.FormatUint(size, 10) != lines[1] {
+		return nil, ErrCheckpoint
+	}
+	root, err := base64.StdEncoding.DecodeString(lines[2])
+	if err != nil || len(root) != len(gommr.Hash{}) {
+		return nil, ErrCheckpoint
+	}
+	unix, err := strconv.ParseInt(lines[3], 10, 64)
+	if err != nil || strconv.FormatInt(unix, 10) != lines[3] {
+		return nil, ErrCheckpoint
+	}
+	if size != 0 && !gommr.ValidSize(size) {
+		return nil, ErrCheckpoint
+	}
+	return &Checkpoint{Origin: lines[0], Size: size, Root: gommr.BytesToHash(root), Time: time.Unix(unix, 0)}, nil
+}
+
+// New returns the current checkpoint of m. The root is taken at the size
+// read first, so a concurrent push cannot pair it with another size.
+func New(origin string, m *gommr.MMR, now time.Time) (*Checkpoint, error) {
+	size := m.Size()
+	root, err := m.RootAt(size)
+	if err != nil {
+		return nil, err
+	}
+	return &Checkpoint{Origin: origin, Size: size, Root: root, Time: now}, nil
+}
+
+// Sign signs the checkpoint with the log key, whose name has to be the
+// origin.
+func (c *Checkpoint) Sign(signer *Signer) ([]byte, error) {
+	if signer.Name() != c.Origin {
+		return nil, ErrOrigin
+	}
+	return Sign(c.Marshal(), signer)
+}
+
+// Verify opens a signed checkpoint with the log key and returns it, along
+// with the note holding any further signatures.
+func Verify(msg []byte, log *Verifier) (*Checkpoint, *Note, error) {
+	n, err := Open(msg, log)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := ParseCheckpoint(n.Text)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.Origin != log.Name() {
+		return nil, nil, ErrOrigin
+	}
+	return c, n, nil
+}
@@ -0,0 +1,151 @@
+package checkpoint
+
+import (
+	"bytes"
+	"crypto/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-mmr/gommr"
+)
+
+// The example key and note of golang.org/x/mod/sumdb/note.
+const (
+	exampleSkey = "PRIVATE+KEY+PeterNeumann+c74f20a3+AYEKFALVFGyNhPJEMzD1QIDr+Y7hfZx09iUvxdXHKDFz"
+	exampleVkey = "PeterNeumann+c74f20a3+ARpc2QcUPDhMQegwxbzhKqiBfsVkmqq/LDE4izWy10TW"
+	exampleNote = "If you think cryptography is the answer to your problem,\n" +
+		"then you don't know what your problem is.\n" +
+		"\n" +
+		"— PeterNeumann x08go/ZJkuBS9UG/SffcvIAQxVBtiFupLLr8pAcElZInNIuGUgYN1FFYC2pZSNXgKvqfqdngotpRZb6KE6RyyBwJnAM=\n"
+)
+
+func TestSignedNote(t *testing.T) {
+	v, err := NewVerifier(exampleVkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := Open([]byte(exampleNote), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(n.Verified) != 1 || n.Verified[0].KeyID != 0xc74f20a3 {
+		t.Fatalf("verified %v", n.Verified)
+	}
+	s, err := NewSigner(exampleSkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := Sign(n.Text, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg) != exampleNote {
+		t.Fatalf("signed note\n%s", msg)
+	}
+	tampered := strings.Replace(exampleNote, "answer", "question", 1)
+	if _, err := Open([]byte(tampered), v); err != ErrBadSignature {
+		t.Fatalf("tampered note: %v", err)
+	}
+	_, other, _ := GenerateKey(rand.Reader, "PeterNeumann")
+	ov, _ := NewVerifier(other)
+	if _, err := Open([]byte(exampleNote), ov); err != ErrUnverified {
+		t.Fatalf("note opened with another key: %v", err)
+	}
+	if _, err := NewVerifier(strings.Replace(exampleVkey, "c74f20a3", "c74f20a4", 1)); err != ErrKey {
+		t.Fatalf("key with a wrong hash: %v", err)
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	skey, vkey, err := GenerateKey(rand.Reader, "example.com/log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, _ := NewSigner(skey)
+	verifier, _ := NewVerifier(vkey)
+	m, _ := gommr.NewMMR(gommr.NewMemStore())
+	for i := 0; i < 10; i++ {
+		m.Push(gommr.RlpHash(uint64(i)))
+	}
+	now := time.Unix(1700000000, 0)
+	c, err := New("example.com/log", m, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := c.Sign(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(msg), "\n")
+	if lines[0] != "example.com/log" || lines[1] != "18" || lines[3] != "1700000000" || lines[4] != "" {
+		t.Fatalf("checkpoint\n%s", msg)
+	}
+	got, n, err := Verify(msg, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != *c || len(n.Verified) != 1 {
+		t.Fatalf("verified %+v", got)
+	}
+
+	// cosignatures by other keys are kept, but do not count for the log
+	wkey, wvkey, _ := GenerateKey(rand.Reader, "witness")
+	witness, _ := NewSigner(wkey)
+	wv, _ := NewVerifier(wvkey)
+	cosigned, err := Cosign(msg, witness)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(cosigned, msg) {
+		t.Fatal("cosigning changed the note")
+	}
+	if _, n, err = Verify(cosigned, verifier); err != nil || len(n.Unverified) != 1 {
+		t.Fatalf("cosigned checkpoint: %v", err)
+	}
+	if n, err := Open(cosigned, verifier, wv); err != nil || len(n.Verified) != 2 {
+		t.Fatalf("opened with witness key: %v", err)
+	}
+	if _, _, err := Verify(cosigned, wv); err != ErrOrigin {
+		t.Fatalf("checkpoint verified with the witness as log: %v", err)
+	}
+	if _, err := (&Checkpoint{Origin: "other"}).Sign(signer); err != ErrOrigin {
+		t.Fatalf("checkpoint of another origin signed: %v", err)
+	}
+	for _, bad := range []string{
+		"example.com/log\n18\n\n1700000000\n",
+		"example.com/log\n17\n" + lines[2] + "\n1700000000\n",
+		"example.com/log\n018\n" + lines[2] + "\n1700000000\n",
+		"example.com/log\n18\n" + lines[2] + "\n",
+	} {
+		if _, err := ParseCheckpoint(bad); err != ErrCheckpoint {
+			t.Fatalf("parsed %q", bad)
+		}
+	}
+}
+
+func TestNewDuringPush(t *testing.T) {
+	m, _ := gommr.NewMMR(gommr.NewMemStore())
+	m.Push(gommr.RlpHash(uint64(0)))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i < 300; i++ {
+			m.Push(gommr.RlpHash(uint64(i)))
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		c, err := New("example.com/log", m, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if root, _ := m.RootAt(c.Size); root != c.Root {
+			t.Fatalf("checkpoint of size %d has the root of another size", c.Size)
+		}
+	}
+}
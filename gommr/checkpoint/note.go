@@ -0,0 +1,268 @@
+package checkpoint
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	ErrKey          = errors.New("checkpoint: malformed key")
+	ErrNote         = errors.New("checkpoint: malformed note")
+	ErrUnverified   = errors.New("checkpoint: no signature by a known key")
+	ErrBadSignature = errors.New("checkpoint: invalid signature")
+)
+
+const algEd25519 = 1
+
+// KeyID returns the key hash of a signed note key: the first four bytes of
+// SHA-256 over the key name, a newline, the algorithm byte and the key.
+func KeyID(name string, pub ed25519.PublicKey) uint32 {
+	h := sha256.New()
+	io.WriteString(h, name)
+	h.Write([]byte{'\n', algEd25519})
+	h.Write(pub)
+	return binary.BigEndian.Uint32(h.Sum(nil))
+}
+
+func isKeyName(name string) bool {
+	return name != "" && utf8.ValidString(name) && strings.IndexFunc(name, unicode.IsSpace) < 0 && !strings.Contains(name, "+")
+}
+
+// Signer signs notes with an Ed25519 key.
+type Signer struct {
+	name string
+	id   uint32
+	key  ed25519.PrivateKey
+}
+
+// Verifier checks signatures of one key.
+type Verifier struct {
+	name string
+	id   uint32
+	key  ed25519.PublicKey
+}
+
+// Name returns the key name.
+func (s *Signer) Name() string { return s.name }
+
+// KeyID returns the key hash.
+func (s *Signer) KeyID() uint32 { return s.id }
+
+// Verifier returns the verifier of the signer's key.
+func (s *Signer) Verifier() *Verifier {
+	pub := s.key.Public().(ed25519.PublicKey)
+	return &Verifier{name: s.name, id: s.id, key: pub}
+}
+
+// Name returns the key name.
+func (v *Verifier) Name() string { return v.name }
+
+// KeyID returns the key hash.
+func (v *Verifier) KeyID() uint32 { return v.id }
+
+// GenerateKey returns a new signer key "PRIVATE+KEY+name+hash+key" and its
+// verifier key "name+hash+key", both in the signed note encoding.
+func GenerateKey(rand io.Reader, name string) (skey, vkey string, err error) {
+	if !isKeyName(name) {
+		return "", "", ErrKey
+	}
+	pub, priv, err := ed25519.GenerateKey(rand)
+	if err != nil {
+		return "", "", err
+	}
+	id := KeyID(name, pub)
+	skey = "PRIVATE+KEY+" + encodeKey(name, id, priv.Seed())
+	vkey = encodeKey(name, id, pub)
+	return skey, vkey, nil
+}
+
+func encodeKey(name string, id uint32, key []byte) string {
+	var h [4]byte
+	binary.BigEndian.PutUint32(h[:], id)
+	return name + "+" + hex.EncodeToString(h[:]) + "+" + base64.StdEncoding.EncodeToString(append([]byte{algEd25519}, key...))
+}
+
+func decodeKey(s string, size int) (string, uint32, []byte, error) {
+	parts := strings.SplitN(s, "+", 3)
+	if len(parts) != 3 || !isKeyName(parts[0]) || len(parts[1]) != 8 {
+		return "", 0, nil, ErrKey
+	}
+	h, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return "", 0, nil, ErrKey
+	}
+	key, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil || len(key) != 1+size || key[0] != algEd25519 {
+		return "", 0, nil, ErrKey
+	}
+	return parts[0], binary.BigEndian.Uint32(h), key[1:], nil
+}
+
+// NewSigner parses a signer key.
+func NewSigner(skey string) (*Signer, error) {
+	rest, ok := strings.CutPrefix(skey, "PRIVATE+KEY+")
+	if !ok {
+		return nil, ErrKey
+	}
+	name, id, seed, err := decodeKey(rest, ed25519.SeedSize)
+	if err != nil {
+		return nil, err
+	}
+	key := ed25519.NewKeyFromSeed(seed)
+	if KeyID(name, key.Public().(ed25519.PublicKey)) != id {
+		return nil, ErrKey
+	}
+	return &Signer{name: name, id: id, key: key}, nil
+}
+
+// NewVerifier parses a verifier key.
+func NewVerifier(vkey string) (*Verifier, error) {
+	name, id, pub, err := decodeKey(vkey, ed25519.PublicKeySize)
+	if err != nil {
+		return nil, err
+	}
+	if KeyID(name, pub) != id {
+		return nil, ErrKey
+	}
+	return &Verifier{name: name, id: id, key: pub}, nil
+}
+
+// Signature is a signature line of a note.
+type Signature struct {
+	Name  string
+	KeyID uint32
+	Sig   []byte
+}
+
+// Note is a text with signatures. Verified are the signatures of the keys
+// passed to Open, Unverified all others.
+type Note struct {
+	Text       string
+	Verified   []Signature
+	Unverified []Signature
+}
+
+const sigPrefix = "— "
+
+func (s Signature) line() string {
+	var h [4]byte
+	binary.BigEndian.PutUint32(h[:], s.KeyID)
+	return sigPrefix + s.Name + " " + base64.StdEncoding.EncodeToString(append(h[:], s.Sig...)) + "\n"
+}
+
+func checkText(text string) error {
+	if !strings.HasSuffix(text, "\n") || strings.Contains(text, "\n\n") || !utf8.ValidString(text) {
+		return ErrNote
+	}
+	for _, r := range text {
+		if r < 0x20 && r != '\n' {
+			return ErrNote
+		}
+	}
+	return nil
+}
+
+// Sign signs text, which has to end in a newline and contain no blank
+// lines, and returns the signed note.
+func Sign(text string, signers ...*Signer) ([]byte, error) {
+	if err := checkText(text); err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	b.WriteString(text)
+	b.WriteString("\n")
+	for _, s := range signers {
+		sig := Signature{Name: s.name, KeyID: s.id, Sig: ed25519.Sign(s.key, []byte(text))}
+		b.WriteString(sig.line())
+	}
+	return b.Bytes(), nil
+}
+
+// Cosign appends signatures to a note, keeping the existing ones.
+func Cosign(msg []byte, signers ...*Signer) ([]byte, error) {
+	text, sigs, err := split(msg)
+	if err != nil {
+		return nil, err
+	}
+	b := bytes.NewBufferString(text + "\n")
+	for _, sig := range sigs {
+		b.WriteString(sig.line())
+	}
+	for _, s := range signers {
+		sig := Signature{Name: s.name, KeyID: s.id, Sig: ed25519.Sign(s.key, []byte(text))}
+		b.WriteString(sig.line())
+	}
+	return b.Bytes(), nil
+}
+
+func split(msg []byte) (string, []Signature, error) {
+	i := bytes.LastIndex(msg, []byte("\n\n"))
+	if i < 0 {
+		return "", nil, ErrNote
+	}
+	text := string(msg[:i+1])
+	if err := checkText(text); err != nil {
+		return "", nil, err
+	}
+	rest := string(msg[i+2:])
+	if rest == "" || !strings.HasSuffix(rest, "\n") {
+		return "", nil, ErrNote
+	}
+	var sigs []Signature
+	for _, line := range strings.Split(strings.TrimSuffix(rest, "\n"), "\n") {
+		line, ok := strings.CutPrefix(line, sigPrefix)
+		if !ok {
+			return "", nil, ErrNote
+		}
+		name, b64, ok := strings.Cut(line, " ")
+		if !ok || !isKeyName(name) {
+			return "", nil, ErrNote
+		}
+		sig, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil || len(sig) < 5 {
+			return "", nil, ErrNote
+		}
+		sigs = append(sigs, Signature{Name: name, KeyID: binary.BigEndian.Uint32(sig), Sig: sig[4:]})
+	}
+	return text, sigs, nil
+}
+
+// Open parses a signed note and checks the signatures of the verifiers.
+// It fails if a signature of a known key is invalid or if no known key
+// signed the note.
+func Open(msg []byte, verifiers ...*Verifier) (*Note, error) {
+	text, sigs, err := split(msg)
+	if err != nil {
+		return nil, err
+	}
+	n := &Note{Text: text}
+	for _, sig := range sigs {
+		var known *Verifier
+		for _, v := range verifiers {
+			if v.name == sig.Name && v.id == sig.KeyID {
+				known = v
+			}
+		}
+		if known == nil {
+			n.Unverified = append(n.Unverified, sig)
+			continue
+		}
+		if !ed25519.Verify(known.key, []byte(text), sig.Sig) {
+			return nil, ErrBadSignature
+		}
+		n.Verified = append(n.Verified, sig)
+	}
+	if len(n.Verified) == 0 {
+		return nil, ErrUnverified
+	}
+	return n, nil
+}
@@ -0,0 +1,169 @@
+// Package client talks to an mmr served by package server.
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-mmr/gommr"
+	"github.com/go-mmr/gommr/server"
+)
+
+var (
+	ErrProof    = errors.New("client: proof does not verify")
+	ErrResponse = errors.New("client: malformed response")
+)
+
+// Error is an error reply of the server. After a failed append, Appended
+// of its leaves were appended from leaf index First on.
+type Error struct {
+	Status   int
+	Message  string
+	First    uint64
+	Appended uint64
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("client: %d %s", e.Status, e.Message)
+}
+
+// Client is a client of the server at URL.
+type Client struct {
+	URL    string
+	Client *http.Client
+}
+
+// New returns a client of the server at url, using http.DefaultClient.
+func New(url string) *Client {
+	return &Client{URL: url}
+}
+
+func (c *Client) do(method, path string, body, res interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, c.URL+path, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	hc := c.Client
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e server.AppendError
+		json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&e)
+		return &Error{Status: resp.StatusCode, Message: e.Error, First: e.First, Appended: e.Appended}
+	}
+	return json.NewDecoder(resp.Body).Decode(res)
+}
+
+// Root returns the current size, leaf count and root.
+func (c *Client) Root() (*server.Root, error) {
+	var res server.Root
+	if err := c.do(http.MethodGet, "/root", nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Append appends leaves and returns the index of the first one along
+// with the root after them.
+func (c *Client) Append(leaves ...gommr.Hash) (*server.AppendResponse, error) {
+	var res server.AppendResponse
+	if err := c.do(http.MethodPost, "/append", server.AppendRequest{Leaves: server.Hashes(leaves)}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Proof returns the inclusion proof of the leaf at index.
+func (c *Client) Proof(index uint64) (*server.Proof, error) {
+	var res server.Proof
+	if err := c.do(http.MethodGet, "/proof/"+strconv.FormatUint(index, 10), nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// VerifiedProof returns the inclusion proof of the leaf at index after
+// checking it with merger against a root the caller trusts, such as the
+// one of a cosigned checkpoint, of an mmr of trustedSize nodes. A proof
+// against a later root is accepted along with a consistency proof of that
+// root with the trusted one.
+func (c *Client) VerifiedProof(merger gommr.Merger, trustedSize uint64, trustedRoot gommr.Hash, index uint64) (*server.Proof, error) {
+	if trustedSize == 0 || !gommr.ValidSize(trustedSize) {
+		return nil, ErrProof
+	}
+	p, err := c.Proof(index)
+	if err != nil {
+		return nil, err
+	}
+	if p.Size < trustedSize {
+		return nil, ErrProof
+	}
+	if p.Size > trustedSize {
+		cp, err := c.Consistency(trustedSize, p.Size)
+		if err != nil {
+			return nil, err
+		}
+		if cp.OldSize != trustedSize || cp.NewSize != p.Size || !cp.Verify(merger, trustedRoot, gommr.Hash(p.Root)) {
+			return nil, ErrProof
+		}
+	} else if gommr.Hash(p.Root) != trustedRoot {
+		return nil, ErrProof
+	}
+	proof := gommr.NewMerkleProof(p.Size, server.GommrHashes(p.Items))
+	if p.Leaf != index || !proof.VerifyWith(merger, gommr.Hash(p.Root), gommr.LeafIndexToPos(index), gommr.Hash(p.LeafHash)) {
+		return nil, ErrProof
+	}
+	return p, nil
+}
+
+// Consistency returns the proof that the mmr of from nodes is a prefix of
+// the mmr of to nodes.
+func (c *Client) Consistency(from, to uint64) (*gommr.ConsistencyProof, error) {
+	q := url.Values{"from": {strconv.FormatUint(from, 10)}, "to": {strconv.FormatUint(to, 10)}}
+	var res server.Consistency
+	if err := c.do(http.MethodGet, "/consistency?"+q.Encode(), nil, &res); err != nil {
+		return nil, err
+	}
+	return &gommr.ConsistencyProof{
+		OldSize:  res.OldSize,
+		NewSize:  res.NewSize,
+		OldPeaks: server.GommrHashes(res.OldPeaks),
+		Items:    server.GommrHashes(res.Items),
+	}, nil
+}
+
+// Leaves returns the leaf hashes from start up to end.
+func (c *Client) Leaves(start, end uint64) ([]gommr.Hash, error) {
+	q := url.Values{"start": {strconv.FormatUint(start, 10)}, "end": {strconv.FormatUint(end, 10)}}
+	var res server.Leaves
+	if err := c.do(http.MethodGet, "/leaves?"+q.Encode(), nil, &res); err != nil {
+		return nil, err
+	}
+	if res.Start != start || uint64(len(res.Leaves)) != end-start {
+		return nil, ErrResponse
+	}
+	return server.GommrHashes(res.Leaves), nil
+}
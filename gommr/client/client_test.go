@@ -0,0 +1,137 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/go-mmr/gommr"
+	"github.com/go-mmr/gommr/server"
+)
+
+func TestEndToEnd(t *testing.T) {
+	store, err := gommr.OpenFileStore(filepath.Join(t.TempDir(), "nodes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	m, _ := gommr.NewMMR(store)
+	srv := httptest.NewServer(server.New(m))
+	defer srv.Close()
+	c := New(srv.URL)
+
+	if r, err := c.Root(); err != nil || r.Size != 0 {
+		t.Fatalf("root of empty mmr: %+v %v", r, err)
+	}
+	// appends from several clients get disjoint leaf ranges
+	var wg sync.WaitGroup
+	firsts := make([]uint64, 8)
+	for i := range firsts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var leaves []gommr.Hash
+			for j := 0; j < 5; j++ {
+				leaves = append(leaves, gommr.RlpHash(uint64(i*5+j)))
+			}
+			res, err := c.Append(leaves...)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			firsts[i] = res.First
+		}(i)
+	}
+	wg.Wait()
+	leaves, err := c.Leaves(0, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, first := range firsts {
+		for j := 0; j < 5; j++ {
+			if leaves[first+uint64(j)] != gommr.RlpHash(uint64(i*5+j)) {
+				t.Fatalf("append %d leaf %d not at %d", i, j, first+uint64(j))
+			}
+		}
+	}
+
+	root, err := c.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := m.Root()
+	if root.LeafCount != 40 || root.Size != m.Size() || gommr.Hash(root.Root) != want {
+		t.Fatalf("root %+v", root)
+	}
+	// the trusted root is the current one or an earlier one
+	earlySize := gommr.LeafCountToSize(13)
+	early, _ := m.RootAt(earlySize)
+	for i := uint64(0); i < 40; i++ {
+		for _, trusted := range []gommr.Hash{want, early} {
+			size := m.Size()
+			if trusted == early {
+				size = earlySize
+			}
+			p, err := c.VerifiedProof(gommr.DefaultMerger, size, trusted, i)
+			if err != nil {
+				t.Fatalf("leaf %d: %v", i, err)
+			}
+			if gommr.Hash(p.LeafHash) != leaves[i] || gommr.Hash(p.Root) != want {
+				t.Fatalf("leaf %d: proof %+v", i, p)
+			}
+		}
+	}
+	// a server showing another history than the trusted root fails
+	for _, tc := range []struct {
+		size uint64
+		root gommr.Hash
+	}{
+		{m.Size(), gommr.Hash{1}},
+		{earlySize, gommr.Hash{1}},
+		{gommr.LeafCountToSize(41), want},
+		{0, want},
+	} {
+		if _, err := c.VerifiedProof(gommr.DefaultMerger, tc.size, tc.root, 3); err != ErrProof {
+			t.Fatalf("proof against size %d root %x: %v", tc.size, tc.root, err)
+		}
+	}
+
+	old := root
+	res, err := c.Append(gommr.Hash{1}, gommr.Hash{2})
+	if err != nil || res.First != 40 || res.LeafCount != 42 {
+		t.Fatalf("append: %+v %v", res, err)
+	}
+	p, err := c.Consistency(old.Size, res.Size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Verify(gommr.DefaultMerger, gommr.Hash(old.Root), gommr.Hash(res.Root.Root)) {
+		t.Fatal("consistency proof failed")
+	}
+
+	for _, tc := range []struct {
+		err    func() error
+		status int
+	}{
+		{func() error { _, err := c.Proof(42); return err }, http.StatusNotFound},
+		{func() error { _, err := c.Leaves(30, 20); return err }, http.StatusBadRequest},
+		{func() error { _, err := c.Leaves(0, 43); return err }, http.StatusBadRequest},
+		{func() error { _, err := c.Consistency(5, res.Size); return err }, http.StatusBadRequest},
+		{func() error { _, err := c.Append(); return err }, http.StatusBadRequest},
+	} {
+		err := tc.err()
+		if e, ok := err.(*Error); !ok || e.Status != tc.status || e.Message == "" {
+			t.Fatalf("got %v, want status %d", err, tc.status)
+		}
+	}
+	resp, err := http.Get(srv.URL + "/append")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("GET /append: %s", resp.Status)
+	}
+}
@@ -0,0 +1,68 @@
+// Command chainimport appends the header hashes of geth exported chain
+// files to a persistent mmr.
+//
+//	chainimport -datadir ./headers chain.rlp [more.rlp ...]
+//	chainimport -datadir ./headers -rewind 1000
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/go-mmr/gommr/chainimport"
+)
+
+func main() {
+	datadir := flag.String("datadir", "headers", "directory of the header mmr")
+	rewind := flag.Int64("rewind", -1, "drop all blocks above this number before importing")
+	every := flag.Uint64("checkpoint", 10000, "checkpoint interval in blocks")
+	flag.Parse()
+
+	if err := run(*datadir, *rewind, *every, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "chainimport:", err)
+		os.Exit(1)
+	}
+}
+
+func run(datadir string, rewind int64, every uint64, files []string) (err error) {
+	im, err := chainimport.Open(datadir)
+	if err != nil {
+		return err
+	}
+	// Close writes the last checkpoint and syncs the store
+	defer func() {
+		if cerr := im.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	im.CheckpointEvery = every
+
+	if rewind >= 0 {
+		if err := im.Rewind(uint64(rewind)); err != nil {
+			return err
+		}
+	}
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		n, err := im.ImportChain(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		fmt.Printf("imported %d blocks from %s\n", n, name)
+	}
+	root, err := im.MMR().Root()
+	if err != nil {
+		return err
+	}
+	if head, ok := im.Head(); ok {
+		fmt.Printf("head %d, leaves %d, size %d, root %x\n", head, im.Len(), im.MMR().Size(), root)
+	} else {
+		fmt.Println("no blocks imported")
+	}
+	return nil
+}
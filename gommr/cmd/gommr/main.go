@@ -0,0 +1,614 @@
+// Command gommr builds persistent mmrs and proves and verifies their
+// leaves. All output is JSON.
+//
+//	gommr -dir ./log build -lines entries.txt
+//	gommr -dir ./log root
+//	gommr -dir ./log prove -leaf 7 -out leaf7.proof
+//	gommr verify -root <hex> -data entry.txt -proof leaf7.proof
+//	gommr -dir ./log peaks
+//	gommr -dir ./log info
+//	gommr -dir ./log check -repair
+//	gommr -dir ./log serve -addr localhost:8080
+//	gommr -dir ./log export -out log.dump
+//	gommr -dir ./copy -scheme rlp import log.dump
+//
+// build hashes every file, or with -lines every line, into a leaf with
+// the leaf hash of the scheme the mmr was created with. Proofs are written
+// as gommr envelopes, which name their scheme, so verify needs no -dir.
+// serve exposes the mmr with package server until interrupted, then waits
+// for pending requests and closes the mmr. export and
+// import move an mmr as a dump, see gommr.MMR.Export; import creates the
+// mmr with -scheme, which has to match the dump.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-mmr/gommr"
+	"github.com/go-mmr/gommr/ct"
+	"github.com/go-mmr/gommr/evm"
+	"github.com/go-mmr/gommr/grin"
+	"github.com/go-mmr/gommr/server"
+	"github.com/go-mmr/gommr/substrate"
+)
+
+// leafHashes hash leaf data for the schemes the tool can build.
+var leafHashes = map[string]func(pos uint64, data []byte) gommr.Hash{
+	"rlp":       func(pos uint64, data []byte) gommr.Hash { return gommr.RlpHash(data) },
+	"rfc9162":   func(pos uint64, data []byte) gommr.Hash { return ct.LeafHash(data) },
+	"evm":       func(pos uint64, data []byte) gommr.Hash { return evm.Keccak256(data) },
+	"substrate": func(pos uint64, data []byte) gommr.Hash { return substrate.LeafHash(data) },
+	"grin":      grin.LeafHash,
+}
+
+const usage = `usage: gommr [-dir dir] [-scheme name] command [flags]
+
+commands:
+  build [-lines] [file ...]   append leaves, from stdin if no file is given
+  root                        print the root
+  prove -leaf N [-out file]   prove the leaf at index N
+  verify -root hex (-leaf hex | -data file) -proof file
+  peaks                       print the peaks
+  info                        print size, leaf count and scheme
+  check [-repair]             recompute all inner nodes, rebuild bad ones
+                              unless leaves are suspect
+  serve [-addr host:port]     serve the mmr over HTTP
+  export [-leaves] [-out file]  write a dump, to stdout if no file is given
+  import [file]               read a dump into a new mmr, from stdin if no file is given
+`
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	dir := flag.String("dir", "mmr", "directory of the mmr")
+	scheme := flag.String("scheme", "rlp", "scheme of a new mmr: rlp, rfc9162, evm, substrate or grin")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	out, err := run(*dir, *scheme, flag.Arg(0), flag.Args()[1:])
+	if out != nil {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(out)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gommr:", err)
+		os.Exit(1)
+	}
+}
+
+func run(dir, scheme, cmd string, args []string) (interface{}, error) {
+	switch cmd {
+	case "build":
+		return build(dir, scheme, args)
+	case "root":
+		return withMMR(dir, args, root)
+	case "prove":
+		return prove(dir, args)
+	case "verify":
+		return verify(args)
+	case "peaks":
+		return withMMR(dir, args, peaks)
+	case "info":
+		return withMMR(dir, args, info)
+	case "check":
+		return check(dir, args)
+	case "serve":
+		return nil, serve(dir, scheme, args)
+	case "export":
+		return nil, export(dir, args)
+	case "import":
+		return importDump(dir, scheme, args)
+	}
+	return nil, fmt.Errorf("unknown command %q", cmd)
+}
+
+// mmrDir is an mmr opened from its directory, which holds the nodes and the
+// name of the scheme.
+type mmrDir struct {
+	dir    string
+	scheme gommr.Scheme
+	store  *gommr.FileStore
+	mmr    *gommr.MMR
+}
+
+var errNoMMR = errors.New("no mmr, run build first")
+
+func openDir(dir, scheme string, create bool) (*mmrDir, error) {
+	name, err := os.ReadFile(filepath.Join(dir, "scheme"))
+	switch {
+	case err == nil:
+		scheme = strings.TrimSpace(string(name))
+	case !os.IsNotExist(err):
+		return nil, err
+	case !create:
+		return nil, errNoMMR
+	default:
+		if leafHashes[scheme] == nil {
+			return nil, fmt.Errorf("cannot build leaves for scheme %q", scheme)
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(filepath.Join(dir, "scheme"), []byte(scheme+"\n"), 0644); err != nil {
+			return nil, err
+		}
+	}
+	s, ok := gommr.LookupScheme(scheme)
+	if !ok {
+		return nil, fmt.Errorf("unknown scheme %q", scheme)
+	}
+	store, err := gommr.OpenFileStore(filepath.Join(dir, "nodes"))
+	if err != nil {
+		return nil, err
+	}
+	m, err := gommr.NewMMR(store, gommr.WithScheme(s.Name))
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	return &mmrDir{dir: dir, scheme: s, store: store, mmr: m}, nil
+}
+
+func (l *mmrDir) Close() error {
+	if err := l.store.Sync(); err != nil {
+		l.store.Close()
+		return err
+	}
+	return l.store.Close()
+}
+
+// closeInto closes l and keeps the error in err if there is none yet, so
+// a command whose store fails to sync fails as well.
+func (l *mmrDir) closeInto(err *error) {
+	if cerr := l.Close(); *err == nil {
+		*err = cerr
+	}
+}
+
+func withMMR(dir string, args []string, f func(l *mmrDir) (interface{}, error)) (_ interface{}, err error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("unexpected arguments %q", args)
+	}
+	l, err := openDir(dir, "", false)
+	if err != nil {
+		return nil, err
+	}
+	defer l.closeInto(&err)
+	return f(l)
+}
+
+type rootOutput struct {
+	Size      uint64 `json:"size"`
+	LeafCount uint64 `json:"leaf_count"`
+	Root      string `json:"root"`
+}
+
+func root(l *mmrDir) (interface{}, error) {
+	r, err := l.mmr.Root()
+	if err != nil {
+		return nil, err
+	}
+	return rootOutput{Size: l.mmr.Size(), LeafCount: l.mmr.LeafCount(), Root: r.Hex()}, nil
+}
+
+type buildOutput struct {
+	Added uint64 `json:"added"`
+	rootOutput
+}
+
+func build(dir, scheme string, args []string) (_ interface{}, err error) {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	lines := fs.Bool("lines", false, "make a leaf of every line instead of every file")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	l, err := openDir(dir, scheme, true)
+	if err != nil {
+		return nil, err
+	}
+	defer l.closeInto(&err)
+	hash := leafHashes[l.scheme.Name]
+	if hash == nil {
+		return nil, fmt.Errorf("cannot build leaves for scheme %q", l.scheme.Name)
+	}
+	var added uint64
+	push := func(data []byte) error {
+		if _, err := l.mmr.Push(hash(l.mmr.Size(), data)); err != nil {
+			return err
+		}
+		added++
+		return nil
+	}
+	read := func(r io.Reader) error {
+		if !*lines {
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			return push(data)
+		}
+		sc := bufio.NewScanner(r)
+		sc.Buffer(nil, 1<<24)
+		for sc.Scan() {
+			if err := push(sc.Bytes()); err != nil {
+				return err
+			}
+		}
+		return sc.Err()
+	}
+	if fs.NArg() == 0 {
+		err = read(os.Stdin)
+	}
+	for _, name := range fs.Args() {
+		var f *os.File
+		if f, err = os.Open(name); err != nil {
+			break
+		}
+		err = read(f)
+		f.Close()
+		if err != nil {
+			err = fmt.Errorf("%s: %v", name, err)
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	r, err := root(l)
+	if err != nil {
+		return nil, err
+	}
+	return buildOutput{Added: added, rootOutput: r.(rootOutput)}, nil
+}
+
+type proveOutput struct {
+	Leaf     uint64 `json:"leaf"`
+	LeafHash string `json:"leaf_hash"`
+	Scheme   string `json:"scheme"`
+	Size     uint64 `json:"size"`
+	Root     string `json:"root"`
+	Proof    string `json:"proof"`
+	Out      string `json:"out,omitempty"`
+}
+
+func prove(dir string, args []string) (_ interface{}, err error) {
+	fs := flag.NewFlagSet("prove", flag.ContinueOnError)
+	leaf := fs.Int64("leaf", -1, "index of the leaf")
+	out := fs.String("out", "", "file to write the proof to")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if *leaf < 0 || fs.NArg() != 0 {
+		return nil, errors.New("prove needs -leaf N")
+	}
+	l, err := openDir(dir, "", false)
+	if err != nil {
+		return nil, err
+	}
+	defer l.closeInto(&err)
+	index := uint64(*leaf)
+	if index >= l.mmr.LeafCount() {
+		return nil, fmt.Errorf("leaf %d of %d", index, l.mmr.LeafCount())
+	}
+	pos := gommr.LeafIndexToPos(index)
+	hash, err := l.mmr.Get(pos)
+	if err != nil {
+		return nil, err
+	}
+	r, err := l.mmr.Root()
+	if err != nil {
+		return nil, err
+	}
+	proof, err := l.mmr.GenProof(pos)
+	if err != nil {
+		return nil, err
+	}
+	e, err := gommr.NewEnvelope(l.scheme.Name, index, r, proof)
+	if err != nil {
+		return nil, err
+	}
+	b := e.Encode()
+	if *out != "" {
+		if err := os.WriteFile(*out, b, 0644); err != nil {
+			return nil, err
+		}
+	}
+	return proveOutput{
+		Leaf:     index,
+		LeafHash: hash.Hex(),
+		Scheme:   l.scheme.Name,
+		Size:     e.MmrSize,
+		Root:     r.Hex(),
+		Proof:    hex.EncodeToString(b),
+		Out:      *out,
+	}, nil
+}
+
+type verifyOutput struct {
+	Valid    bool   `json:"valid"`
+	Leaf     uint64 `json:"leaf"`
+	LeafHash string `json:"leaf_hash"`
+	Scheme   string `json:"scheme"`
+	Size     uint64 `json:"size"`
+	Root     string `json:"root"`
+	Error    string `json:"error,omitempty"`
+}
+
+var errInvalid = errors.New("proof is invalid")
+
+func verify(args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	rootHex := fs.String("root", "", "expected root in hex")
+	leafHex := fs.String("leaf", "", "leaf hash in hex")
+	data := fs.String("data", "", "file holding the leaf data, instead of -leaf")
+	proofFile := fs.String("proof", "", "proof file written by prove")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if *rootHex == "" || *proofFile == "" || (*leafHex == "") == (*data == "") || fs.NArg() != 0 {
+		return nil, errors.New("verify needs -root, -proof and one of -leaf and -data")
+	}
+	want, err := parseHash(*rootHex)
+	if err != nil {
+		return nil, fmt.Errorf("root: %v", err)
+	}
+	b, err := os.ReadFile(*proofFile)
+	if err != nil {
+		return nil, err
+	}
+	// accept the hex of the JSON output as well
+	if d, err := hex.DecodeString(string(bytes.TrimSpace(b))); err == nil {
+		b = d
+	}
+	e, err := gommr.DecodeEnvelope(b)
+	if err != nil {
+		return nil, err
+	}
+	var leaf gommr.Hash
+	if *data != "" {
+		hash := leafHashes[e.Scheme]
+		if hash == nil {
+			return nil, fmt.Errorf("cannot hash leaves of scheme %q, use -leaf", e.Scheme)
+		}
+		d, err := os.ReadFile(*data)
+		if err != nil {
+			return nil, err
+		}
+		leaf = hash(gommr.LeafIndexToPos(e.LeafIndex), d)
+	} else if leaf, err = parseHash(*leafHex); err != nil {
+		return nil, fmt.Errorf("leaf: %v", err)
+	}
+	res := verifyOutput{Leaf: e.LeafIndex, LeafHash: leaf.Hex(), Scheme: e.Scheme, Size: e.MmrSize, Root: e.Root.Hex()}
+	if e.Root != want {
+		err = fmt.Errorf("proof is for root %s", e.Root.Hex())
+	} else {
+		err = e.Verify(want, leaf)
+	}
+	if err != nil {
+		res.Error = err.Error()
+		return res, errInvalid
+	}
+	res.Valid = true
+	return res, nil
+}
+
+func parseHash(s string) (gommr.Hash, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return gommr.Hash{}, err
+	}
+	if len(b) != len(gommr.Hash{}) {
+		return gommr.Hash{}, fmt.Errorf("%d bytes, want 32", len(b))
+	}
+	return gommr.BytesToHash(b), nil
+}
+
+type peakOutput struct {
+	Pos    uint64 `json:"pos"`
+	Height int    `json:"height"`
+	Leaves uint64 `json:"leaves"`
+	Hash   string `json:"hash"`
+}
+
+func peaks(l *mmrDir) (interface{}, error) {
+	res := []peakOutput{}
+	if l.mmr.Size() == 0 {
+		return res, nil
+	}
+	for _, pos := range gommr.Peaks(l.mmr.Size()) {
+		h, err := l.mmr.Get(pos)
+		if err != nil {
+			return nil, err
+		}
+		height := gommr.PosHeight(pos)
+		res = append(res, peakOutput{Pos: pos, Height: height, Leaves: 1 << uint(height), Hash: h.Hex()})
+	}
+	return res, nil
+}
+
+type infoOutput struct {
+	Dir       string `json:"dir"`
+	Scheme    string `json:"scheme"`
+	HashCode  string `json:"hash_code"`
+	Size      uint64 `json:"size"`
+	LeafCount uint64 `json:"leaf_count"`
+	Peaks     int    `json:"peaks"`
+	Root      string `json:"root"`
+}
+
+func info(l *mmrDir) (interface{}, error) {
+	r, err := l.mmr.Root()
+	if err != nil {
+		return nil, err
+	}
+	n := 0
+	if l.mmr.Size() != 0 {
+		n = len(gommr.Peaks(l.mmr.Size()))
+	}
+	return infoOutput{
+		Dir:       l.dir,
+		Scheme:    l.scheme.Name,
+		HashCode:  fmt.Sprintf("0x%x", l.scheme.HashCode),
+		Size:      l.mmr.Size(),
+		LeafCount: l.mmr.LeafCount(),
+		Peaks:     n,
+		Root:      r.Hex(),
+	}, nil
+}
+
+type checkOutput struct {
+	Size     uint64   `json:"size"`
+	Leaves   uint64   `json:"leaves"`
+	Corrupt  []uint64 `json:"corrupt"`
+	Suspect  []uint64 `json:"suspect_leaves"`
+	Repaired bool     `json:"repaired"`
+	Root     string   `json:"root"`
+}
+
+var errCorrupt = errors.New("corrupt nodes found")
+
+func check(dir string, args []string) (_ interface{}, err error) {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	repair := fs.Bool("repair", false, "rebuild corrupt inner nodes from the leaves")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	l, err := openDir(dir, "", false)
+	if err != nil {
+		return nil, err
+	}
+	defer l.closeInto(&err)
+	var r *gommr.CheckReport
+	if *repair {
+		r, err = l.mmr.Rebuild()
+	} else {
+		r, err = l.mmr.Check()
+	}
+	if r == nil {
+		return nil, err
+	}
+	// a refused rebuild still reports what it found
+	failed := err
+	root, err := l.mmr.Root()
+	if err != nil {
+		return nil, err
+	}
+	res := checkOutput{
+		Size:     r.Size,
+		Leaves:   r.Leaves,
+		Corrupt:  append([]uint64{}, r.Corrupt...),
+		Suspect:  append([]uint64{}, r.Suspect...),
+		Repaired: *repair && failed == nil && !r.OK(),
+		Root:     root.Hex(),
+	}
+	if failed != nil {
+		return res, failed
+	}
+	if !r.OK() && !*repair {
+		return res, errCorrupt
+	}
+	return res, nil
+}
+
+func serve(dir, scheme string, args []string) (err error) {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	l, err := openDir(dir, scheme, true)
+	if err != nil {
+		return err
+	}
+	defer l.closeInto(&err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	srv := &http.Server{Addr: *addr, Handler: server.New(l.mmr, server.WithSync(l.store))}
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.ListenAndServe()
+	}()
+	fmt.Fprintf(os.Stderr, "gommr: serving %s (%s) on %s\n", dir, l.scheme.Name, *addr)
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+	// let pending appends finish before the store is closed
+	fmt.Fprintln(os.Stderr, "gommr: shutting down")
+	shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return srv.Shutdown(shutdown)
+}
+
+func export(dir string, args []string) (err error) {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	leaves := fs.Bool("leaves", false, "write only the leaves")
+	outFile := fs.String("out", "", "file to write the dump to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	l, err := openDir(dir, "", false)
+	if err != nil {
+		return err
+	}
+	defer l.closeInto(&err)
+	w := io.Writer(os.Stdout)
+	if *outFile != "" {
+		f, err := os.Create(*outFile)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		w = f
+	}
+	if *leaves {
+		return l.mmr.ExportLeaves(w)
+	}
+	return l.mmr.Export(w)
+}
+
+func importDump(dir, scheme string, args []string) (_ interface{}, err error) {
+	if len(args) > 1 {
+		return nil, fmt.Errorf("unexpected arguments %q", args[1:])
+	}
+	r := io.Reader(os.Stdin)
+	if len(args) == 1 {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	l, err := openDir(dir, scheme, true)
+	if err != nil {
+		return nil, err
+	}
+	defer l.closeInto(&err)
+	if err := l.mmr.Import(bufio.NewReader(r)); err != nil {
+		return nil, err
+	}
+	return root(l)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-mmr/gommr"
+	"github.com/go-mmr/gommr/ct"
+	"github.com/go-mmr/gommr/evm"
+	"github.com/go-mmr/gommr/substrate"
+)
+
+func TestRun(t *testing.T) {
+	tmp := t.TempDir()
+	dir, copyDir, evmDir := filepath.Join(tmp, "log"), filepath.Join(tmp, "copy"), filepath.Join(tmp, "evm")
+	file := func(name, content string) string {
+		path := filepath.Join(tmp, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	var lines []string
+	want, _ := gommr.NewMMR(gommr.NewMemStore())
+	for i := 0; i < 11; i++ {
+		lines = append(lines, fmt.Sprintf("entry %d", i))
+		want.Push(gommr.RlpHash([]byte(lines[i])))
+	}
+	entries := file("entries.txt", strings.Join(lines, "\n")+"\n")
+	entry7, other := file("entry7.txt", lines[7]), file("other.txt", "entry 70")
+	root, _ := want.Root()
+	leaf7, forged := gommr.RlpHash([]byte(lines[7])), gommr.Hash{1}
+	proof, dump := filepath.Join(tmp, "leaf7.proof"), filepath.Join(tmp, "log.dump")
+
+	rootIs := func(t *testing.T, out interface{}) {
+		r := out.(rootOutput)
+		if r.Root != root.Hex() || r.LeafCount != 11 || r.Size != want.Size() {
+			t.Fatalf("root %+v, want %s", r, root.Hex())
+		}
+	}
+	writeNode := func(t *testing.T, pos uint64, h gommr.Hash) {
+		f, err := os.OpenFile(filepath.Join(dir, "nodes"), os.O_RDWR, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteAt(h[:], int64(pos)*32); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// corrupt overwrites the inner node at 5, the parent of leaves 2 and 3
+	corrupt := func(t *testing.T) { writeNode(t, 5, gommr.Hash{}) }
+	leaf2 := gommr.RlpHash([]byte(lines[2]))
+	changeLeaf := func(t *testing.T) { writeNode(t, 3, gommr.Hash{}) }
+	restoreLeaf := func(t *testing.T) { writeNode(t, 3, leaf2) }
+	for _, tc := range []struct {
+		name   string
+		before func(t *testing.T)
+		dir    string
+		scheme string
+		cmd    string
+		args   []string
+		err    error
+		check  func(t *testing.T, out interface{})
+	}{
+		{name: "no mmr", dir: dir, cmd: "root", err: errNoMMR},
+		{name: "build", dir: dir, scheme: "rlp", cmd: "build", args: []string{"-lines", entries}, check: func(t *testing.T, out interface{}) {
+			if b := out.(buildOutput); b.Added != 11 {
+				t.Fatalf("added %d leaves", b.Added)
+			}
+			rootIs(t, out.(buildOutput).rootOutput)
+		}},
+		{name: "root", dir: dir, cmd: "root", check: rootIs},
+		{name: "prove", dir: dir, cmd: "prove", args: []string{"-leaf", "7", "-out", proof}, check: func(t *testing.T, out interface{}) {
+			p := out.(proveOutput)
+			if p.Leaf != 7 || p.Scheme != "rlp" || p.Root != root.Hex() || p.LeafHash != leaf7.Hex() {
+				t.Fatalf("proof %+v", p)
+			}
+		}},
+		{name: "prove missing leaf", dir: dir, cmd: "prove", args: []string{"-leaf", "11"}, err: errAny},
+		{name: "verify", cmd: "verify", args: []string{"-root", root.Hex(), "-data", entry7, "-proof", proof}, check: func(t *testing.T, out interface{}) {
+			if v := out.(verifyOutput); !v.Valid || v.Leaf != 7 || v.Size != want.Size() {
+				t.Fatalf("verify %+v", v)
+			}
+		}},
+		{name: "verify other data", cmd: "verify", args: []string{"-root", root.Hex(), "-data", other, "-proof", proof}, err: errInvalid},
+		{name: "verify other root", cmd: "verify", args: []string{"-root", forged.Hex(), "-data", entry7, "-proof", proof}, err: errInvalid},
+		{name: "check", dir: dir, cmd: "check", check: func(t *testing.T, out interface{}) {
+			if c := out.(checkOutput); len(c.Corrupt) != 0 || c.Leaves != 11 || c.Root != root.Hex() {
+				t.Fatalf("check %+v", c)
+			}
+		}},
+		{name: "check corrupt", before: corrupt, dir: dir, cmd: "check", err: errCorrupt, check: func(t *testing.T, out interface{}) {
+			if c := out.(checkOutput); len(c.Corrupt) != 1 || c.Corrupt[0] != 5 {
+				t.Fatalf("check %+v", c)
+			}
+		}},
+		{name: "repair", dir: dir, cmd: "check", args: []string{"-repair"}, check: func(t *testing.T, out interface{}) {
+			if c := out.(checkOutput); !c.Repaired || c.Root != root.Hex() {
+				t.Fatalf("repair %+v", c)
+			}
+		}},
+		{name: "check repaired", dir: dir, cmd: "check", check: func(t *testing.T, out interface{}) {
+			if c := out.(checkOutput); len(c.Corrupt) != 0 {
+				t.Fatalf("check %+v", c)
+			}
+		}},
+		{name: "check changed leaf", before: changeLeaf, dir: dir, cmd: "check", err: errCorrupt, check: func(t *testing.T, out interface{}) {
+			if c := out.(checkOutput); len(c.Corrupt) != 0 || len(c.Suspect) != 2 || c.Suspect[0] != 3 {
+				t.Fatalf("check %+v", c)
+			}
+		}},
+		{name: "repair changed leaf", dir: dir, cmd: "check", args: []string{"-repair"}, err: gommr.ErrSuspectLeaf, check: func(t *testing.T, out interface{}) {
+			if c := out.(checkOutput); c.Repaired || len(c.Suspect) != 2 {
+				t.Fatalf("repair %+v", c)
+			}
+		}},
+		{name: "check restored leaf", before: restoreLeaf, dir: dir, cmd: "check", check: func(t *testing.T, out interface{}) {
+			if c := out.(checkOutput); len(c.Corrupt) != 0 || len(c.Suspect) != 0 || c.Root != root.Hex() {
+				t.Fatalf("check %+v", c)
+			}
+		}},
+		{name: "export", dir: dir, cmd: "export", args: []string{"-out", dump}},
+		{name: "import", dir: copyDir, scheme: "rlp", cmd: "import", args: []string{dump}, check: rootIs},
+		{name: "copy", dir: copyDir, cmd: "root", check: rootIs},
+		{name: "import into a full mmr", dir: copyDir, scheme: "rlp", cmd: "import", args: []string{dump}, err: gommr.ErrNotEmpty},
+		{name: "import of another scheme", dir: evmDir, scheme: "evm", cmd: "import", args: []string{dump}, err: gommr.ErrDumpScheme},
+		{name: "unknown command", dir: dir, cmd: "grow", err: errAny},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.before != nil {
+				tc.before(t)
+			}
+			out, err := run(tc.dir, tc.scheme, tc.cmd, tc.args)
+			if tc.err == errAny && err == nil || tc.err != errAny && err != tc.err {
+				t.Fatalf("error %v, want %v", err, tc.err)
+			}
+			if tc.check != nil {
+				tc.check(t, out)
+			}
+		})
+	}
+}
+
+// TestSchemeDumps imports dumps of the mmrs of the scheme packages by the
+// name of their scheme.
+func TestSchemeDumps(t *testing.T) {
+	for _, tc := range []struct {
+		scheme string
+		open   func(gommr.Store) (*gommr.MMR, error)
+	}{
+		{"evm", evm.NewMMR},
+		{"substrate", substrate.NewMMR},
+		{"rfc9162", func(s gommr.Store) (*gommr.MMR, error) {
+			tree, err := ct.NewTree(s)
+			if err != nil {
+				return nil, err
+			}
+			return tree.MMR(), nil
+		}},
+	} {
+		t.Run(tc.scheme, func(t *testing.T) {
+			tmp := t.TempDir()
+			m, err := tc.open(gommr.NewMemStore())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 11; i++ {
+				m.Push(gommr.RlpHash(uint64(i)))
+			}
+			root, _ := m.Root()
+			dump := filepath.Join(tmp, "dump")
+			f, err := os.Create(dump)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := m.Export(f); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+			out, err := run(filepath.Join(tmp, "log"), tc.scheme, "import", []string{dump})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r := out.(rootOutput); r.Root != root.Hex() || r.LeafCount != 11 {
+				t.Fatalf("imported %+v, want %s", r, root.Hex())
+			}
+		})
+	}
+}
+
+// errAny stands for an error without a value of its own.
+var errAny = errors.New("any error")
@@ -0,0 +1,160 @@
+package gommr
+
+// ConsistencyProof proves that the mmr of OldSize nodes is a prefix of the
+// mmr of NewSize nodes. OldPeaks are the peaks of the old mmr. Items are,
+// for every new peak from left to right, either the right siblings on the
+// way up from the last old peak below it, or the new peak itself if no
+// old peak is below it.
+type ConsistencyProof struct {
+	OldSize  uint64
+	NewSize  uint64
+	OldPeaks []Hash
+	Items    []Hash
+}
+
+func (m *mmr) gen_consistency_proof(oldSize uint64) (*ConsistencyProof, error) {
+	if oldSize > m.cur_size || oldSize != 0 && !ValidSize(oldSize) {
+		return nil, ErrBadSize
+	}
+	p := &ConsistencyProof{OldSize: oldSize, NewSize: m.cur_size}
+	var old []uint64
+	if oldSize != 0 {
+		old = get_peaks(oldSize)
+	}
+	for _, pos := range old {
+		h, err := m.get(pos)
+		if err != nil {
+			return nil, err
+		}
+		p.OldPeaks = append(p.OldPeaks, h)
+	}
+	if m.cur_size == 0 {
+		return p, nil
+	}
+	i := 0
+	for _, peak := range get_peaks(m.cur_size) {
+		n := i
+		for n < len(old) && old[n] <= peak {
+			n++
+		}
+		if n == i {
+			h, err := m.get(peak)
+			if err != nil {
+				return nil, err
+			}
+			p.Items = append(p.Items, h)
+			continue
+		}
+		pos, height := old[n-1], pos_height_in_tree(old[n-1])
+		for pos < peak {
+			sib_pos, parent_pos := sibling_and_parent(pos, height)
+			if sib_pos > pos {
+				h, err := m.get(sib_pos)
+				if err != nil {
+					return nil, err
+				}
+				p.Items = append(p.Items, h)
+			}
+			pos, height = parent_pos, height+1
+		}
+		i = n
+	}
+	return p, nil
+}
+
+// newPeaks recomputes the peaks of the new mmr from the old peaks and the
+// proof items.
+func (p *ConsistencyProof) newPeaks(merger Merger) ([]Hash, error) {
+	if p.OldSize > p.NewSize || p.NewSize == 0 || !ValidSize(p.NewSize) || p.OldSize != 0 && !ValidSize(p.OldSize) {
+		return nil, ErrBadSize
+	}
+	var old []uint64
+	if p.OldSize != 0 {
+		old = get_peaks(p.OldSize)
+	}
+	if len(old) != len(p.OldPeaks) {
+		return nil, ErrCorruptedProof
+	}
+	items := p.Items
+	next := func() (Hash, bool) {
+		if len(items) == 0 {
+			return Hash{}, false
+		}
+		h := items[0]
+		items = items[1:]
+		return h, true
+	}
+	peaks := make([]Hash, 0)
+	i := 0
+	for _, peak := range get_peaks(p.NewSize) {
+		n := i
+		for n < len(old) && old[n] <= peak {
+			n++
+		}
+		if n == i {
+			h, ok := next()
+			if !ok {
+				return nil, ErrCorruptedProof
+			}
+			peaks = append(peaks, h)
+			continue
+		}
+		// climb from the last old peak, the left siblings are the old
+		// peaks before it
+		j := n - 1
+		pos, height, h := old[j], pos_height_in_tree(old[j]), p.OldPeaks[j]
+		for pos < peak {
+			sib_pos, parent_pos := sibling_and_parent(pos, height)
+			if sib_pos < pos {
+				j--
+				if j < i || old[j] != sib_pos {
+					return nil, ErrCorruptedProof
+				}
+				h = merger.Merge(parent_pos, p.OldPeaks[j], h)
+			} else {
+				sib, ok := next()
+				if !ok {
+					return nil, ErrCorruptedProof
+				}
+				h = merger.Merge(parent_pos, h, sib)
+			}
+			pos, height = parent_pos, height+1
+		}
+		if pos != peak || j != i {
+			return nil, ErrCorruptedProof
+		}
+		peaks = append(peaks, h)
+		i = n
+	}
+	if i != len(old) || len(items) != 0 {
+		return nil, ErrCorruptedProof
+	}
+	return peaks, nil
+}
+
+// Verify reports whether the old peaks bag into oldRoot and, extended by
+// the proof items, into newRoot. An empty old mmr is consistent with
+// every new one.
+func (p *ConsistencyProof) Verify(merger Merger, oldRoot, newRoot Hash) bool {
+	peaks, err := p.newPeaks(merger)
+	if err != nil {
+		return false
+	}
+	if p.OldSize != 0 && bag_hashes(merger, p.OldSize, p.OldPeaks) != oldRoot {
+		return false
+	}
+	return bag_hashes(merger, p.NewSize, peaks) == newRoot
+}
+
+// GenConsistencyProof proves that the earlier mmr of oldSize nodes is a
+// prefix of the mmr of newSize nodes.
+func (m *MMR) GenConsistencyProof(oldSize, newSize uint64) (*ConsistencyProof, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	if newSize > m.m.cur_size || newSize != 0 && !ValidSize(newSize) {
+		return nil, ErrBadSize
+	}
+	view := *m.m
+	view.cur_size = newSize
+	return view.gen_consistency_proof(oldSize)
+}
@@ -0,0 +1,59 @@
+package gommr
+
+import "testing"
+
+func TestConsistencyProof(t *testing.T) {
+	const count = 40
+	roots := make([]Hash, count+1)
+	m, _ := NewMMR(NewMemStore())
+	for i := 0; i <= count; i++ {
+		roots[i], _ = m.Root()
+		m.Push(leafHash(i))
+	}
+	for oldCount := uint64(0); oldCount <= count; oldCount++ {
+		for newCount := oldCount; newCount <= count; newCount++ {
+			if newCount == 0 {
+				continue
+			}
+			oldSize, newSize := LeafCountToSize(oldCount), LeafCountToSize(newCount)
+			p, err := m.GenConsistencyProof(oldSize, newSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !p.Verify(DefaultMerger, roots[oldCount], roots[newCount]) {
+				t.Fatalf("%d to %d leaves: proof failed", oldCount, newCount)
+			}
+			if newCount < count && p.Verify(DefaultMerger, roots[oldCount], roots[newCount+1]) {
+				t.Fatalf("%d to %d leaves: proof accepted a later root", oldCount, newCount)
+			}
+			for i := range p.Items {
+				p.Items[i][0] ^= 1
+				if p.Verify(DefaultMerger, roots[oldCount], roots[newCount]) {
+					t.Fatalf("%d to %d leaves: tampered item %d accepted", oldCount, newCount, i)
+				}
+				p.Items[i][0] ^= 1
+			}
+			if oldCount > 0 && p.Verify(DefaultMerger, roots[oldCount-1], roots[newCount]) {
+				t.Fatalf("%d to %d leaves: proof accepted an earlier old root", oldCount, newCount)
+			}
+		}
+	}
+
+	// a log that rewrote a leaf is not consistent with its earlier root
+	forked := buildMMR(t, NewMemStore(), 7)
+	forked.Push(Hash{1})
+	for i := 8; i < 20; i++ {
+		forked.Push(leafHash(i))
+	}
+	p, _ := forked.GenConsistencyProof(LeafCountToSize(9), LeafCountToSize(20))
+	newRoot, _ := forked.Root()
+	if p.Verify(DefaultMerger, roots[9], newRoot) {
+		t.Fatal("forked log accepted")
+	}
+	if _, err := m.GenConsistencyProof(LeafCountToSize(10), LeafCountToSize(9)); err != ErrBadSize {
+		t.Fatalf("shrinking proof: %v", err)
+	}
+	if _, err := m.GenConsistencyProof(5, LeafCountToSize(9)); err != ErrBadSize {
+		t.Fatalf("proof from an invalid size: %v", err)
+	}
+}
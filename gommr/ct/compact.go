@@ -0,0 +1,106 @@
+package ct
+
+import (
+	"math/bits"
+
+	"github.com/go-mmr/gommr"
+)
+
+// Range is a compact range: the roots of the perfect subtrees covering the
+// leaves [Begin, End), largest possible, from left to right. For a range
+// starting at 0 these are the mmr peaks.
+type Range struct {
+	begin, end uint64
+	hashes     []gommr.Hash
+}
+
+// NewRange returns an empty range at begin.
+func NewRange(begin uint64) *Range {
+	return &Range{begin: begin, end: begin}
+}
+
+// rangeSizes returns the sizes of the subtrees covering [begin, end).
+func rangeSizes(begin, end uint64) []uint64 {
+	sizes := make([]uint64, 0, 0)
+	for begin < end {
+		size := uint64(1) << uint64(bits.Len64(end-begin)-1)
+		if begin != 0 {
+			if low := begin & -begin; low < size {
+				size = low
+			}
+		}
+		sizes = append(sizes, size)
+		begin += size
+	}
+	return sizes
+}
+
+// Begin returns the first leaf index of the range.
+func (r *Range) Begin() uint64 { return r.begin }
+
+// End returns the leaf index after the range.
+func (r *Range) End() uint64 { return r.end }
+
+// Hashes returns the subtree roots.
+func (r *Range) Hashes() []gommr.Hash { return r.hashes }
+
+// push appends the root of a subtree of size leaves at End, which has to
+// keep the subtrees aligned, and merges the subtrees that became siblings.
+func (r *Range) push(hash gommr.Hash, size uint64) {
+	r.hashes = append(r.hashes, hash)
+	r.end += size
+	for want := len(rangeSizes(r.begin, r.end)); len(r.hashes) > want; {
+		last := len(r.hashes) - 1
+		r.hashes[last-1] = NodeHash(r.hashes[last-1], r.hashes[last])
+		r.hashes = r.hashes[:last]
+	}
+}
+
+// Append adds a leaf hash.
+func (r *Range) Append(leaf gommr.Hash) {
+	r.push(leaf, 1)
+}
+
+// AppendRange extends r with the adjacent range other.
+func (r *Range) AppendRange(other *Range) error {
+	if other.begin != r.end {
+		return ErrAdjacent
+	}
+	for i, size := range rangeSizes(other.begin, other.end) {
+		r.push(other.hashes[i], size)
+	}
+	return nil
+}
+
+// Root returns the tree head of a range starting at 0, bagging the subtree
+// roots from right to left.
+func (r *Range) Root() (gommr.Hash, error) {
+	if r.begin != 0 {
+		return gommr.Hash{}, ErrRangeBegin
+	}
+	if len(r.hashes) == 0 {
+		return EmptyRoot, nil
+	}
+	root := r.hashes[len(r.hashes)-1]
+	for i := len(r.hashes) - 2; i >= 0; i-- {
+		root = NodeHash(r.hashes[i], root)
+	}
+	return root, nil
+}
+
+// Range returns the compact range [begin, end) of the tree.
+func (t *Tree) Range(begin, end uint64) (*Range, error) {
+	if begin > end || end > t.Size() {
+		return nil, ErrSize
+	}
+	r := NewRange(begin)
+	for _, size := range rangeSizes(begin, end) {
+		h, err := t.subtree(r.end, r.end+size)
+		if err != nil {
+			return nil, err
+		}
+		r.hashes = append(r.hashes, h)
+		r.end += size
+	}
+	return r, nil
+}
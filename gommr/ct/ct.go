@@ -0,0 +1,312 @@
+// Package ct computes RFC 9162 (Certificate Transparency 2.0) tree heads,
+// audit paths and consistency proofs over a gommr store. The perfect
+// subtrees of a CT tree are the mountains of an mmr of its leaf hashes,
+// and bagging the peaks from right to left with the node hash gives the
+// CT root, so the nodes live in any gommr.Store.
+package ct
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/bits"
+
+	"github.com/go-mmr/gommr"
+)
+
+var (
+	ErrSize       = errors.New("ct: tree size out of range")
+	ErrLeafIndex  = errors.New("ct: leaf index out of range")
+	ErrProofSize  = errors.New("ct: wrong proof size")
+	ErrRoot       = errors.New("ct: root mismatch")
+	ErrRangeBegin = errors.New("ct: root of a range not starting at 0")
+	ErrAdjacent   = errors.New("ct: ranges are not adjacent")
+)
+
+// LeafHash is MTH of a single entry, SHA-256(0x00 || data).
+func LeafHash(data []byte) gommr.Hash {
+	return sha256.Sum256(append([]byte{0}, data...))
+}
+
+// NodeHash is SHA-256(0x01 || left || right).
+func NodeHash(left, right gommr.Hash) gommr.Hash {
+	var b [65]byte
+	b[0] = 1
+	copy(b[1:], left[:])
+	copy(b[33:], right[:])
+	return sha256.Sum256(b[:])
+}
+
+// EmptyRoot is the root of the empty tree, SHA-256 of no data.
+var EmptyRoot gommr.Hash = sha256.Sum256(nil)
+
+type merger struct{}
+
+func (merger) Merge(pos uint64, left, right gommr.Hash) gommr.Hash {
+	return NodeHash(left, right)
+}
+
+// BagPeaks makes each peak the left child of the bag to its right, the
+// split of a CT tree at the largest power of two.
+func (merger) BagPeaks(mmrSize uint64, left, right gommr.Hash) gommr.Hash {
+	return NodeHash(left, right)
+}
+
+// Merger hashes mmr nodes and peaks like CT interior nodes.
+var Merger gommr.Merger = merger{}
+
+func init() {
+	gommr.RegisterScheme(gommr.Scheme{Name: "rfc9162", HashCode: gommr.Sha2_256, Merger: Merger})
+}
+
+// Tree is a CT log tree over a gommr mmr of leaf hashes.
+type Tree struct {
+	m *gommr.MMR
+}
+
+// NewTree opens a tree on store, continuing at the size of the store.
+func NewTree(store gommr.Store) (*Tree, error) {
+	m, err := gommr.NewMMR(store, gommr.WithScheme("rfc9162"))
+	if err != nil {
+		return nil, err
+	}
+	return &Tree{m: m}, nil
+}
+
+// MMR returns the underlying mmr.
+func (t *Tree) MMR() *gommr.MMR {
+	return t.m
+}
+
+// Append adds an entry and returns its leaf index.
+func (t *Tree) Append(data []byte) (uint64, error) {
+	return t.AppendHash(LeafHash(data))
+}
+
+// AppendHash adds a leaf hash and returns its leaf index.
+func (t *Tree) AppendHash(leaf gommr.Hash) (uint64, error) {
+	return t.m.Append(leaf)
+}
+
+// Size returns the number of leaves.
+func (t *Tree) Size() uint64 {
+	return t.m.LeafCount()
+}
+
+// Root returns the current tree head.
+func (t *Tree) Root() (gommr.Hash, error) {
+	return t.RootAt(t.Size())
+}
+
+// RootAt returns the tree head the tree had at size leaves.
+func (t *Tree) RootAt(size uint64) (gommr.Hash, error) {
+	if size > t.Size() {
+		return gommr.Hash{}, ErrSize
+	}
+	r, err := t.Range(0, size)
+	if err != nil {
+		return gommr.Hash{}, err
+	}
+	return r.Root()
+}
+
+// split returns the largest power of two smaller than n, n > 1.
+func split(n uint64) uint64 {
+	return uint64(1) << uint64(bits.Len64(n-1)-1)
+}
+
+// subtree returns MTH(D[begin:end]) for a range that is a node of the tree
+// of size end: begin is a multiple of the largest power of two below
+// end-begin, or end-begin is a power of two aligned at begin.
+func (t *Tree) subtree(begin, end uint64) (gommr.Hash, error) {
+	n := end - begin
+	if n&(n-1) == 0 {
+		height := bits.TrailingZeros64(n)
+		return t.m.Get(gommr.LeafIndexToPos(begin) + (uint64(2) << uint64(height)) - 2)
+	}
+	k := split(n)
+	left, err := t.subtree(begin, begin+k)
+	if err != nil {
+		return gommr.Hash{}, err
+	}
+	right, err := t.subtree(begin+k, end)
+	if err != nil {
+		return gommr.Hash{}, err
+	}
+	return NodeHash(left, right), nil
+}
+
+// InclusionProof returns the audit path PATH(index, D[0:size]), from the
+// leaf up.
+func (t *Tree) InclusionProof(index, size uint64) ([]gommr.Hash, error) {
+	if size > t.Size() {
+		return nil, ErrSize
+	}
+	if index >= size {
+		return nil, ErrLeafIndex
+	}
+	return t.path(index, 0, size)
+}
+
+func (t *Tree) path(m, begin, end uint64) ([]gommr.Hash, error) {
+	if end-begin <= 1 {
+		return nil, nil
+	}
+	k := split(end - begin)
+	var (
+		proof   []gommr.Hash
+		sibling gommr.Hash
+		err     error
+	)
+	if m < k {
+		if proof, err = t.path(m, begin, begin+k); err == nil {
+			sibling, err = t.subtree(begin+k, end)
+		}
+	} else {
+		if proof, err = t.path(m-k, begin+k, end); err == nil {
+			sibling, err = t.subtree(begin, begin+k)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(proof, sibling), nil
+}
+
+// ConsistencyProof returns PROOF(size1, D[0:size2]).
+func (t *Tree) ConsistencyProof(size1, size2 uint64) ([]gommr.Hash, error) {
+	if size2 > t.Size() || size1 > size2 {
+		return nil, ErrSize
+	}
+	if size1 == 0 || size1 == size2 {
+		return nil, nil
+	}
+	return t.subproof(size1, 0, size2, true)
+}
+
+func (t *Tree) subproof(m, begin, end uint64, complete bool) ([]gommr.Hash, error) {
+	n := end - begin
+	if m == n {
+		if complete {
+			return nil, nil
+		}
+		h, err := t.subtree(begin, end)
+		if err != nil {
+			return nil, err
+		}
+		return []gommr.Hash{h}, nil
+	}
+	k := split(n)
+	var (
+		proof   []gommr.Hash
+		sibling gommr.Hash
+		err     error
+	)
+	if m <= k {
+		if proof, err = t.subproof(m, begin, begin+k, complete); err == nil {
+			sibling, err = t.subtree(begin+k, end)
+		}
+	} else {
+		if proof, err = t.subproof(m-k, begin+k, end, false); err == nil {
+			sibling, err = t.subtree(begin, begin+k)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(proof, sibling), nil
+}
+
+// VerifyInclusion checks an audit path with the algorithm of RFC 9162
+// section 2.1.3.2.
+func VerifyInclusion(index, size uint64, leaf gommr.Hash, proof []gommr.Hash, root gommr.Hash) error {
+	if index >= size {
+		return ErrLeafIndex
+	}
+	fn, sn := index, size-1
+	r := leaf
+	for _, p := range proof {
+		if sn == 0 {
+			return ErrProofSize
+		}
+		if fn&1 == 1 || fn == sn {
+			r = NodeHash(p, r)
+			if fn&1 == 0 {
+				for fn&1 == 0 && fn != 0 {
+					fn >>= 1
+					sn >>= 1
+				}
+			}
+		} else {
+			r = NodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return ErrProofSize
+	}
+	if r != root {
+		return ErrRoot
+	}
+	return nil
+}
+
+// VerifyConsistency checks a consistency proof with the algorithm of
+// RFC 9162 section 2.1.4.2.
+func VerifyConsistency(size1, size2 uint64, proof []gommr.Hash, root1, root2 gommr.Hash) error {
+	switch {
+	case size1 > size2:
+		return ErrSize
+	case size1 == size2:
+		if len(proof) != 0 {
+			return ErrProofSize
+		}
+		if root1 != root2 {
+			return ErrRoot
+		}
+		return nil
+	case size1 == 0:
+		if len(proof) != 0 {
+			return ErrProofSize
+		}
+		return nil
+	}
+	if len(proof) == 0 {
+		return ErrProofSize
+	}
+	if size1&(size1-1) == 0 {
+		proof = append([]gommr.Hash{root1}, proof...)
+	}
+	fn, sn := size1-1, size2-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return ErrProofSize
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = NodeHash(c, fr)
+			sr = NodeHash(c, sr)
+			if fn&1 == 0 {
+				for fn&1 == 0 && fn != 0 {
+					fn >>= 1
+					sn >>= 1
+				}
+			}
+		} else {
+			sr = NodeHash(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return ErrProofSize
+	}
+	if fr != root1 || sr != root2 {
+		return ErrRoot
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package ct
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/go-mmr/gommr"
+)
+
+// The reference tree of certificate-transparency-go's merkle tests.
+var leaves = []string{
+	"",
+	"00",
+	"10",
+	"2021",
+	"3031",
+	"40414243",
+	"5051525354555657",
+	"606162636465666768696a6b6c6d6e6f",
+}
+
+var roots = []string{
+	"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+	"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+	"aeb6bcfe274b70a14fb067a5e5578264db0fa9b51af5e0ba159158f329e06e77",
+	"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+	"4e3bbb1f7b478dcfe71fb631631519a3bca12c9aefca1612bfce4c13a86264d4",
+	"76e67dadbcdf1e10e1b74ddc608abd2f98dfb16fbce75277b5232a127f2087ef",
+	"ddb89be403809e325750d3d263cd78929c2942b7942a34b77e122c9594a74c8c",
+	"5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328",
+}
+
+var inclusionProofs = []struct {
+	index, size uint64
+	proof       []string
+}{
+	{0, 1, nil},
+	{0, 8, []string{
+		"96a296d224f285c67bee93c30f8a309157f0daa35dc5b87e410b78630a09cfc7",
+		"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+		"6b47aaf29ee3c2af9af889bc1fb9254dabd31177f16232dd6aab035ca39bf6e4",
+	}},
+	{5, 8, []string{
+		"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b",
+		"ca854ea128ed050b41b35ffc1b87b8eb2bde461e9e3b5596ece6b9d5975a0ae0",
+		"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+	}},
+	{2, 3, []string{
+		"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+	}},
+	{1, 5, []string{
+		"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+		"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+		"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b",
+	}},
+}
+
+var consistencyProofs = []struct {
+	size1, size2 uint64
+	proof        []string
+}{
+	{1, 1, nil},
+	{1, 8, []string{
+		"96a296d224f285c67bee93c30f8a309157f0daa35dc5b87e410b78630a09cfc7",
+		"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+		"6b47aaf29ee3c2af9af889bc1fb9254dabd31177f16232dd6aab035ca39bf6e4",
+	}},
+	{6, 8, []string{
+		"0ebc5d3437fbe2db158b9f126a1d118e308181031d0a949f8dededebc558ef6a",
+		"ca854ea128ed050b41b35ffc1b87b8eb2bde461e9e3b5596ece6b9d5975a0ae0",
+		"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+	}},
+	{2, 5, []string{
+		"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+		"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b",
+	}},
+}
+
+func hexHash(t *testing.T, s string) gommr.Hash {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gommr.BytesToHash(b)
+}
+
+func hexHashes(t *testing.T, ss []string) []gommr.Hash {
+	var hs []gommr.Hash
+	for _, s := range ss {
+		hs = append(hs, hexHash(t, s))
+	}
+	return hs
+}
+
+func referenceTree(t *testing.T) *Tree {
+	tree, err := NewTree(gommr.NewMemStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range leaves {
+		data, _ := hex.DecodeString(l)
+		if _, err := tree.Append(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tree
+}
+
+func TestRoots(t *testing.T) {
+	tree := referenceTree(t)
+	if root, _ := tree.RootAt(0); root != hexHash(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855") {
+		t.Fatalf("empty root %x", root)
+	}
+	for i, want := range roots {
+		root, err := tree.RootAt(uint64(i + 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if root != hexHash(t, want) {
+			t.Fatalf("root of size %d: %x, want %s", i+1, root, want)
+		}
+	}
+	// the mmr bags its peaks into the same root
+	if root, _ := tree.MMR().Root(); root != hexHash(t, roots[7]) {
+		t.Fatalf("mmr root %x", root)
+	}
+}
+
+func TestReferenceProofs(t *testing.T) {
+	tree := referenceTree(t)
+	for _, c := range inclusionProofs {
+		proof, err := tree.InclusionProof(c.index, c.size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := hexHashes(t, c.proof)
+		if len(proof) != len(want) {
+			t.Fatalf("path %d/%d has %d hashes, want %d", c.index, c.size, len(proof), len(want))
+		}
+		for i := range want {
+			if proof[i] != want[i] {
+				t.Fatalf("path %d/%d differs at %d", c.index, c.size, i)
+			}
+		}
+		data, _ := hex.DecodeString(leaves[c.index])
+		if err := VerifyInclusion(c.index, c.size, LeafHash(data), want, hexHash(t, roots[c.size-1])); err != nil {
+			t.Fatalf("path %d/%d: %v", c.index, c.size, err)
+		}
+	}
+	for _, c := range consistencyProofs {
+		proof, err := tree.ConsistencyProof(c.size1, c.size2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := hexHashes(t, c.proof)
+		if len(proof) != len(want) {
+			t.Fatalf("consistency %d/%d has %d hashes, want %d", c.size1, c.size2, len(proof), len(want))
+		}
+		for i := range want {
+			if proof[i] != want[i] {
+				t.Fatalf("consistency %d/%d differs at %d", c.size1, c.size2, i)
+			}
+		}
+		if err := VerifyConsistency(c.size1, c.size2, want, hexHash(t, roots[c.size1-1]), hexHash(t, roots[c.size2-1])); err != nil {
+			t.Fatalf("consistency %d/%d: %v", c.size1, c.size2, err)
+		}
+	}
+}
+
+func TestAllProofs(t *testing.T) {
+	tree, _ := NewTree(gommr.NewMemStore())
+	for i := 0; i < 40; i++ {
+		tree.Append([]byte{byte(i)})
+	}
+	for size := uint64(1); size <= 40; size++ {
+		root, _ := tree.RootAt(size)
+		for index := uint64(0); index < size; index++ {
+			proof, err := tree.InclusionProof(index, size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			leaf := LeafHash([]byte{byte(index)})
+			if err := VerifyInclusion(index, size, leaf, proof, root); err != nil {
+				t.Fatalf("path %d/%d: %v", index, size, err)
+			}
+			if VerifyInclusion(index, size, LeafHash(nil), proof, root) != ErrRoot {
+				t.Fatalf("path %d/%d accepted a wrong leaf", index, size)
+			}
+			if len(proof) > 0 && VerifyInclusion(index, size, leaf, proof[1:], root) == nil {
+				t.Fatalf("short path %d/%d accepted", index, size)
+			}
+		}
+		for size1 := uint64(0); size1 <= size; size1++ {
+			root1, _ := tree.RootAt(size1)
+			proof, err := tree.ConsistencyProof(size1, size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifyConsistency(size1, size, proof, root1, root); err != nil {
+				t.Fatalf("consistency %d/%d: %v", size1, size, err)
+			}
+			if size1 > 0 && size1 < size && VerifyConsistency(size1, size, proof, root, root) == nil {
+				t.Fatalf("consistency %d/%d accepted a wrong root", size1, size)
+			}
+		}
+	}
+}
+
+func TestCompactRange(t *testing.T) {
+	tree, _ := NewTree(gommr.NewMemStore())
+	for i := 0; i < 50; i++ {
+		tree.Append([]byte{byte(i)})
+	}
+	for mid := uint64(0); mid <= 50; mid++ {
+		left, err := tree.Range(0, mid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		right := NewRange(mid)
+		for i := mid; i < 50; i++ {
+			right.Append(LeafHash([]byte{byte(i)}))
+		}
+		direct, _ := tree.Range(mid, 50)
+		if len(direct.Hashes()) != len(right.Hashes()) {
+			t.Fatalf("range %d..50 has %d hashes, want %d", mid, len(right.Hashes()), len(direct.Hashes()))
+		}
+		for i := range direct.Hashes() {
+			if direct.Hashes()[i] != right.Hashes()[i] {
+				t.Fatalf("range %d..50 differs at %d", mid, i)
+			}
+		}
+		if err := left.AppendRange(right); err != nil {
+			t.Fatal(err)
+		}
+		got, _ := left.Root()
+		want, _ := tree.Root()
+		if got != want {
+			t.Fatalf("merged at %d: root %x, want %x", mid, got, want)
+		}
+	}
+	if _, err := NewRange(3).Root(); err != ErrRangeBegin {
+		t.Fatalf("root of a range at 3: %v", err)
+	}
+	if NewRange(0).AppendRange(NewRange(1)) != ErrAdjacent {
+		t.Fatal("gap between ranges accepted")
+	}
+}
@@ -0,0 +1,177 @@
+package gommr
+
+import (
+	"bufio"
+	"errors"
+	"io"
+
+	"github.com/go-mmr/gommr/rlp"
+)
+
+var (
+	ErrBadDump    = errors.New("gommr: malformed dump")
+	ErrDumpRoot   = errors.New("gommr: dump root does not match its nodes")
+	ErrNotEmpty   = errors.New("gommr: import into a non-empty mmr")
+	ErrDumpScheme = errors.New("gommr: dump of another scheme")
+)
+
+// DumpVersion is the dump format written by Export.
+const DumpVersion = 1
+
+// A dump is a stream of rlp values: the header, then the hashes of all
+// nodes in position order, or of the leaves only, each a 32 byte string,
+// and last the trailer holding the root.
+type dumpHeader struct {
+	Version    uint64
+	Scheme     string
+	Size       uint64
+	LeavesOnly bool
+}
+
+type dumpTrailer struct {
+	Root Hash
+}
+
+// importBatch is the number of nodes after which an import appends, at the
+// next leaf.
+const importBatch = 256
+
+// Export writes all nodes of the mmr to w.
+func (m *MMR) Export(w io.Writer) error {
+	return m.export(w, false)
+}
+
+// ExportLeaves writes only the leaves of the mmr to w, an import pushes
+// them again.
+func (m *MMR) ExportLeaves(w io.Writer) error {
+	return m.export(w, true)
+}
+
+func (m *MMR) export(w io.Writer, leavesOnly bool) error {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	root, err := m.m.getRoot()
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	header := dumpHeader{DumpVersion, m.m.scheme, m.m.cur_size, leavesOnly}
+	if err := rlp.Encode(bw, &header); err != nil {
+		return err
+	}
+	for pos := uint64(0); pos < m.m.cur_size; pos++ {
+		if leavesOnly && pos_height_in_tree(pos) != 0 {
+			continue
+		}
+		h, err := m.m.store.Get(pos)
+		if err != nil {
+			return err
+		}
+		if err := rlp.Encode(bw, h[:]); err != nil {
+			return err
+		}
+	}
+	if err := rlp.Encode(bw, &dumpTrailer{root}); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// Import reads a dump written by Export or ExportLeaves into the empty mmr.
+// The dump has to be of the scheme the mmr was opened with. Inner nodes
+// are recomputed and compared to the dumped ones, and the root to the
+// trailer; if any of them differ, the mmr is left empty.
+func (m *MMR) Import(r io.Reader) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.m.cur_size != 0 {
+		return ErrNotEmpty
+	}
+	err := m.m.load(rlp.NewStream(r, 0))
+	if err != nil {
+		if rerr := m.m.rewind(0); rerr != nil {
+			return rerr
+		}
+	}
+	return err
+}
+
+func (m *mmr) load(s *rlp.Stream) error {
+	var header dumpHeader
+	if err := s.Decode(&header); err != nil {
+		return err
+	}
+	if header.Version != DumpVersion || header.Size != 0 && !ValidSize(header.Size) {
+		return ErrBadDump
+	}
+	if header.Scheme != m.scheme {
+		return ErrDumpScheme
+	}
+	next := func() (Hash, error) {
+		if _, size, err := s.Kind(); err != nil {
+			return Hash{}, err
+		} else if size != 32 {
+			return Hash{}, ErrBadDump
+		}
+		b, err := s.Bytes()
+		return BytesToHash(b), err
+	}
+	if header.LeavesOnly {
+		for i := SizeToLeafCount(header.Size); i > 0; i-- {
+			leaf, err := next()
+			if err != nil {
+				return err
+			}
+			if _, err := m.push(&Node{value: leaf}); err != nil {
+				return err
+			}
+		}
+	} else {
+		// the pending subtree roots, as in check
+		stack := make([]Hash, 0, 64)
+		batch := make([]Hash, 0, importBatch+64)
+		for pos := uint64(0); pos < header.Size; pos++ {
+			h, err := next()
+			if err != nil {
+				return err
+			}
+			if pos_height_in_tree(pos) == 0 {
+				stack = append(stack, h)
+			} else {
+				left, right := stack[len(stack)-2], stack[len(stack)-1]
+				if m.merger.Merge(pos, left, right) != h {
+					return ErrDumpRoot
+				}
+				stack = append(stack[:len(stack)-2], h)
+			}
+			batch = append(batch, h)
+			if pos+1 == header.Size || len(batch) >= importBatch && pos_height_in_tree(pos+1) == 0 {
+				if err := m.store.Append(m.cur_size, batch); err != nil {
+					return err
+				}
+				m.cur_size = pos + 1
+				batch = batch[:0]
+			}
+		}
+		if m.history != nil {
+			if err := m.replay_history(); err != nil {
+				return err
+			}
+		}
+	}
+	var trailer dumpTrailer
+	if err := s.Decode(&trailer); err != nil {
+		return err
+	}
+	if _, _, err := s.Kind(); err != io.EOF {
+		return ErrBadDump
+	}
+	root, err := m.getRoot()
+	if err != nil {
+		return err
+	}
+	if root != trailer.Root {
+		return ErrDumpRoot
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package gommr
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	src := buildMMR(t, NewMemStore(), 1000)
+	want, _ := src.Root()
+	var full, leaves bytes.Buffer
+	if err := src.Export(&full); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.ExportLeaves(&leaves); err != nil {
+		t.Fatal(err)
+	}
+	if full.Len() <= leaves.Len() || leaves.Len() < 1000*33 {
+		t.Fatalf("dump sizes %d and %d", full.Len(), leaves.Len())
+	}
+
+	for _, dump := range [][]byte{full.Bytes(), leaves.Bytes()} {
+		h := NewHistory()
+		m, _ := NewMMR(NewMemStore(), WithHistory(h))
+		if err := m.Import(bytes.NewReader(dump)); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := m.Root(); got != want || m.Size() != src.Size() {
+			t.Fatalf("imported root %x, want %x", got, want)
+		}
+		if e, ok := h.ByLeafCount(1000); h.Len() != 1000 || !ok || e.Root != want {
+			t.Fatalf("history of %d roots", h.Len())
+		}
+		if err := m.Import(bytes.NewReader(dump)); err != ErrNotEmpty {
+			t.Fatalf("import into a full mmr: %v", err)
+		}
+	}
+
+	empty, _ := NewMMR(NewMemStore())
+	var dump bytes.Buffer
+	empty.Export(&dump)
+	m, _ := NewMMR(NewMemStore())
+	if err := m.Import(&dump); err != nil || m.Size() != 0 {
+		t.Fatalf("empty dump: %v", err)
+	}
+
+	// the hash at pos starts 33*pos+1 bytes into the nodes, after the
+	// string prefix
+	header := uint64(full.Len()) - src.Size()*33 - 34
+	tamper := func(dump []byte, off uint64) []byte {
+		b := append([]byte{}, dump...)
+		b[off] ^= 1
+		return b
+	}
+	for _, tc := range []struct {
+		name string
+		dump []byte
+		err  error
+	}{
+		{"inner node", tamper(full.Bytes(), header+33*LeafIndexToPos(501)+33+1), ErrDumpRoot},
+		{"leaf", tamper(full.Bytes(), header+33*LeafIndexToPos(500)+1), ErrDumpRoot},
+		{"leaf of leaves", tamper(leaves.Bytes(), uint64(leaves.Len())-34-33*10+1), ErrDumpRoot},
+		{"trailer", tamper(full.Bytes(), uint64(full.Len())-1), ErrDumpRoot},
+		{"trailing data", append(append([]byte{}, full.Bytes()...), 0x80), ErrBadDump},
+	} {
+		m, _ := NewMMR(NewMemStore())
+		if err := m.Import(bytes.NewReader(tc.dump)); err != tc.err || m.Size() != 0 {
+			t.Fatalf("%s: %v, size %d", tc.name, err, m.Size())
+		}
+	}
+	m, _ = NewMMR(NewMemStore())
+	if err := m.Import(bytes.NewReader(full.Bytes()[:full.Len()/2])); err == nil || m.Size() != 0 {
+		t.Fatalf("truncated dump: %v, size %d", err, m.Size())
+	}
+
+	other, _ := NewMMR(NewMemStore(), WithMerger(DefaultMerger))
+	if err := other.Import(bytes.NewReader(full.Bytes())); err != ErrDumpScheme {
+		t.Fatalf("dump of another scheme: %v", err)
+	}
+	if _, err := NewMMR(NewMemStore(), WithScheme("nope")); err != ErrUnknownScheme {
+		t.Fatalf("unknown scheme: %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+package gommr
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+)
+
+var (
+	ErrUnknownScheme = errors.New("gommr: unknown proof scheme")
+	ErrBadEnvelope   = errors.New("gommr: malformed proof envelope")
+	ErrVerify        = errors.New("gommr: proof does not verify")
+)
+
+// Multihash codes of the hash functions used by the registered schemes.
+const (
+	Sha2_256    = 0x12
+	Sha3_256    = 0x16
+	Keccak256   = 0x1b
+	Blake2b_256 = 0xb220
+)
+
+// EnvelopeVersion is the envelope format written by Encode.
+const EnvelopeVersion = 1
+
+// Scheme names a merge and bagging scheme together with the multihash code
+// of the hash function it is built on.
+type Scheme struct {
+	Name     string
+	HashCode uint64
+	Merger   Merger
+}
+
+var (
+	schemesLock sync.RWMutex
+	schemes     = map[string]Scheme{}
+)
+
+// RegisterScheme makes a scheme known to envelopes. Packages providing a
+// merger register it when they are imported, the default merger is
+// registered as "rlp". It panics if the name is taken or s has no merger.
+func RegisterScheme(s Scheme) {
+	schemesLock.Lock()
+	defer schemesLock.Unlock()
+	if s.Merger == nil {
+		panic("gommr: RegisterScheme merger is nil")
+	}
+	if _, dup := schemes[s.Name]; dup {
+		panic("gommr: RegisterScheme called twice for scheme " + s.Name)
+	}
+	schemes[s.Name] = s
+}
+
+// LookupScheme returns the scheme registered under name.
+func LookupScheme(name string) (Scheme, bool) {
+	schemesLock.RLock()
+	defer schemesLock.RUnlock()
+	s, ok := schemes[name]
+	return s, ok
+}
+
+func init() {
+	RegisterScheme(Scheme{Name: "rlp", HashCode: Sha3_256, Merger: DefaultMerger})
+}
+
+// Envelope is a self-describing inclusion proof: besides the proof items
+// it records what it proves and how to check it.
+type Envelope struct {
+	Version   uint8
+	HashCode  uint64
+	Scheme    string
+	LeafIndex uint64
+	MmrSize   uint64
+	Root      Hash
+	Items     []Hash
+}
+
+// NewEnvelope wraps a proof of the leaf at leafIndex under root, generated
+// by an mmr merging with the registered scheme.
+func NewEnvelope(scheme string, leafIndex uint64, root Hash, proof *MerkleProof) (*Envelope, error) {
+	s, ok := LookupScheme(scheme)
+	if !ok {
+		return nil, ErrUnknownScheme
+	}
+	return &Envelope{
+		Version:   EnvelopeVersion,
+		HashCode:  s.HashCode,
+		Scheme:    s.Name,
+		LeafIndex: leafIndex,
+		MmrSize:   proof.MmrSize(),
+		Root:      root,
+		Items:     proof.Proofs(),
+	}, nil
+}
+
+// Verify checks that leaf is at LeafIndex under root, with the merger of
+// the recorded scheme. root must come from a trusted source: the Root of
+// the envelope travels with it and only has to match. Envelopes of another
+// version, an unregistered scheme or a hash code that does not match the
+// scheme are refused.
+func (e *Envelope) Verify(root, leaf Hash) error {
+	if e.Version != EnvelopeVersion {
+		return ErrBadEnvelope
+	}
+	s, ok := LookupScheme(e.Scheme)
+	if !ok || s.HashCode != e.HashCode {
+		return ErrUnknownScheme
+	}
+	if !ValidSize(e.MmrSize) || e.LeafIndex >= SizeToLeafCount(e.MmrSize) {
+		return ErrBadEnvelope
+	}
+	if e.Root != root {
+		return ErrVerify
+	}
+	proof := NewMerkleProof(e.MmrSize, e.Items)
+	if !proof.VerifyWith(s.Merger, root, LeafIndexToPos(e.LeafIndex), leaf) {
+		return ErrVerify
+	}
+	return nil
+}
+
+// Encode serializes the envelope: the version byte, the multihash code,
+// the length prefixed scheme name, the leaf index and mmr size, all
+// unsigned varints, then the root and the varint counted items.
+func (e *Envelope) Encode() []byte {
+	b := make([]byte, 0, 64+len(e.Scheme)+32*len(e.Items))
+	b = append(b, e.Version)
+	b = binary.AppendUvarint(b, e.HashCode)
+	b = binary.AppendUvarint(b, uint64(len(e.Scheme)))
+	b = append(b, e.Scheme...)
+	b = binary.AppendUvarint(b, e.LeafIndex)
+	b = binary.AppendUvarint(b, e.MmrSize)
+	b = append(b, e.Root[:]...)
+	b = binary.AppendUvarint(b, uint64(len(e.Items)))
+	for _, item := range e.Items {
+		b = append(b, item[:]...)
+	}
+	return b
+}
+
+// DecodeEnvelope parses the output of Encode.
+func DecodeEnvelope(b []byte) (*Envelope, error) {
+	if len(b) == 0 {
+		return nil, ErrBadEnvelope
+	}
+	e := &Envelope{Version: b[0]}
+	b = b[1:]
+	uvarint := func() uint64 {
+		if b == nil {
+			return 0
+		}
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			b = nil
+			return 0
+		}
+		b = b[n:]
+		return v
+	}
+	bytes := func(n uint64) []byte {
+		if b == nil || uint64(len(b)) < n {
+			b = nil
+			return nil
+		}
+		data := b[:n]
+		b = b[n:]
+		return data
+	}
+	e.HashCode = uvarint()
+	e.Scheme = string(bytes(uvarint()))
+	e.LeafIndex = uvarint()
+	e.MmrSize = uvarint()
+	copy(e.Root[:], bytes(32))
+	count := uvarint()
+	if b == nil || count > uint64(len(b))/32 {
+		return nil, ErrBadEnvelope
+	}
+	for i := uint64(0); i < count; i++ {
+		e.Items = append(e.Items, BytesToHash(bytes(32)))
+	}
+	if len(b) != 0 {
+		return nil, ErrBadEnvelope
+	}
+	return e, nil
+}
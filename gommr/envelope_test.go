@@ -0,0 +1,114 @@
+package gommr
+
+import (
+	"bytes"
+	"testing"
+)
+
+type swappedMerger struct{}
+
+func (swappedMerger) Merge(pos uint64, left, right Hash) Hash {
+	return merge2(right, left)
+}
+
+func (swappedMerger) BagPeaks(mmrSize uint64, left, right Hash) Hash {
+	return merge2(left, right)
+}
+
+func init() {
+	RegisterScheme(Scheme{Name: "test-swapped", HashCode: Sha3_256, Merger: swappedMerger{}})
+}
+
+func TestRegisterTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("scheme registered twice")
+		}
+		if s, _ := LookupScheme("rlp"); s.Merger != DefaultMerger {
+			t.Fatal("rlp scheme replaced")
+		}
+	}()
+	RegisterScheme(Scheme{Name: "rlp", HashCode: Sha3_256, Merger: swappedMerger{}})
+}
+
+func TestEnvelope(t *testing.T) {
+	for _, scheme := range []string{"rlp", "test-swapped"} {
+		s, _ := LookupScheme(scheme)
+		m, _ := NewMMR(NewMemStore(), WithMerger(s.Merger))
+		for i := 0; i < 19; i++ {
+			m.Push(leafHash(i))
+		}
+		root, _ := m.Root()
+		for i := uint64(0); i < 19; i++ {
+			proof, err := m.GenProof(LeafIndexToPos(i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			e, err := NewEnvelope(scheme, i, root, proof)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d, err := DecodeEnvelope(e.Encode())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(d.Encode(), e.Encode()) {
+				t.Fatal("decoded envelope encodes differently")
+			}
+			if err := d.Verify(root, leafHash(int(i))); err != nil {
+				t.Fatalf("%s: leaf %d: %v", scheme, i, err)
+			}
+			if d.Verify(root, leafHash(int(i)+1)) != ErrVerify {
+				t.Fatalf("%s: wrong leaf %d accepted", scheme, i)
+			}
+		}
+	}
+
+	m := buildMMR(t, NewMemStore(), 5)
+	root, _ := m.Root()
+	proof, _ := m.GenProof(LeafIndexToPos(3))
+	e, _ := NewEnvelope("rlp", 3, root, proof)
+	b := e.Encode()
+	if b[0] != EnvelopeVersion || b[1] != Sha3_256 || b[2] != 3 || string(b[3:6]) != "rlp" || b[6] != 3 || b[7] != 8 {
+		t.Fatalf("envelope header %x", b[:8])
+	}
+	for _, bad := range []func(e *Envelope){
+		func(e *Envelope) { e.Scheme = "unknown" },
+		func(e *Envelope) { e.HashCode = Keccak256 },
+	} {
+		c := *e
+		bad(&c)
+		if c.Verify(root, leafHash(3)) != ErrUnknownScheme {
+			t.Fatalf("envelope of %s/%x accepted", c.Scheme, c.HashCode)
+		}
+	}
+	c := *e
+	c.Version = 2
+	if c.Verify(root, leafHash(3)) != ErrBadEnvelope {
+		t.Fatal("envelope of an unknown version accepted")
+	}
+	c = *e
+	c.LeafIndex = 5
+	if c.Verify(root, leafHash(3)) != ErrBadEnvelope {
+		t.Fatal("leaf index beyond the mmr accepted")
+	}
+	// an envelope over a root of its own proves nothing about root
+	other := buildMMR(t, NewMemStore(), 6)
+	otherRoot, _ := other.Root()
+	otherProof, _ := other.GenProof(LeafIndexToPos(3))
+	forged, _ := NewEnvelope("rlp", 3, otherRoot, otherProof)
+	if forged.Verify(otherRoot, leafHash(3)) != nil || forged.Verify(root, leafHash(3)) != ErrVerify {
+		t.Fatal("envelope verified against its own root")
+	}
+	if _, err := NewEnvelope("unknown", 3, root, proof); err != ErrUnknownScheme {
+		t.Fatalf("envelope for an unknown scheme: %v", err)
+	}
+	for n := 0; n < len(b); n++ {
+		if _, err := DecodeEnvelope(b[:n]); err != ErrBadEnvelope {
+			t.Fatalf("envelope cut at %d decoded", n)
+		}
+	}
+	if _, err := DecodeEnvelope(append(b, 0)); err != ErrBadEnvelope {
+		t.Fatal("envelope with trailing data decoded")
+	}
+}
@@ -0,0 +1,243 @@
+// Package evm is an mmr profile for Solidity verifiers: nodes and peaks are
+// merged with keccak256(abi.encodePacked(left, right)) and proofs are ABI
+// encoded as (bytes32 root, uint256 width, uint256 index, bytes32[] peaks,
+// bytes32[] siblings), where width is the number of leaves and index the
+// leaf index. A contract checks a proof with the steps of Proof.Verify,
+// using only the width and the index to locate the leaf.
+package evm
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+
+	"github.com/go-mmr/gommr"
+	"golang.org/x/crypto/sha3"
+)
+
+var (
+	ErrLeafIndex = errors.New("evm: leaf index out of range")
+	ErrEncoding  = errors.New("evm: malformed abi encoding")
+	ErrPeaks     = errors.New("evm: peaks do not match width or root")
+	ErrSiblings  = errors.New("evm: wrong number of siblings")
+	ErrRoot      = errors.New("evm: leaf does not lead to its peak")
+)
+
+// Keccak256 is the EVM's keccak256 of the concatenation of data.
+func Keccak256(data ...[]byte) gommr.Hash {
+	hw := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		hw.Write(d)
+	}
+	var h gommr.Hash
+	hw.Sum(h[:0])
+	return h
+}
+
+type merger struct{}
+
+func (merger) Merge(pos uint64, left, right gommr.Hash) gommr.Hash {
+	return Keccak256(left[:], right[:])
+}
+
+// BagPeaks makes each peak the left half of the hash with the bag to its
+// right.
+func (merger) BagPeaks(mmrSize uint64, left, right gommr.Hash) gommr.Hash {
+	return Keccak256(left[:], right[:])
+}
+
+// Merger is keccak256(left ++ right) for nodes and peaks.
+var Merger gommr.Merger = merger{}
+
+func init() {
+	gommr.RegisterScheme(gommr.Scheme{Name: "evm", HashCode: gommr.Keccak256, Merger: Merger})
+}
+
+// NewMMR opens an mmr on store with the EVM merger.
+func NewMMR(store gommr.Store) (*gommr.MMR, error) {
+	return gommr.NewMMR(store, gommr.WithScheme("evm"))
+}
+
+// Proof is the decoded form of an ABI encoded proof.
+type Proof struct {
+	Root     gommr.Hash
+	Width    uint64
+	Index    uint64
+	Peaks    []gommr.Hash
+	Siblings []gommr.Hash
+}
+
+// GenerateProof proves the leaf at index against the current root of m.
+// The proof is taken at the width read first, pushes that race with it
+// only add nodes beyond it.
+func GenerateProof(m *gommr.MMR, index uint64) (*Proof, error) {
+	width := m.LeafCount()
+	if index >= width {
+		return nil, ErrLeafIndex
+	}
+	size := gommr.LeafCountToSize(width)
+	root, err := m.RootAt(size)
+	if err != nil {
+		return nil, err
+	}
+	p := &Proof{Root: root, Width: width, Index: index}
+	peaks := gommr.Peaks(size)
+	for _, pos := range peaks {
+		h, err := m.Get(pos)
+		if err != nil {
+			return nil, err
+		}
+		p.Peaks = append(p.Peaks, h)
+	}
+	_, _, height := mountain(width, index)
+	pos := gommr.LeafIndexToPos(index)
+	for h := 0; h < height; h++ {
+		var sib uint64
+		if gommr.PosHeight(pos+1) > h {
+			sib, pos = pos-gommr.SiblingOffset(h), pos+1
+		} else {
+			sib, pos = pos+gommr.SiblingOffset(h), pos+gommr.ParentOffset(h)
+		}
+		hash, err := m.Get(sib)
+		if err != nil {
+			return nil, err
+		}
+		p.Siblings = append(p.Siblings, hash)
+	}
+	return p, nil
+}
+
+// mountain returns the index of the peak above leaf index in an mmr of
+// width leaves, the first leaf under it and its height.
+func mountain(width, index uint64) (peak int, start uint64, height int) {
+	for h := 63; h >= 0; h-- {
+		if width&(1<<uint(h)) == 0 {
+			continue
+		}
+		if index < start+(1<<uint(h)) {
+			return peak, start, h
+		}
+		start += 1 << uint(h)
+		peak++
+	}
+	return -1, 0, 0
+}
+
+// BagPeaks folds the peaks from right to left into the root.
+func BagPeaks(peaks []gommr.Hash) gommr.Hash {
+	if len(peaks) == 0 {
+		return gommr.Hash{}
+	}
+	root := peaks[len(peaks)-1]
+	for i := len(peaks) - 2; i >= 0; i-- {
+		root = Keccak256(peaks[i][:], root[:])
+	}
+	return root
+}
+
+// Verify checks that leaf is at Index under Root. The peaks have to bag
+// into the root, one per set bit of the width, and the siblings have to
+// lead from the leaf to its peak.
+func (p *Proof) Verify(leaf gommr.Hash) error {
+	if p.Index >= p.Width {
+		return ErrLeafIndex
+	}
+	if len(p.Peaks) != bits.OnesCount64(p.Width) || BagPeaks(p.Peaks) != p.Root {
+		return ErrPeaks
+	}
+	peak, _, height := mountain(p.Width, p.Index)
+	if len(p.Siblings) != height {
+		return ErrSiblings
+	}
+	cur := leaf
+	for h, sib := range p.Siblings {
+		if (p.Index>>uint(h))&1 == 0 {
+			cur = Keccak256(cur[:], sib[:])
+		} else {
+			cur = Keccak256(sib[:], cur[:])
+		}
+	}
+	if cur != p.Peaks[peak] {
+		return ErrRoot
+	}
+	return nil
+}
+
+func putUint(b []byte, v uint64) []byte {
+	var word [32]byte
+	binary.BigEndian.PutUint64(word[24:], v)
+	return append(b, word[:]...)
+}
+
+func putHashes(b []byte, hs []gommr.Hash) []byte {
+	b = putUint(b, uint64(len(hs)))
+	for _, h := range hs {
+		b = append(b, h[:]...)
+	}
+	return b
+}
+
+// Encode returns abi.encode(root, width, index, peaks, siblings).
+func (p *Proof) Encode() []byte {
+	b := make([]byte, 0, 32*(7+len(p.Peaks)+len(p.Siblings)))
+	b = append(b, p.Root[:]...)
+	b = putUint(b, p.Width)
+	b = putUint(b, p.Index)
+	b = putUint(b, 5*32)
+	b = putUint(b, 5*32+32*uint64(1+len(p.Peaks)))
+	b = putHashes(b, p.Peaks)
+	return putHashes(b, p.Siblings)
+}
+
+func getUint(b []byte, offset uint64) (uint64, error) {
+	if offset+32 > uint64(len(b)) || offset+32 < offset {
+		return 0, ErrEncoding
+	}
+	for _, c := range b[offset : offset+24] {
+		if c != 0 {
+			return 0, ErrEncoding
+		}
+	}
+	return binary.BigEndian.Uint64(b[offset+24:]), nil
+}
+
+func getHashes(b []byte, head uint64) ([]gommr.Hash, error) {
+	offset, err := getUint(b, head)
+	if err != nil {
+		return nil, err
+	}
+	n, err := getUint(b, offset)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(b))/32 || offset+32+32*n > uint64(len(b)) {
+		return nil, ErrEncoding
+	}
+	hs := make([]gommr.Hash, n)
+	for i := range hs {
+		copy(hs[i][:], b[offset+32+32*uint64(i):])
+	}
+	return hs, nil
+}
+
+// DecodeProof parses the output of Encode, or of abi.encode in Solidity.
+func DecodeProof(b []byte) (*Proof, error) {
+	if len(b) < 5*32 {
+		return nil, ErrEncoding
+	}
+	p := &Proof{Root: gommr.BytesToHash(b[:32])}
+	var err error
+	if p.Width, err = getUint(b, 32); err != nil {
+		return nil, err
+	}
+	if p.Index, err = getUint(b, 64); err != nil {
+		return nil, err
+	}
+	if p.Peaks, err = getHashes(b, 96); err != nil {
+		return nil, err
+	}
+	if p.Siblings, err = getHashes(b, 128); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
@@ -0,0 +1,145 @@
+package evm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-mmr/gommr"
+)
+
+func leafHash(i int) gommr.Hash {
+	return Keccak256([]byte{byte(i)})
+}
+
+func buildMMR(t *testing.T, count int) *gommr.MMR {
+	m, err := NewMMR(gommr.NewMemStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < count; i++ {
+		if _, err := m.Push(leafHash(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+func TestKeccak(t *testing.T) {
+	h := Keccak256()
+	if hex.EncodeToString(h[:]) != "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470" {
+		t.Fatalf("keccak256 of nothing is %x", h)
+	}
+}
+
+// TestEncoding spells out abi.encode for a proof of leaf 0 out of 3:
+// peaks are node 2 and leaf 2, the only sibling is leaf 1.
+func TestEncoding(t *testing.T) {
+	m := buildMMR(t, 3)
+	p, err := GenerateProof(m, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l0, l1, l2 := leafHash(0), leafHash(1), leafHash(2)
+	n2 := Keccak256(l0[:], l1[:])
+	root := Keccak256(n2[:], l2[:])
+	if r, _ := m.Root(); r != root {
+		t.Fatal("mmr root is not keccak256(peak0 ++ peak1)")
+	}
+	word := func(v int) string {
+		return fmt.Sprintf("%064x", v)
+	}
+	want := strings.Join([]string{
+		hex.EncodeToString(root[:]),
+		word(3),     // width
+		word(0),     // index
+		word(0xa0),  // offset of peaks
+		word(0x100), // offset of siblings
+		word(2),
+		hex.EncodeToString(n2[:]),
+		hex.EncodeToString(l2[:]),
+		word(1),
+		hex.EncodeToString(l1[:]),
+	}, "")
+	if got := hex.EncodeToString(p.Encode()); got != want {
+		t.Fatalf("encoding\n%s\nwant\n%s", got, want)
+	}
+	d, err := DecodeProof(p.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(d.Encode(), p.Encode()) {
+		t.Fatal("decoded proof encodes differently")
+	}
+	if _, err := DecodeProof(p.Encode()[:200]); err != ErrEncoding {
+		t.Fatalf("truncated proof decoded: %v", err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	for _, count := range []int{1, 2, 3, 7, 8, 11, 32, 45} {
+		m := buildMMR(t, count)
+		for i := 0; i < count; i++ {
+			p, err := GenerateProof(m, uint64(i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			d, err := DecodeProof(p.Encode())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := d.Verify(leafHash(i)); err != nil {
+				t.Fatalf("%d leaves: proof of leaf %d: %v", count, i, err)
+			}
+			// the same siblings in the generic gommr format
+			pos := gommr.LeafIndexToPos(uint64(i))
+			gp, _ := m.GenProof(pos)
+			if !gp.VerifyWith(Merger, p.Root, pos, leafHash(i)) {
+				t.Fatalf("%d leaves: gommr proof of leaf %d failed", count, i)
+			}
+			if d.Verify(leafHash(i+1)) != ErrRoot {
+				t.Fatalf("%d leaves: wrong leaf %d accepted", count, i)
+			}
+		}
+	}
+	m := buildMMR(t, 11)
+	p, _ := GenerateProof(m, 9)
+	p.Width = 12
+	if p.Verify(leafHash(9)) != ErrPeaks {
+		t.Fatal("proof with a wrong width accepted")
+	}
+	p.Width, p.Index = 11, 8
+	if p.Verify(leafHash(9)) != ErrRoot {
+		t.Fatal("proof moved to another index accepted")
+	}
+	if _, err := GenerateProof(m, 11); err != ErrLeafIndex {
+		t.Fatalf("proof of a missing leaf: %v", err)
+	}
+}
+
+func TestProofDuringPush(t *testing.T) {
+	m := buildMMR(t, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i < 300; i++ {
+			m.Push(leafHash(i))
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		p, err := GenerateProof(m, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Verify(leafHash(0)); err != nil {
+			t.Fatalf("proof at width %d: %v", p.Width, err)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+// Package forest keeps many independent named mmrs in a single key value
+// store, for services with an mmr per tenant or stream where a file per
+// mmr does not scale.
+//
+// Every member is a plain gommr.MMR over a store that prefixes its
+// positions with the member name. Its nodes live under
+//
+//	"n" name 0x00 pos   the hash at pos, pos as 8 bytes big endian
+//	"m" name            the size, as 8 bytes big endian
+//
+// A push writes the new nodes and the size in one batch. The forest
+// commits to all members with the root of an mmr over one leaf per
+// member, in name order, see MemberLeaf. On a FileKV the log keeps every
+// batch until it is compacted, see FileKV for its limits.
+package forest
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-mmr/gommr"
+)
+
+var (
+	ErrExists  = errors.New("forest: mmr exists")
+	ErrNoMMR   = errors.New("forest: no such mmr")
+	ErrName    = errors.New("forest: names must be non-empty and free of zero bytes")
+	ErrDeleted = errors.New("forest: mmr was deleted")
+)
+
+// Forest is a set of named mmrs in one KV. It is safe for concurrent use.
+type Forest struct {
+	lock    sync.RWMutex
+	kv      KV
+	opts    []gommr.Option
+	members map[string]*gommr.MMR
+}
+
+// Open opens the forest in kv. Every member is opened with opts, which
+// must not hold state of a single mmr such as a history.
+func Open(kv KV, opts ...gommr.Option) (*Forest, error) {
+	f := &Forest{kv: kv, opts: opts, members: make(map[string]*gommr.MMR)}
+	err := kv.Scan([]byte("m"), func(key, value []byte) error {
+		name := string(key[1:])
+		if len(value) != 8 {
+			return gommr.ErrBadSize
+		}
+		m, err := gommr.NewMMR(&memberStore{kv: kv, name: name, size: binary.BigEndian.Uint64(value)}, opts...)
+		if err != nil {
+			return err
+		}
+		f.members[name] = m
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Create adds an empty mmr under name.
+func (f *Forest) Create(name string) (*gommr.MMR, error) {
+	if name == "" || strings.IndexByte(name, 0) >= 0 {
+		return nil, ErrName
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if _, ok := f.members[name]; ok {
+		return nil, ErrExists
+	}
+	s := &memberStore{kv: f.kv, name: name}
+	var b Batch
+	b.Put(sizeKey(name), sizeValue(0))
+	if err := f.kv.Write(&b); err != nil {
+		return nil, err
+	}
+	m, err := gommr.NewMMR(s, f.opts...)
+	if err != nil {
+		return nil, err
+	}
+	f.members[name] = m
+	return m, nil
+}
+
+// MMR returns the mmr under name.
+func (f *Forest) MMR(name string) (*gommr.MMR, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	m, ok := f.members[name]
+	if !ok {
+		return nil, ErrNoMMR
+	}
+	return m, nil
+}
+
+// Delete removes the mmr under name with all its nodes. Pushes to it fail
+// from then on with ErrDeleted.
+func (f *Forest) Delete(name string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	m, ok := f.members[name]
+	if !ok {
+		return ErrNoMMR
+	}
+	s := m.Store().(*memberStore)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var b Batch
+	b.Delete(sizeKey(name))
+	for pos := uint64(0); pos < s.size; pos++ {
+		b.Delete(s.nodeKey(pos))
+	}
+	if err := f.kv.Write(&b); err != nil {
+		return err
+	}
+	s.deleted = true
+	delete(f.members, name)
+	return nil
+}
+
+// Names returns the names of all mmrs in order.
+func (f *Forest) Names() []string {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	names := make([]string, 0, len(f.members))
+	for name := range f.members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Size returns the number of nodes of the mmr under name.
+func (f *Forest) Size(name string) (uint64, error) {
+	m, err := f.MMR(name)
+	if err != nil {
+		return 0, err
+	}
+	return m.Size(), nil
+}
+
+// Root returns the root of the mmr under name.
+func (f *Forest) Root(name string) (gommr.Hash, error) {
+	m, err := f.MMR(name)
+	if err != nil {
+		return gommr.Hash{}, err
+	}
+	return m.Root()
+}
+
+// MemberLeaf is the leaf committing to the mmr of size nodes and root
+// under name in the root of roots.
+func MemberLeaf(name string, size uint64, root gommr.Hash) gommr.Hash {
+	return gommr.RlpHash([]interface{}{name, size, root})
+}
+
+// RootOfRoots returns the root of an mmr with the opts of the forest over
+// the member leaves of all mmrs in name order.
+func (f *Forest) RootOfRoots() (gommr.Hash, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	names := make([]string, 0, len(f.members))
+	for name := range f.members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	roots, err := gommr.NewMMR(gommr.NewMemStore(), f.opts...)
+	if err != nil {
+		return gommr.Hash{}, err
+	}
+	for _, name := range names {
+		m := f.members[name]
+		// size and root of the same moment
+		var size uint64
+		var root gommr.Hash
+		for {
+			size = m.Size()
+			if root, err = m.RootAt(size); err == nil {
+				break
+			}
+			if err != gommr.ErrBadSize {
+				return gommr.Hash{}, err
+			}
+		}
+		if _, err := roots.Push(MemberLeaf(name, size, root)); err != nil {
+			return gommr.Hash{}, err
+		}
+	}
+	return roots.Root()
+}
+
+func sizeKey(name string) []byte {
+	return append([]byte("m"), name...)
+}
+
+func sizeValue(size uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, size)
+}
+
+// memberStore is the gommr.Store of one member.
+type memberStore struct {
+	lock    sync.RWMutex
+	kv      KV
+	name    string
+	size    uint64
+	deleted bool
+}
+
+func (s *memberStore) nodeKey(pos uint64) []byte {
+	key := make([]byte, 0, len(s.name)+10)
+	key = append(key, 'n')
+	key = append(key, s.name...)
+	key = append(key, 0)
+	return binary.BigEndian.AppendUint64(key, pos)
+}
+
+func (s *memberStore) Get(pos uint64) (gommr.Hash, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.deleted {
+		return gommr.Hash{}, ErrDeleted
+	}
+	if pos >= s.size {
+		return gommr.Hash{}, gommr.ErrOutOfRange
+	}
+	v, err := s.kv.Get(s.nodeKey(pos))
+	if err != nil {
+		return gommr.Hash{}, err
+	}
+	return gommr.BytesToHash(v), nil
+}
+
+func (s *memberStore) Append(pos uint64, hashes []gommr.Hash) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.deleted {
+		return ErrDeleted
+	}
+	if pos != s.size {
+		return gommr.ErrBadAppend
+	}
+	var b Batch
+	for i := range hashes {
+		b.Put(s.nodeKey(pos+uint64(i)), hashes[i][:])
+	}
+	size := pos + uint64(len(hashes))
+	b.Put(sizeKey(s.name), sizeValue(size))
+	if err := s.kv.Write(&b); err != nil {
+		return err
+	}
+	s.size = size
+	return nil
+}
+
+func (s *memberStore) Size() uint64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.size
+}
+
+func (s *memberStore) Truncate(size uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.deleted {
+		return ErrDeleted
+	}
+	if size > s.size {
+		return gommr.ErrOutOfRange
+	}
+	var b Batch
+	b.Put(sizeKey(s.name), sizeValue(size))
+	for pos := size; pos < s.size; pos++ {
+		b.Delete(s.nodeKey(pos))
+	}
+	if err := s.kv.Write(&b); err != nil {
+		return err
+	}
+	s.size = size
+	return nil
+}
+
+func (s *memberStore) Rewrite(pos uint64, h gommr.Hash) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.deleted {
+		return ErrDeleted
+	}
+	if pos >= s.size {
+		return gommr.ErrOutOfRange
+	}
+	var b Batch
+	b.Put(s.nodeKey(pos), h[:])
+	return s.kv.Write(&b)
+}
@@ -0,0 +1,182 @@
+package forest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/go-mmr/gommr"
+)
+
+func build(t *testing.T, m *gommr.MMR, from, count int) {
+	for i := from; i < count; i++ {
+		if _, err := m.Push(gommr.RlpHash(uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func root(t *testing.T, count int) gommr.Hash {
+	m, _ := gommr.NewMMR(gommr.NewMemStore())
+	build(t, m, 0, count)
+	r, _ := m.Root()
+	return r
+}
+
+func TestForest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "forest")
+	kv, err := OpenFileKV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := Open(kv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"a", "a/1", "ab", "b", "tenant-7"}
+	for i, name := range names {
+		m, err := f.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		build(t, m, 0, 10*i+3)
+	}
+	if _, err := f.Create("a"); err != ErrExists {
+		t.Fatalf("create twice: %v", err)
+	}
+	if _, err := f.Create("a\x00b"); err != ErrName {
+		t.Fatalf("name with a zero byte: %v", err)
+	}
+	if !reflect.DeepEqual(f.Names(), names) {
+		t.Fatalf("names %q", f.Names())
+	}
+	for i, name := range names {
+		size, _ := f.Size(name)
+		r, _ := f.Root(name)
+		if size != gommr.LeafCountToSize(uint64(10*i+3)) || r != root(t, 10*i+3) {
+			t.Fatalf("%s: size %d root %x", name, size, r)
+		}
+	}
+	all, err := f.RootOfRoots()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a rewind and a torn batch at the end of the log are undone on open
+	m, _ := f.MMR("b")
+	build(t, m, 33, 40)
+	m.Rewind(gommr.LeafCountToSize(33))
+	kv.Close()
+	info, _ := os.Stat(path)
+	kv, _ = OpenFileKV(path)
+	f, _ = Open(kv)
+	m, _ = f.MMR("b")
+	build(t, m, 33, 34)
+	kv.Close()
+	os.Truncate(path, info.Size()+20)
+	kv, err = OpenFileKV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kv.Close()
+	f, err = Open(kv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := f.RootOfRoots(); got != all {
+		t.Fatalf("root of roots after reopen %x, want %x", got, all)
+	}
+
+	m, _ = f.MMR("ab")
+	build(t, m, 23, 24)
+	if got, _ := f.RootOfRoots(); got == all {
+		t.Fatal("root of roots did not change with a member")
+	}
+	if err := f.Delete("ab"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Push(gommr.Hash{}); err != ErrDeleted {
+		t.Fatalf("push to a deleted mmr: %v", err)
+	}
+	if _, err := f.Root("ab"); err != ErrNoMMR {
+		t.Fatalf("root of a deleted mmr: %v", err)
+	}
+	kv.Scan([]byte("nab\x00"), func(key, value []byte) error {
+		t.Fatalf("node %x of a deleted mmr left", key)
+		return nil
+	})
+	m, _ = f.Create("ab")
+	if r, _ := m.Root(); r != root(t, 0) || m.Size() != 0 {
+		t.Fatal("recreated mmr is not empty")
+	}
+}
+
+func TestRootOfRoots(t *testing.T) {
+	f, _ := Open(NewMemKV())
+	roots, _ := gommr.NewMMR(gommr.NewMemStore())
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("stream-%02d", i)
+		m, _ := f.Create(name)
+		build(t, m, 0, i)
+		r, _ := m.Root()
+		roots.Push(MemberLeaf(name, m.Size(), r))
+	}
+	want, _ := roots.Root()
+	if got, err := f.RootOfRoots(); err != nil || got != want {
+		t.Fatalf("root of roots %x, want %x", got, want)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "forest")
+	kv, _ := OpenFileKV(path)
+	f, _ := Open(kv)
+	for i := 0; i < 6; i++ {
+		m, _ := f.Create(fmt.Sprintf("tenant-%d", i))
+		build(t, m, 0, 50)
+	}
+	for _, name := range []string{"tenant-1", "tenant-4"} {
+		if err := f.Delete(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	all, _ := f.RootOfRoots()
+	before, _ := os.Stat(path)
+	stale := kv.Stale()
+	if err := kv.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := os.Stat(path)
+	if after.Size() >= before.Size()-stale/2 || kv.Stale() >= stale/10 {
+		t.Fatalf("compacted %d bytes with %d stale to %d with %d stale", before.Size(), stale, after.Size(), kv.Stale())
+	}
+	m, _ := f.MMR("tenant-0")
+	build(t, m, 50, 51)
+	want, _ := f.RootOfRoots()
+	if want == all {
+		t.Fatal("push after compaction lost")
+	}
+
+	// the compacted log reopens with the deleted mmrs gone
+	kv.Close()
+	kv, err := OpenFileKV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kv.Close()
+	f, err = Open(kv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := f.RootOfRoots(); got != want {
+		t.Fatalf("root of roots after reopen %x, want %x", got, want)
+	}
+	if names := f.Names(); !reflect.DeepEqual(names, []string{"tenant-0", "tenant-2", "tenant-3", "tenant-5"}) {
+		t.Fatalf("names after reopen %q", names)
+	}
+	if r, _ := f.Root("tenant-0"); r != root(t, 51) {
+		t.Fatal("tenant-0 differs after reopen")
+	}
+}
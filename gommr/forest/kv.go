@@ -0,0 +1,380 @@
+package forest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+var ErrNotFound = errors.New("forest: key not found")
+
+// KV is the key value store a forest keeps all its nodes in.
+type KV interface {
+	// Get returns the value of key, or ErrNotFound.
+	Get(key []byte) ([]byte, error)
+	// Write applies all puts and deletes of b at once.
+	Write(b *Batch) error
+	// Scan calls f with the keys starting with prefix and their values,
+	// in key order.
+	Scan(prefix []byte, f func(key, value []byte) error) error
+}
+
+// Batch collects writes to a KV.
+type Batch struct {
+	ops []op
+}
+
+type op struct {
+	key, value []byte
+	del        bool
+}
+
+func (b *Batch) Put(key, value []byte) {
+	b.ops = append(b.ops, op{key: key, value: value})
+}
+
+func (b *Batch) Delete(key []byte) {
+	b.ops = append(b.ops, op{key: key, del: true})
+}
+
+// MemKV keeps all keys in memory.
+type MemKV struct {
+	lock sync.RWMutex
+	m    map[string][]byte
+}
+
+func NewMemKV() *MemKV {
+	return &MemKV{m: make(map[string][]byte)}
+}
+
+func (kv *MemKV) Get(key []byte) ([]byte, error) {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+	v, ok := kv.m[string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return v, nil
+}
+
+func (kv *MemKV) Write(b *Batch) error {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+	for _, o := range b.ops {
+		if o.del {
+			delete(kv.m, string(o.key))
+		} else {
+			kv.m[string(o.key)] = append([]byte{}, o.value...)
+		}
+	}
+	return nil
+}
+
+func (kv *MemKV) Scan(prefix []byte, f func(key, value []byte) error) error {
+	kv.lock.RLock()
+	var keys []string
+	for k := range kv.m {
+		if bytes.HasPrefix([]byte(k), prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	values := make([][]byte, len(keys))
+	for i, k := range keys {
+		values[i] = kv.m[k]
+	}
+	kv.lock.RUnlock()
+	for i, k := range keys {
+		if err := f([]byte(k), values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FileKV is a log of batches in a single file, with an index of where the
+// value of each key lives kept in memory. Each batch is one record:
+//
+//	length  uint32, big endian, of the ops
+//	ops     per op a kind byte, 0 for put and 1 for delete, the uvarint
+//	        length prefixed key and, for a put, the uvarint length
+//	        prefixed value
+//	crc     uint32, CRC-32C of the ops
+//
+// A batch cut short by a crash fails its checksum and is dropped on open.
+//
+// Deleted and overwritten values stay in the log until Compact rewrites
+// it; a forest overwrites the size of an mmr on every push, so the log
+// grows with every push until then. The index keeps every live key, one
+// per node of every mmr, in memory, which bounds a FileKV to forests whose
+// keys fit in memory.
+type FileKV struct {
+	lock  sync.RWMutex
+	path  string
+	file  *os.File
+	size  int64
+	live  int64
+	index map[string]valuePos
+}
+
+type valuePos struct {
+	off int64
+	n   int
+}
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// OpenFileKV opens or creates the log at path and indexes it.
+func OpenFileKV(path string) (*FileKV, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	kv := &FileKV{path: path, file: f, index: make(map[string]valuePos)}
+	if err := kv.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return kv, nil
+}
+
+// load replays the log up to its first torn record and cuts it there.
+func (kv *FileKV) load() error {
+	info, err := kv.file.Stat()
+	if err != nil {
+		return err
+	}
+	r := io.NewSectionReader(kv.file, 0, info.Size())
+	var off int64
+	for {
+		var n [4]byte
+		if _, err := io.ReadFull(r, n[:]); err != nil {
+			break
+		}
+		length := int64(binary.BigEndian.Uint32(n[:]))
+		if length > info.Size()-off-8 {
+			break
+		}
+		rec := make([]byte, length+4)
+		if _, err := io.ReadFull(r, rec); err != nil {
+			break
+		}
+		ops := rec[:length]
+		if binary.BigEndian.Uint32(rec[length:]) != crc32.Checksum(ops, crcTable) || !kv.apply(off+4, ops) {
+			break
+		}
+		off += 4 + length + 4
+	}
+	if off != info.Size() {
+		if err := kv.file.Truncate(off); err != nil {
+			return err
+		}
+	}
+	kv.size = off
+	return nil
+}
+
+// apply indexes the ops of a record whose ops start at base.
+func (kv *FileKV) apply(base int64, ops []byte) bool {
+	b := ops
+	field := func() []byte {
+		n, k := binary.Uvarint(b)
+		if k <= 0 || n > uint64(len(b)-k) {
+			return nil
+		}
+		v := b[k : k+int(n)]
+		b = b[k+int(n):]
+		return v
+	}
+	for len(b) > 0 {
+		kind := b[0]
+		b = b[1:]
+		key := field()
+		if key == nil || kind > 1 {
+			return false
+		}
+		if old, ok := kv.index[string(key)]; ok {
+			kv.live -= int64(len(key) + old.n)
+		}
+		if kind == 1 {
+			delete(kv.index, string(key))
+			continue
+		}
+		value := field()
+		if value == nil {
+			return false
+		}
+		kv.index[string(key)] = valuePos{base + int64(len(ops)-len(b)-len(value)), len(value)}
+		kv.live += int64(len(key) + len(value))
+	}
+	return true
+}
+
+func (kv *FileKV) Get(key []byte) ([]byte, error) {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+	return kv.get(string(key))
+}
+
+func (kv *FileKV) get(key string) ([]byte, error) {
+	p, ok := kv.index[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	v := make([]byte, p.n)
+	if _, err := kv.file.ReadAt(v, p.off); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// record encodes the ops of b as a log record.
+func record(b *Batch) []byte {
+	var ops []byte
+	for _, o := range b.ops {
+		if o.del {
+			ops = append(ops, 1)
+		} else {
+			ops = append(ops, 0)
+		}
+		ops = binary.AppendUvarint(ops, uint64(len(o.key)))
+		ops = append(ops, o.key...)
+		if !o.del {
+			ops = binary.AppendUvarint(ops, uint64(len(o.value)))
+			ops = append(ops, o.value...)
+		}
+	}
+	rec := binary.BigEndian.AppendUint32(make([]byte, 0, len(ops)+8), uint32(len(ops)))
+	rec = append(rec, ops...)
+	return binary.BigEndian.AppendUint32(rec, crc32.Checksum(ops, crcTable))
+}
+
+// append writes a record at the end of the log and indexes it.
+func (kv *FileKV) append(rec []byte) error {
+	if _, err := kv.file.WriteAt(rec, kv.size); err != nil {
+		return err
+	}
+	kv.apply(kv.size+4, rec[4:len(rec)-4])
+	kv.size += int64(len(rec))
+	return nil
+}
+
+func (kv *FileKV) Write(b *Batch) error {
+	rec := record(b)
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+	return kv.append(rec)
+}
+
+// compactBatch bounds the ops of a record written by Compact.
+const compactBatch = 1 << 20
+
+// Stale returns the bytes of the log that are no live key or value: those
+// deleted or overwritten since the last Compact and the record framing.
+// Compared with the size of the log it tells when to Compact.
+func (kv *FileKV) Stale() int64 {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+	return kv.size - kv.live
+}
+
+// Compact writes the live keys to a new log next to the old one, syncs it
+// and renames it over the old one. Reads and writes wait for it; a crash
+// leaves either log in place.
+func (kv *FileKV) Compact() error {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+	keys := make([]string, 0, len(kv.index))
+	for k := range kv.index {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	tmp := kv.path + ".compact"
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	next := &FileKV{path: kv.path, file: f, index: make(map[string]valuePos, len(kv.index))}
+	err = func() error {
+		var b Batch
+		n := 0
+		for _, k := range keys {
+			v, err := kv.get(k)
+			if err != nil {
+				return err
+			}
+			b.Put([]byte(k), v)
+			if n += len(k) + len(v); n >= compactBatch {
+				if err := next.append(record(&b)); err != nil {
+					return err
+				}
+				b, n = Batch{}, 0
+			}
+		}
+		if len(b.ops) != 0 {
+			if err := next.append(record(&b)); err != nil {
+				return err
+			}
+		}
+		if err := f.Sync(); err != nil {
+			return err
+		}
+		return os.Rename(tmp, kv.path)
+	}()
+	if err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	kv.file.Close()
+	kv.file, kv.size, kv.live, kv.index = f, next.size, next.live, next.index
+	d, err := os.Open(filepath.Dir(kv.path))
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func (kv *FileKV) Scan(prefix []byte, f func(key, value []byte) error) error {
+	kv.lock.RLock()
+	var keys []string
+	for k := range kv.index {
+		if bytes.HasPrefix([]byte(k), prefix) {
+			keys = append(keys, k)
+		}
+	}
+	kv.lock.RUnlock()
+	sort.Strings(keys)
+	for _, k := range keys {
+		kv.lock.RLock()
+		v, err := kv.get(k)
+		kv.lock.RUnlock()
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := f([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sync flushes the log to disk.
+func (kv *FileKV) Sync() error {
+	return kv.file.Sync()
+}
+
+func (kv *FileKV) Close() error {
+	return kv.file.Close()
+}
@@ -0,0 +1,50 @@
+// Package grin implements Grin's PMMR on top of gommr. Grin uses the same
+// position layout, but every hash commits to the position of its node,
+// spent leaves are tracked in a leaf set and fully spent subtrees can be
+// compacted away, keeping only their root.
+package grin
+
+import (
+	"encoding/binary"
+
+	"github.com/go-mmr/gommr"
+	"golang.org/x/crypto/blake2b"
+)
+
+// HashWithIndex hashes the big endian position followed by data with
+// blake2b-256, as Grin's hash_with_index does.
+func HashWithIndex(pos uint64, data ...[]byte) gommr.Hash {
+	h, _ := blake2b.New256(nil)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], pos)
+	h.Write(buf[:])
+	for _, d := range data {
+		h.Write(d)
+	}
+	var res gommr.Hash
+	h.Sum(res[:0])
+	return res
+}
+
+// LeafHash returns the hash of a serialized element pushed at pos.
+func LeafHash(pos uint64, elem []byte) gommr.Hash {
+	return HashWithIndex(pos, elem)
+}
+
+type merger struct{}
+
+func (merger) Merge(pos uint64, left, right gommr.Hash) gommr.Hash {
+	return HashWithIndex(pos, left[:], right[:])
+}
+
+// BagPeaks hashes the left peak first, with the mmr size as index.
+func (merger) BagPeaks(mmrSize uint64, left, right gommr.Hash) gommr.Hash {
+	return HashWithIndex(mmrSize, left[:], right[:])
+}
+
+// Merger combines nodes the way Grin does.
+var Merger gommr.Merger = merger{}
+
+func init() {
+	gommr.RegisterScheme(gommr.Scheme{Name: "grin", HashCode: gommr.Blake2b_256, Merger: Merger})
+}
@@ -0,0 +1,47 @@
+package grin
+
+import "math/bits"
+
+// LeafSet is a bitmap of the unspent leaf positions.
+type LeafSet struct {
+	words []uint64
+}
+
+func (s *LeafSet) Add(pos uint64) {
+	for uint64(len(s.words)) <= pos/64 {
+		s.words = append(s.words, 0)
+	}
+	s.words[pos/64] |= 1 << (pos % 64)
+}
+
+func (s *LeafSet) Remove(pos uint64) {
+	if pos/64 < uint64(len(s.words)) {
+		s.words[pos/64] &^= 1 << (pos % 64)
+	}
+}
+
+func (s *LeafSet) Contains(pos uint64) bool {
+	return pos/64 < uint64(len(s.words)) && s.words[pos/64]&(1<<(pos%64)) != 0
+}
+
+// Len returns the number of unspent leaves.
+func (s *LeafSet) Len() int {
+	n := 0
+	for _, w := range s.words {
+		n += bits.OnesCount64(w)
+	}
+	return n
+}
+
+// Positions returns the unspent leaf positions in ascending order.
+func (s *LeafSet) Positions() []uint64 {
+	res := make([]uint64, 0, s.Len())
+	for i, w := range s.words {
+		for w != 0 {
+			b := uint64(bits.TrailingZeros64(w))
+			res = append(res, uint64(i)*64+b)
+			w &= w - 1
+		}
+	}
+	return res
+}
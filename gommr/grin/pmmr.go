@@ -0,0 +1,174 @@
+package grin
+
+import (
+	"errors"
+
+	"github.com/go-mmr/gommr"
+)
+
+var (
+	ErrPruned   = errors.New("grin: node was compacted")
+	ErrNotLeaf  = errors.New("grin: not an unspent leaf")
+	ErrTruncate = errors.New("grin: cannot truncate compacted nodes")
+)
+
+// backend is a gommr.Store that skips compacted nodes. hashes holds the
+// remaining nodes in position order, a position is found by subtracting
+// the number of removed nodes before it.
+type backend struct {
+	hashes []gommr.Hash
+	prune  PruneList
+	size   uint64
+}
+
+func (b *backend) Get(pos uint64) (gommr.Hash, error) {
+	if pos >= b.size {
+		return gommr.Hash{}, gommr.ErrOutOfRange
+	}
+	if b.prune.IsRemoved(pos) {
+		return gommr.Hash{}, ErrPruned
+	}
+	return b.hashes[pos-b.prune.Shift(pos)], nil
+}
+
+func (b *backend) Append(pos uint64, hashes []gommr.Hash) error {
+	if pos != b.size {
+		return gommr.ErrBadAppend
+	}
+	b.hashes = append(b.hashes, hashes...)
+	b.size += uint64(len(hashes))
+	return nil
+}
+
+func (b *backend) Size() uint64 {
+	return b.size
+}
+
+func (b *backend) Truncate(size uint64) error {
+	if size > b.size {
+		return gommr.ErrOutOfRange
+	}
+	if size < b.prune.End() {
+		return ErrTruncate
+	}
+	b.hashes = b.hashes[:size-b.prune.Shift(size)]
+	b.size = size
+	return nil
+}
+
+// PMMR is a prunable mmr hashing like Grin.
+type PMMR struct {
+	mmr     *gommr.MMR
+	backend *backend
+	leaves  LeafSet
+}
+
+func NewPMMR() *PMMR {
+	b := &backend{}
+	m, _ := gommr.NewMMR(b, gommr.WithScheme("grin"))
+	return &PMMR{mmr: m, backend: b}
+}
+
+// Push appends a serialized element and returns its position.
+func (p *PMMR) Push(elem []byte) (uint64, error) {
+	pos, err := p.mmr.Push(LeafHash(p.mmr.Size(), elem))
+	if err != nil {
+		return 0, err
+	}
+	p.leaves.Add(pos)
+	return pos, nil
+}
+
+// Size returns the unpruned size.
+func (p *PMMR) Size() uint64 {
+	return p.mmr.Size()
+}
+
+// Root returns the root over all nodes, spent or not.
+func (p *PMMR) Root() (gommr.Hash, error) {
+	return p.mmr.Root()
+}
+
+// Get returns the hash at pos, compacted nodes return ErrPruned.
+func (p *PMMR) Get(pos uint64) (gommr.Hash, error) {
+	return p.mmr.Get(pos)
+}
+
+// LeafSet returns the set of unspent leaves.
+func (p *PMMR) LeafSet() *LeafSet {
+	return &p.leaves
+}
+
+// PruneList returns the list of compacted subtree roots.
+func (p *PMMR) PruneList() *PruneList {
+	return &p.backend.prune
+}
+
+// Remove marks the leaf at pos as spent. Its hash stays until Compact.
+func (p *PMMR) Remove(pos uint64) error {
+	if !p.leaves.Contains(pos) {
+		return ErrNotLeaf
+	}
+	p.leaves.Remove(pos)
+	return nil
+}
+
+// GenProof returns a merkle proof for an unspent leaf.
+func (p *PMMR) GenProof(pos uint64) (*gommr.MerkleProof, error) {
+	if !p.leaves.Contains(pos) {
+		return nil, ErrNotLeaf
+	}
+	return p.mmr.GenProof(pos)
+}
+
+// Verify checks a proof produced by a Grin PMMR.
+func Verify(proof *gommr.MerkleProof, root gommr.Hash, pos uint64, leaf gommr.Hash) bool {
+	return proof.VerifyWith(Merger, root, pos, leaf)
+}
+
+// Compact removes every subtree whose leaves are all spent, keeping the
+// hash of its root. Peaks and the siblings on the path of every unspent
+// leaf survive, so proofs for unspent leaves keep working.
+func (p *PMMR) Compact() error {
+	prune := PruneList{roots: p.backend.prune.Roots()}
+	for _, peak := range gommr.Peaks(p.backend.size) {
+		p.collectPruned(peak, &prune)
+	}
+	hashes := make([]gommr.Hash, 0, len(p.backend.hashes))
+	for pos := uint64(0); pos < p.backend.size; pos++ {
+		if prune.IsRemoved(pos) {
+			continue
+		}
+		h, err := p.backend.Get(pos)
+		if err != nil {
+			return err
+		}
+		hashes = append(hashes, h)
+	}
+	p.backend.hashes = hashes
+	p.backend.prune = prune
+	return nil
+}
+
+// collectPruned adds the maximal fully spent subtrees below pos.
+func (p *PMMR) collectPruned(pos uint64, prune *PruneList) {
+	if p.spent(pos) {
+		prune.Add(pos)
+		return
+	}
+	height := gommr.PosHeight(pos)
+	if height == 0 {
+		return
+	}
+	p.collectPruned(pos-gommr.ParentOffset(height-1), prune)
+	p.collectPruned(pos-1, prune)
+}
+
+// spent reports whether all leaves below pos are spent.
+func (p *PMMR) spent(pos uint64) bool {
+	height := gommr.PosHeight(pos)
+	if height == 0 {
+		return !p.leaves.Contains(pos)
+	}
+	return p.spent(pos-gommr.ParentOffset(height-1)) && p.spent(pos-1)
+}
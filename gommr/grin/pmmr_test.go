@@ -0,0 +1,204 @@
+package grin
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/go-mmr/gommr"
+	"golang.org/x/crypto/blake2b"
+)
+
+func elem(i int) []byte {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(i))
+	return b[:]
+}
+
+// b2b hashes a big endian index and data, spelled out independently of
+// HashWithIndex.
+func b2b(index uint64, data ...[]byte) gommr.Hash {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, index)
+	for _, d := range data {
+		buf = append(buf, d...)
+	}
+	return blake2b.Sum256(buf)
+}
+
+func build(t *testing.T, count int) *PMMR {
+	p := NewPMMR()
+	for i := 0; i < count; i++ {
+		if _, err := p.Push(elem(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return p
+}
+
+// TestVectors builds the first nodes and roots by hand:
+//
+//	    6
+//	  2   5
+//	 0 1 3 4 7
+func TestVectors(t *testing.T) {
+	l0, l1 := b2b(0, elem(0)), b2b(1, elem(1))
+	n2 := b2b(2, l0[:], l1[:])
+	l3, l4 := b2b(3, elem(2)), b2b(4, elem(3))
+	n5 := b2b(5, l3[:], l4[:])
+	n6 := b2b(6, n2[:], n5[:])
+	l7 := b2b(7, elem(4))
+
+	roots := map[int]gommr.Hash{
+		1: l0,
+		2: n2,
+		3: b2b(4, n2[:], l3[:]),
+		4: n6,
+		5: b2b(8, n6[:], l7[:]),
+	}
+	for count, want := range roots {
+		root, err := build(t, count).Root()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if root != want {
+			t.Errorf("%d leaves: root %x, want %x", count, root, want)
+		}
+	}
+	p := build(t, 5)
+	for pos, want := range []gommr.Hash{l0, l1, n2, l3, l4, n5, n6, l7} {
+		if got, _ := p.Get(uint64(pos)); got != want {
+			t.Errorf("node %d: %x, want %x", pos, got, want)
+		}
+	}
+	// three peaks are bagged right to left, each step indexed by the size
+	l8 := b2b(8, elem(5))
+	n9 := b2b(9, l7[:], l8[:])
+	l10 := b2b(10, elem(6))
+	rhs := b2b(11, n9[:], l10[:])
+	if root, _ := build(t, 7).Root(); root != b2b(11, n6[:], rhs[:]) {
+		t.Errorf("7 leaves: root %x", root)
+	}
+}
+
+// TestGrinVectors checks the nodes and roots exported from grin_core by
+// testdata/export.
+func TestGrinVectors(t *testing.T) {
+	data, err := os.ReadFile("testdata/vectors.json")
+	if os.IsNotExist(err) {
+		t.Skip("testdata/vectors.json not exported yet, see testdata/README")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v struct {
+		Roots []struct {
+			Leaves  int    `json:"leaves"`
+			MmrSize uint64 `json:"mmr_size"`
+			Root    string `json:"root"`
+		} `json:"roots"`
+		Nodes []string `json:"nodes"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	p := NewPMMR()
+	for _, r := range v.Roots {
+		for p.Size() < gommr.LeafCountToSize(uint64(r.Leaves)) {
+			if _, err := p.Push(elem(int(gommr.SizeToLeafCount(p.Size())))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		root, _ := p.Root()
+		if p.Size() != r.MmrSize || hex.EncodeToString(root[:]) != r.Root {
+			t.Fatalf("%d leaves: size %d root %x, want %d %s", r.Leaves, p.Size(), root, r.MmrSize, r.Root)
+		}
+	}
+	for pos, want := range v.Nodes {
+		if got, err := p.Get(uint64(pos)); err != nil || hex.EncodeToString(got[:]) != want {
+			t.Fatalf("node %d: %x %v, want %s", pos, got, err, want)
+		}
+	}
+}
+
+func TestRemoveCompact(t *testing.T) {
+	const count = 37
+	p := build(t, count)
+	root, _ := p.Root()
+	spent := map[int]bool{}
+	// spend the first 16 leaves, a full mountain, and a scattered few
+	for i := 0; i < 16; i++ {
+		spent[i] = true
+	}
+	for _, i := range []int{17, 20, 21, 22, 23, 36} {
+		spent[i] = true
+	}
+	for i := range spent {
+		if err := p.Remove(gommr.LeafIndexToPos(uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Remove(gommr.LeafIndexToPos(0)); err != ErrNotLeaf {
+		t.Fatalf("double spend: %v", err)
+	}
+	if p.LeafSet().Len() != count-len(spent) {
+		t.Fatalf("leaf set has %d leaves", p.LeafSet().Len())
+	}
+	if err := p.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := p.Root(); got != root {
+		t.Fatal("root changed by compaction")
+	}
+	// the 16 leaf mountain keeps only its peak, leaves 20..23 only their parent
+	if _, err := p.Get(0); err != ErrPruned {
+		t.Fatalf("get compacted leaf: %v", err)
+	}
+	if !p.PruneList().IsPrunedRoot(30) {
+		t.Fatalf("prune list %v misses peak 30", p.PruneList().Roots())
+	}
+	removed := p.Size() - uint64(len(p.backend.hashes))
+	if removed != 30+6 {
+		t.Fatalf("removed %d nodes, want 36", removed)
+	}
+	for i := 0; i < count; i++ {
+		pos := gommr.LeafIndexToPos(uint64(i))
+		proof, err := p.GenProof(pos)
+		if spent[i] {
+			if err != ErrNotLeaf {
+				t.Fatalf("proof for spent leaf %d: %v", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("leaf %d: %v", i, err)
+		}
+		if !Verify(proof, root, pos, LeafHash(pos, elem(i))) {
+			t.Fatalf("proof for leaf %d failed", i)
+		}
+	}
+	// compaction keeps working after more pushes
+	for i := count; i < count+10; i++ {
+		p.Push(elem(i))
+	}
+	p.Remove(gommr.LeafIndexToPos(16))
+	if err := p.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := mustRoot(t, p), mustRoot(t, build(t, count+10)); got != want {
+		t.Fatal("root differs from uncompacted pmmr")
+	}
+	if err := p.backend.Truncate(10); err != ErrTruncate {
+		t.Fatalf("truncate into compacted nodes: %v", err)
+	}
+}
+
+func mustRoot(t *testing.T, p *PMMR) gommr.Hash {
+	root, err := p.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
@@ -0,0 +1,75 @@
+package grin
+
+import (
+	"sort"
+
+	"github.com/go-mmr/gommr"
+)
+
+// PruneList holds the roots of compacted subtrees in ascending order. The
+// hash of a root is kept, every node below it is removed from storage.
+type PruneList struct {
+	roots []uint64
+}
+
+// subtreeSize returns the number of nodes below a root at pos.
+func subtreeSize(pos uint64) uint64 {
+	return (uint64(2) << uint64(gommr.PosHeight(pos))) - 2
+}
+
+// Add records a pruned root, dropping roots of subtrees below it.
+func (p *PruneList) Add(root uint64) {
+	if p.IsRemoved(root) {
+		return
+	}
+	low := root - subtreeSize(root)
+	i := sort.Search(len(p.roots), func(i int) bool { return p.roots[i] >= low })
+	j := i
+	for j < len(p.roots) && p.roots[j] <= root {
+		j++
+	}
+	if j > i && p.roots[j-1] == root {
+		return
+	}
+	roots := append([]uint64{}, p.roots[:i]...)
+	roots = append(roots, root)
+	p.roots = append(roots, p.roots[j:]...)
+}
+
+// IsPrunedRoot reports whether pos is the root of a compacted subtree.
+func (p *PruneList) IsPrunedRoot(pos uint64) bool {
+	i := sort.Search(len(p.roots), func(i int) bool { return p.roots[i] >= pos })
+	return i < len(p.roots) && p.roots[i] == pos
+}
+
+// IsRemoved reports whether pos lies below a pruned root.
+func (p *PruneList) IsRemoved(pos uint64) bool {
+	i := sort.Search(len(p.roots), func(i int) bool { return p.roots[i] > pos })
+	return i < len(p.roots) && p.roots[i]-subtreeSize(p.roots[i]) <= pos
+}
+
+// Shift returns the number of removed nodes before pos, which includes
+// the nodes below pos if it is a pruned root.
+func (p *PruneList) Shift(pos uint64) uint64 {
+	shift := uint64(0)
+	for _, r := range p.roots {
+		if r > pos {
+			break
+		}
+		shift += subtreeSize(r)
+	}
+	return shift
+}
+
+// End returns the position after the last pruned root.
+func (p *PruneList) End() uint64 {
+	if len(p.roots) == 0 {
+		return 0
+	}
+	return p.roots[len(p.roots)-1] + 1
+}
+
+// Roots returns the pruned roots.
+func (p *PruneList) Roots() []uint64 {
+	return append([]uint64{}, p.roots...)
+}
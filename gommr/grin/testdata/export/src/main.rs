@@ -0,0 +1,60 @@
+// Exports vectors.json from Grin's own PMMR:
+//
+//     cargo run --manifest-path export/Cargo.toml > vectors.json
+use grin_core::core::hash::DefaultHashable;
+use grin_core::core::pmmr::{ReadablePMMR, VecBackend, PMMR};
+use grin_core::ser::{self, PMMRable, Readable, Reader, Writeable, Writer};
+use serde_json::json;
+
+// Elem is a leaf serialized as a big endian u32, like elem in the go tests.
+#[derive(Clone, Debug, PartialEq)]
+struct Elem(u32);
+
+impl DefaultHashable for Elem {}
+
+impl Writeable for Elem {
+    fn write<W: Writer>(&self, writer: &mut W) -> Result<(), ser::Error> {
+        writer.write_u32(self.0)
+    }
+}
+
+impl Readable for Elem {
+    fn read<R: Reader>(reader: &mut R) -> Result<Elem, ser::Error> {
+        Ok(Elem(reader.read_u32()?))
+    }
+}
+
+impl PMMRable for Elem {
+    type E = Self;
+    fn as_elmt(&self) -> Self::E {
+        self.clone()
+    }
+    fn elmt_size() -> Option<u16> {
+        Some(4)
+    }
+}
+
+const LEAVES: u32 = 50;
+
+fn main() {
+    let mut backend = VecBackend::<Elem>::new();
+    let mut pmmr = PMMR::new(&mut backend);
+    let mut roots = Vec::new();
+    for i in 0..LEAVES {
+        pmmr.push(&Elem(i)).unwrap();
+        roots.push(json!({
+            "leaves": i + 1,
+            "mmr_size": pmmr.unpruned_size(),
+            "root": pmmr.root().unwrap().to_hex(),
+        }));
+    }
+    let nodes: Vec<String> = (0..pmmr.unpruned_size())
+        .map(|pos0| pmmr.get_hash(pos0).unwrap().to_hex())
+        .collect();
+    let out = json!({
+        "elem": "u32 big endian index",
+        "roots": roots,
+        "nodes": nodes,
+    });
+    println!("{}", serde_json::to_string_pretty(&out).unwrap());
+}
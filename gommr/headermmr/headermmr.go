@@ -0,0 +1,243 @@
+// Package headermmr commits to a chain of block headers in a merkle mountain
+// range whose nodes also carry the accumulated difficulty of their subtree,
+// as described in the FlyClient paper. It produces non-interactive,
+// difficulty-weighted sampling proofs of the whole chain.
+package headermmr
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/go-mmr/gommr"
+	"github.com/go-mmr/gommr/rlp"
+)
+
+var (
+	ErrEmpty         = errors.New("headermmr: empty chain")
+	ErrBadDifficulty = errors.New("headermmr: difficulty must be positive")
+	ErrNoHeader      = errors.New("headermmr: header index out of range")
+)
+
+// Node is an mmr node: the hash of the subtree and its total difficulty.
+type Node struct {
+	Hash       gommr.Hash
+	Difficulty *big.Int
+}
+
+type leafRLP struct {
+	Header     gommr.Hash
+	Difficulty *big.Int
+}
+
+type nodeRLP struct {
+	Left       gommr.Hash
+	Right      gommr.Hash
+	Difficulty *big.Int
+}
+
+// HeaderHash returns the hash of an rlp encoded header.
+func HeaderHash(enc []byte) gommr.Hash {
+	return gommr.RlpHash(rlp.RawValue(enc))
+}
+
+// LeafNode returns the leaf committing to an rlp encoded header.
+func LeafNode(enc []byte, difficulty *big.Int) Node {
+	return Node{
+		Hash:       gommr.RlpHash(&leafRLP{HeaderHash(enc), difficulty}),
+		Difficulty: new(big.Int).Set(difficulty),
+	}
+}
+
+// Combine returns the parent of left and right, which commits to both
+// children and their summed difficulty.
+func Combine(left, right Node) Node {
+	d := new(big.Int).Add(left.Difficulty, right.Difficulty)
+	return Node{
+		Hash:       gommr.RlpHash(&nodeRLP{left.Hash, right.Hash, d}),
+		Difficulty: d,
+	}
+}
+
+// HeaderMMR is an in-memory header mmr. It keeps the encoded headers so
+// that sampled blocks can be included in proofs.
+type HeaderMMR struct {
+	nodes   []Node
+	headers [][]byte
+}
+
+// New returns an empty header mmr.
+func New() *HeaderMMR {
+	return &HeaderMMR{}
+}
+
+// Append rlp-encodes header, appends it with its difficulty and returns
+// its leaf index.
+func (m *HeaderMMR) Append(header interface{}, difficulty *big.Int) (uint64, error) {
+	enc, err := rlp.EncodeToBytes(header)
+	if err != nil {
+		return 0, err
+	}
+	return m.AppendEncoded(enc, difficulty)
+}
+
+// AppendEncoded is like Append for an already encoded header.
+func (m *HeaderMMR) AppendEncoded(enc []byte, difficulty *big.Int) (uint64, error) {
+	if difficulty == nil || difficulty.Sign() <= 0 {
+		return 0, ErrBadDifficulty
+	}
+	index := uint64(len(m.headers))
+	m.headers = append(m.headers, enc)
+
+	height, pos := 0, uint64(len(m.nodes))
+	m.nodes = append(m.nodes, LeafNode(enc, difficulty))
+	for gommr.PosHeight(pos+1) > height {
+		pos++
+		left := m.nodes[pos-gommr.ParentOffset(height)]
+		right := m.nodes[pos-1]
+		m.nodes = append(m.nodes, Combine(left, right))
+		height++
+	}
+	return index, nil
+}
+
+// Len returns the number of appended headers.
+func (m *HeaderMMR) Len() uint64 {
+	return uint64(len(m.headers))
+}
+
+// Header returns the encoded header with the given leaf index.
+func (m *HeaderMMR) Header(index uint64) ([]byte, error) {
+	if index >= uint64(len(m.headers)) {
+		return nil, ErrNoHeader
+	}
+	return m.headers[index], nil
+}
+
+// RootNode bags the peaks from right to left into a single node. Unlike
+// gommr the left peak stays on the left, so the root keeps the leaf order
+// and can be descended by difficulty.
+func (m *HeaderMMR) RootNode() Node {
+	if len(m.nodes) == 0 {
+		return Node{Difficulty: new(big.Int)}
+	}
+	return m.bag(gommr.Peaks(uint64(len(m.nodes))))
+}
+
+// Root returns the hash of RootNode.
+func (m *HeaderMMR) Root() gommr.Hash {
+	return m.RootNode().Hash
+}
+
+// TotalDifficulty returns the summed difficulty of all headers.
+func (m *HeaderMMR) TotalDifficulty() *big.Int {
+	return m.RootNode().Difficulty
+}
+
+func (m *HeaderMMR) bag(peaks []uint64) Node {
+	acc := m.nodes[peaks[len(peaks)-1]]
+	for i := len(peaks) - 2; i >= 0; i-- {
+		acc = Combine(m.nodes[peaks[i]], acc)
+	}
+	return acc
+}
+
+// leafAt returns the index of the leaf whose difficulty range contains x,
+// x must be lower than the total difficulty.
+func (m *HeaderMMR) leafAt(x *big.Int) uint64 {
+	x = new(big.Int).Set(x)
+	index := uint64(0)
+	peaks := gommr.Peaks(uint64(len(m.nodes)))
+	pos := peaks[len(peaks)-1]
+	for _, p := range peaks {
+		if x.Cmp(m.nodes[p].Difficulty) < 0 {
+			pos = p
+			break
+		}
+		x.Sub(x, m.nodes[p].Difficulty)
+		index += uint64(1) << uint64(gommr.PosHeight(p))
+	}
+	for height := gommr.PosHeight(pos); height > 0; height-- {
+		left := pos - gommr.ParentOffset(height-1)
+		if x.Cmp(m.nodes[left].Difficulty) < 0 {
+			pos = left
+			continue
+		}
+		x.Sub(x, m.nodes[left].Difficulty)
+		index += uint64(1) << uint64(height-1)
+		pos--
+	}
+	return index
+}
+
+// path returns the siblings needed to recompute the root from the
+// index-th leaf, bottom-up, in the order expected by pathShape.
+func (m *HeaderMMR) path(index uint64) []Node {
+	size := uint64(len(m.nodes))
+	pos := gommr.LeafIndexToPos(index)
+	path := make([]Node, 0)
+	height := 0
+	for {
+		if gommr.PosHeight(pos+1) > height {
+			path = append(path, m.nodes[pos-gommr.SiblingOffset(height)])
+			pos++
+		} else {
+			sib := pos + gommr.SiblingOffset(height)
+			if sib >= size {
+				break
+			}
+			path = append(path, m.nodes[sib])
+			pos += gommr.ParentOffset(height)
+		}
+		height++
+	}
+	peaks := gommr.Peaks(size)
+	for i, p := range peaks {
+		if p != pos {
+			continue
+		}
+		if i < len(peaks)-1 {
+			path = append(path, m.bag(peaks[i+1:]))
+		}
+		for j := i - 1; j >= 0; j-- {
+			path = append(path, m.nodes[peaks[j]])
+		}
+		break
+	}
+	return path
+}
+
+// pathShape reports for every sibling on the path of the index-th leaf in
+// a chain of the given length whether it is a left sibling.
+func pathShape(leaves, index uint64) []bool {
+	size := gommr.LeafCountToSize(leaves)
+	pos := gommr.LeafIndexToPos(index)
+	shape := make([]bool, 0)
+	height := 0
+	for {
+		if gommr.PosHeight(pos+1) > height {
+			shape = append(shape, true)
+			pos++
+		} else {
+			if pos+gommr.SiblingOffset(height) >= size {
+				break
+			}
+			shape = append(shape, false)
+			pos += gommr.ParentOffset(height)
+		}
+		height++
+	}
+	peaks := gommr.Peaks(size)
+	for i, p := range peaks {
+		if p != pos {
+			continue
+		}
+		if i < len(peaks)-1 {
+			shape = append(shape, false)
+		}
+		for j := i - 1; j >= 0; j-- {
+			shape = append(shape, true)
+		}
+		break
+	}
+	return shape
+}
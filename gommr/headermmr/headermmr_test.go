@@ -0,0 +1,189 @@
+package headermmr
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/go-mmr/gommr"
+	"github.com/go-mmr/gommr/rlp"
+)
+
+// testHeader is a synthetic header. Work stands in for the proof of work
+// actually performed, a valid header has Work >= Difficulty.
+type testHeader struct {
+	Number     uint64
+	Parent     gommr.Hash
+	Difficulty *big.Int
+	Work       *big.Int
+}
+
+func checkWork(index uint64, enc []byte, difficulty *big.Int) error {
+	var h testHeader
+	if err := rlp.DecodeBytes(enc, &h); err != nil {
+		return err
+	}
+	if h.Number != index || h.Difficulty.Cmp(difficulty) != 0 {
+		return errors.New("header does not match leaf")
+	}
+	if h.Work.Cmp(h.Difficulty) < 0 {
+		return errors.New("insufficient work")
+	}
+	return nil
+}
+
+// buildChain appends count headers to m, the headers from forkAt on claim
+// forgedDiff but only carry a tenth of that as work.
+func buildChain(t *testing.T, m *HeaderMMR, count, forkAt uint64, diff, forgedDiff int64) {
+	parent := gommr.Hash{}
+	for i := uint64(0); i < count; i++ {
+		h := testHeader{Number: i, Parent: parent, Difficulty: big.NewInt(diff), Work: big.NewInt(diff)}
+		if i >= forkAt {
+			h.Difficulty = big.NewInt(forgedDiff)
+			h.Work = big.NewInt(forgedDiff / 10)
+		}
+		enc, err := rlp.EncodeToBytes(&h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.AppendEncoded(enc, h.Difficulty); err != nil {
+			t.Fatal(err)
+		}
+		parent = HeaderHash(enc)
+	}
+}
+
+func TestLeafAt(t *testing.T) {
+	m := New()
+	for i := int64(1); i <= 11; i++ {
+		if _, err := m.Append([]uint64{uint64(i)}, big.NewInt(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	x := int64(0)
+	for i := int64(1); i <= 11; i++ {
+		for j := int64(0); j < i; j++ {
+			if got := m.leafAt(big.NewInt(x)); got != uint64(i-1) {
+				t.Fatalf("leafAt(%d) = %d, want %d", x, got, i-1)
+			}
+			x++
+		}
+	}
+	if m.TotalDifficulty().Int64() != x {
+		t.Fatalf("total difficulty %v, want %d", m.TotalDifficulty(), x)
+	}
+}
+
+func TestProveVerify(t *testing.T) {
+	for _, count := range []uint64{1, 2, 3, 7, 100, 1000} {
+		m := New()
+		buildChain(t, m, count, count, 100, 0)
+		proof, err := m.Prove(DefaultParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Verify(m.Root(), m.Len(), proof, DefaultParams, checkWork); err != nil {
+			t.Fatalf("%d headers: %v", count, err)
+		}
+		if err := Verify(gommr.Hash{1}, m.Len(), proof, DefaultParams, checkWork); err == nil {
+			t.Fatalf("%d headers: proof verified against wrong root", count)
+		}
+	}
+}
+
+func TestHeader(t *testing.T) {
+	m := New()
+	buildChain(t, m, 3, 3, 100, 0)
+	if enc, err := m.Header(2); err != nil || len(enc) == 0 {
+		t.Fatalf("header 2: %x %v", enc, err)
+	}
+	if _, err := m.Header(3); err != ErrNoHeader {
+		t.Fatalf("header 3: %v", err)
+	}
+}
+
+func TestProofEncoding(t *testing.T) {
+	m := New()
+	buildChain(t, m, 300, 300, 7, 0)
+	proof, err := m.Prove(DefaultParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := rlp.EncodeToBytes(proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dec Proof
+	if err := rlp.DecodeBytes(enc, &dec); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(m.Root(), m.Len(), &dec, DefaultParams, checkWork); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTamperedProof(t *testing.T) {
+	m := New()
+	buildChain(t, m, 200, 200, 50, 0)
+	root := m.Root()
+
+	proof, _ := m.Prove(DefaultParams)
+	proof.Samples[0].Difficulty = big.NewInt(51)
+	if Verify(root, m.Len(), proof, DefaultParams, nil) == nil {
+		t.Fatal("changed difficulty accepted")
+	}
+
+	proof, _ = m.Prove(DefaultParams)
+	proof.Samples = proof.Samples[1:]
+	if Verify(root, m.Len(), proof, DefaultParams, nil) == nil {
+		t.Fatal("missing sample accepted")
+	}
+
+	// substituting another valid leaf must fail the difficulty range check
+	proof, _ = m.Prove(DefaultParams)
+	other := m.sample((proof.Samples[0].Index + 1) % m.Len())
+	proof.Samples[0] = other
+	if Verify(root, m.Len(), proof, DefaultParams, nil) == nil {
+		t.Fatal("substituted sample accepted")
+	}
+
+	// the leaf count comes from the verifier, not the proof
+	proof, _ = m.Prove(DefaultParams)
+	if err := Verify(root, m.Len()-1, proof, DefaultParams, nil); err != ErrLeaves {
+		t.Fatalf("proof of another length: %v", err)
+	}
+}
+
+// TestForgedFork builds a fork from block 500 whose headers claim ten
+// times the honest difficulty without the work behind it, so the fork
+// matches the honest chain's total difficulty with far fewer blocks.
+func TestForgedFork(t *testing.T) {
+	honest := New()
+	buildChain(t, honest, 1000, 1000, 100, 0)
+	forged := New()
+	buildChain(t, forged, 550, 500, 100, 1000)
+	if honest.TotalDifficulty().Cmp(forged.TotalDifficulty()) != 0 {
+		t.Fatalf("difficulty mismatch: %v != %v", honest.TotalDifficulty(), forged.TotalDifficulty())
+	}
+	proof, err := forged.Prove(DefaultParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the proof is internally consistent ...
+	if err := Verify(forged.Root(), forged.Len(), proof, DefaultParams, nil); err != nil {
+		t.Fatal(err)
+	}
+	// ... but samples land in the forged part of the chain
+	if err := Verify(forged.Root(), forged.Len(), proof, DefaultParams, checkWork); err == nil {
+		t.Fatal("forged fork accepted")
+	}
+	hits := 0
+	for _, s := range proof.Samples {
+		if s.Index >= 500 {
+			hits++
+		}
+	}
+	if hits < len(proof.Samples)/2 {
+		t.Fatalf("only %d of %d samples in forged part", hits, len(proof.Samples))
+	}
+}
@@ -0,0 +1,198 @@
+package headermmr
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/go-mmr/gommr"
+)
+
+var (
+	ErrSampleCount = errors.New("headermmr: wrong number of samples")
+	ErrPathLength  = errors.New("headermmr: wrong path length")
+	ErrRootHash    = errors.New("headermmr: path does not lead to root")
+	ErrDifficulty  = errors.New("headermmr: total difficulty mismatch")
+	ErrBadParams   = errors.New("headermmr: invalid sampling parameters")
+	ErrLeaves      = errors.New("headermmr: proof is for another chain length")
+)
+
+// Params controls the sampling. Samples are drawn from the FlyClient
+// distribution over the difficulty range, which gets denser towards the
+// tip. Delta is the fraction of the most recent difficulty that is
+// sampled uniformly instead.
+type Params struct {
+	Samples int
+	Delta   float64
+}
+
+// DefaultParams are suitable for tests and small chains.
+var DefaultParams = Params{Samples: 64, Delta: 1.0 / 1024}
+
+func (p Params) valid() bool {
+	return p.Samples > 0 && p.Delta > 0 && p.Delta < 1
+}
+
+// Sample is a sampled header together with the siblings linking it to
+// the root.
+type Sample struct {
+	Index      uint64
+	Header     []byte
+	Difficulty *big.Int
+	Path       []Node
+}
+
+// Proof is a non-interactive proof of a chain of Leaves headers with the
+// given total difficulty. Samples holds one entry per drawn sample point
+// followed by the tip of the chain.
+type Proof struct {
+	Leaves     uint64
+	Difficulty *big.Int
+	Samples    []Sample
+}
+
+// HeaderCheck validates a sampled header, typically its proof of work
+// against the claimed difficulty.
+type HeaderCheck func(index uint64, header []byte, difficulty *big.Int) error
+
+// Prove samples the chain seeded by its root and returns the proof.
+func (m *HeaderMMR) Prove(params Params) (*Proof, error) {
+	if !params.valid() {
+		return nil, ErrBadParams
+	}
+	if m.Len() == 0 {
+		return nil, ErrEmpty
+	}
+	root := m.RootNode()
+	points := samplePoints(root.Hash, m.Len(), root.Difficulty, params)
+	proof := &Proof{
+		Leaves:     m.Len(),
+		Difficulty: root.Difficulty,
+		Samples:    make([]Sample, 0, len(points)+1),
+	}
+	for _, x := range points {
+		proof.Samples = append(proof.Samples, m.sample(m.leafAt(x)))
+	}
+	proof.Samples = append(proof.Samples, m.sample(m.Len()-1))
+	return proof, nil
+}
+
+func (m *HeaderMMR) sample(index uint64) Sample {
+	pos := gommr.LeafIndexToPos(index)
+	return Sample{
+		Index:      index,
+		Header:     m.headers[index],
+		Difficulty: m.nodes[pos].Difficulty,
+		Path:       m.path(index),
+	}
+}
+
+// Verify checks proof against root of a chain of leaves headers, both
+// taken from a trusted source. Every sample must recompute root, cover the
+// difficulty point derived from root and pass check, which may be nil.
+func Verify(root gommr.Hash, leaves uint64, proof *Proof, params Params, check HeaderCheck) error {
+	if !params.valid() {
+		return ErrBadParams
+	}
+	if leaves == 0 {
+		return ErrEmpty
+	}
+	if proof.Leaves != leaves {
+		return ErrLeaves
+	}
+	if proof.Difficulty == nil || proof.Difficulty.Sign() <= 0 {
+		return ErrBadDifficulty
+	}
+	points := samplePoints(root, proof.Leaves, proof.Difficulty, params)
+	if len(proof.Samples) != len(points)+1 {
+		return ErrSampleCount
+	}
+	for i, s := range proof.Samples {
+		before, err := verifySample(root, proof, &s)
+		if err != nil {
+			return fmt.Errorf("sample %d: %v", i, err)
+		}
+		if i == len(points) {
+			if s.Index != proof.Leaves-1 {
+				return fmt.Errorf("sample %d: tip has index %d, want %d", i, s.Index, proof.Leaves-1)
+			}
+		} else {
+			end := new(big.Int).Add(before, s.Difficulty)
+			if points[i].Cmp(before) < 0 || points[i].Cmp(end) >= 0 {
+				return fmt.Errorf("sample %d: leaf %d does not cover difficulty %v", i, s.Index, points[i])
+			}
+		}
+		if check != nil {
+			if err := check(s.Index, s.Header, s.Difficulty); err != nil {
+				return fmt.Errorf("sample %d: %v", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// verifySample recomputes the root from s and returns the difficulty of
+// all leaves before it.
+func verifySample(root gommr.Hash, proof *Proof, s *Sample) (*big.Int, error) {
+	if s.Index >= proof.Leaves {
+		return nil, fmt.Errorf("leaf %d out of range", s.Index)
+	}
+	if s.Difficulty == nil || s.Difficulty.Sign() <= 0 {
+		return nil, ErrBadDifficulty
+	}
+	shape := pathShape(proof.Leaves, s.Index)
+	if len(shape) != len(s.Path) {
+		return nil, ErrPathLength
+	}
+	before := new(big.Int)
+	acc := LeafNode(s.Header, s.Difficulty)
+	for i, sib := range s.Path {
+		if sib.Difficulty == nil || sib.Difficulty.Sign() <= 0 {
+			return nil, ErrBadDifficulty
+		}
+		if shape[i] {
+			before.Add(before, sib.Difficulty)
+			acc = Combine(sib, acc)
+		} else {
+			acc = Combine(acc, sib)
+		}
+	}
+	if acc.Hash != root {
+		return nil, ErrRootHash
+	}
+	if acc.Difficulty.Cmp(proof.Difficulty) != 0 {
+		return nil, ErrDifficulty
+	}
+	return before, nil
+}
+
+// samplePoints derives the difficulty sample points from the root. A
+// point is drawn from the FlyClient density 1/((x-1) ln delta) over
+// [0, 1-delta) of the total difficulty by inverting its distribution
+// function, x = 1 - delta^u, with a few points drawn uniformly from the
+// remaining tail.
+func samplePoints(root gommr.Hash, leaves uint64, total *big.Int, params Params) []*big.Int {
+	seed := gommr.RlpHash([]interface{}{root, leaves, total})
+	tail := params.Samples / 8
+	points := make([]*big.Int, 0, params.Samples)
+	for i := 0; i < params.Samples; i++ {
+		h := gommr.RlpHash([]interface{}{seed, uint64(i)})
+		u := float64(new(big.Int).SetBytes(h[:8]).Uint64()>>11) / (1 << 53)
+		var f float64
+		if i < params.Samples-tail {
+			f = 1 - math.Pow(params.Delta, u)
+		} else {
+			f = 1 - params.Delta*u
+		}
+		x, _ := new(big.Float).Mul(new(big.Float).SetInt(total), big.NewFloat(f)).Int(nil)
+		if x.Cmp(total) >= 0 {
+			x.Sub(total, big.NewInt(1))
+		}
+		if x.Sign() < 0 {
+			x.SetInt64(0)
+		}
+		points = append(points, x)
+	}
+	return points
+}
@@ -0,0 +1,251 @@
+package gommr
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// RootEntry is the root of an mmr after a push. Entries replayed from the
+// nodes have a zero Time, the push time is not kept with the nodes.
+type RootEntry struct {
+	LeafCount uint64
+	Root      Hash
+	Time      time.Time
+}
+
+// Size returns the mmr size of the entry.
+func (e RootEntry) Size() uint64 {
+	return LeafCountToSize(e.LeafCount)
+}
+
+// History maps every leaf count of an mmr to its root. It is kept up to
+// date by an MMR opened WithHistory. If a file backs it, the entry of
+// leaf count n lives at offset (n-1)*40 as the root followed by the push
+// time in big endian unix nanoseconds.
+type History struct {
+	lock    sync.RWMutex
+	entries []RootEntry
+	byRoot  map[Hash]uint64
+	file    *os.File
+}
+
+const historyRecord = 40
+
+// NewHistory returns a history kept in memory.
+func NewHistory() *History {
+	return &History{byRoot: make(map[Hash]uint64)}
+}
+
+// OpenHistory opens or creates the history at path, usually next to the
+// node store. A trailing partial entry is dropped.
+func OpenHistory(path string) (*History, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	h := NewHistory()
+	h.file = f
+	n := len(data) / historyRecord
+	if len(data) != n*historyRecord {
+		if err := f.Truncate(int64(n * historyRecord)); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	for i := 0; i < n; i++ {
+		rec := data[i*historyRecord:]
+		e := RootEntry{LeafCount: uint64(i) + 1, Root: BytesToHash(rec[:32])}
+		if nanos := int64(binary.BigEndian.Uint64(rec[32:])); nanos != 0 {
+			e.Time = time.Unix(0, nanos)
+		}
+		h.add(e)
+	}
+	return h, nil
+}
+
+func (h *History) add(e RootEntry) {
+	h.entries = append(h.entries, e)
+	if _, ok := h.byRoot[e.Root]; !ok {
+		h.byRoot[e.Root] = e.LeafCount
+	}
+}
+
+// append adds the entry of the next leaf count.
+func (h *History) append(root Hash, t time.Time) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	e := RootEntry{LeafCount: uint64(len(h.entries)) + 1, Root: root, Time: t}
+	if h.file != nil {
+		var rec [historyRecord]byte
+		copy(rec[:], root[:])
+		if !t.IsZero() {
+			binary.BigEndian.PutUint64(rec[32:], uint64(t.UnixNano()))
+		}
+		if _, err := h.file.WriteAt(rec[:], int64(len(h.entries))*historyRecord); err != nil {
+			return err
+		}
+	}
+	h.add(e)
+	return nil
+}
+
+// truncate drops the entries beyond leafCount.
+func (h *History) truncate(leafCount uint64) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if leafCount >= uint64(len(h.entries)) {
+		return nil
+	}
+	if h.file != nil {
+		if err := h.file.Truncate(int64(leafCount) * historyRecord); err != nil {
+			return err
+		}
+	}
+	for _, e := range h.entries[leafCount:] {
+		if h.byRoot[e.Root] == e.LeafCount {
+			delete(h.byRoot, e.Root)
+		}
+	}
+	h.entries = h.entries[:leafCount]
+	return nil
+}
+
+// Len returns the number of entries, the leaf count of the last one.
+func (h *History) Len() uint64 {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return uint64(len(h.entries))
+}
+
+// ByLeafCount returns the entry of the mmr with leafCount leaves.
+func (h *History) ByLeafCount(leafCount uint64) (RootEntry, bool) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	if leafCount == 0 || leafCount > uint64(len(h.entries)) {
+		return RootEntry{}, false
+	}
+	return h.entries[leafCount-1], true
+}
+
+// BySize returns the entry of the mmr of size nodes.
+func (h *History) BySize(size uint64) (RootEntry, bool) {
+	if !ValidSize(size) {
+		return RootEntry{}, false
+	}
+	return h.ByLeafCount(SizeToLeafCount(size))
+}
+
+// ByRoot returns the first entry with root.
+func (h *History) ByRoot(root Hash) (RootEntry, bool) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	n, ok := h.byRoot[root]
+	if !ok {
+		return RootEntry{}, false
+	}
+	return h.entries[n-1], true
+}
+
+// Range returns the entries pushed at or after from and before to.
+func (h *History) Range(from, to time.Time) []RootEntry {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	var res []RootEntry
+	for _, e := range h.entries {
+		if !e.Time.IsZero() && !e.Time.Before(from) && e.Time.Before(to) {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// Sync flushes the file to disk.
+func (h *History) Sync() error {
+	if h.file == nil {
+		return nil
+	}
+	return h.file.Sync()
+}
+
+func (h *History) Close() error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.file == nil {
+		return nil
+	}
+	return h.file.Close()
+}
+
+// replay_history brings the history to the size of the mmr, dropping
+// entries the nodes no longer have and adding the missing ones from the
+// roots of earlier sizes.
+func (m *mmr) replay_history() error {
+	count := SizeToLeafCount(m.cur_size)
+	if err := m.history.truncate(count); err != nil {
+		return err
+	}
+	view := *m
+	if last, ok := m.history.ByLeafCount(m.history.Len()); ok {
+		// a history of other nodes is replayed from scratch
+		view.cur_size = last.Size()
+		root, err := view.getRoot()
+		if err != nil {
+			return err
+		}
+		if root != last.Root {
+			if err := m.history.truncate(0); err != nil {
+				return err
+			}
+		}
+	}
+	for n := m.history.Len() + 1; n <= count; n++ {
+		view.cur_size = LeafCountToSize(n)
+		root, err := view.getRoot()
+		if err != nil {
+			return err
+		}
+		if err := m.history.append(root, time.Time{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// record adds the current root to the history.
+func (m *mmr) record() error {
+	root, err := m.getRoot()
+	if err != nil {
+		return err
+	}
+	return m.history.append(root, m.now())
+}
+
+// WithHistory makes the mmr record its root after every push in h. Missing
+// entries are replayed from the nodes when the mmr is opened. A belt
+// keeps no history, opening one with it fails with ErrBeltHistory.
+func WithHistory(h *History) Option {
+	return func(c *config) {
+		c.history = h
+	}
+}
+
+// WithClock sets the time source of the root history, time.Now by default.
+func WithClock(now func() time.Time) Option {
+	return func(c *config) {
+		c.now = now
+	}
+}
+
+// History returns the root history, or nil if the mmr was opened without
+// one.
+func (m *MMR) History() *History {
+	return m.m.history
+}
@@ -0,0 +1,128 @@
+package gommr
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := OpenFileStore(filepath.Join(dir, "nodes"))
+	h, err := OpenHistory(filepath.Join(dir, "roots"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(1700000000, 0)
+	clock := start
+	m, err := NewMMR(store, WithHistory(h), WithClock(func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := make([]Hash, 31)
+	for i := 0; i < 30; i++ {
+		m.Push(leafHash(i))
+		roots[i+1], _ = m.Root()
+	}
+	check := func(h *History, timed bool) {
+		t.Helper()
+		if h.Len() != 30 {
+			t.Fatalf("%d entries", h.Len())
+		}
+		for n := uint64(1); n <= 30; n++ {
+			e, ok := h.ByLeafCount(n)
+			if !ok || e.Root != roots[n] || e.LeafCount != n {
+				t.Fatalf("entry of %d leaves: %+v", n, e)
+			}
+			if timed && !e.Time.Equal(start.Add(time.Duration(n)*time.Second)) {
+				t.Fatalf("entry of %d leaves pushed at %v", n, e.Time)
+			}
+			if e, ok := h.BySize(LeafCountToSize(n)); !ok || e.LeafCount != n {
+				t.Fatalf("entry of size %d: %+v", LeafCountToSize(n), e)
+			}
+			if e, ok := h.ByRoot(roots[n]); !ok || e.LeafCount != n {
+				t.Fatalf("entry of root %x: %+v", roots[n], e)
+			}
+		}
+		if _, ok := h.BySize(LeafCountToSize(5) + 1); ok {
+			t.Fatal("entry of an invalid size")
+		}
+		if _, ok := h.ByLeafCount(31); ok {
+			t.Fatal("entry beyond the mmr")
+		}
+	}
+	check(h, true)
+	got := h.Range(start.Add(10*time.Second), start.Add(15*time.Second))
+	if len(got) != 5 || got[0].LeafCount != 10 || got[4].LeafCount != 14 {
+		t.Fatalf("range %+v", got)
+	}
+
+	m.Rewind(LeafCountToSize(20))
+	if _, ok := h.ByRoot(roots[25]); ok || h.Len() != 20 {
+		t.Fatal("entries kept after rewind")
+	}
+	for i := 20; i < 30; i++ {
+		m.Push(leafHash(i))
+	}
+	store.Close()
+	h.Close()
+
+	// the history is reopened with the nodes, a torn entry is replayed
+	f, _ := os.OpenFile(filepath.Join(dir, "roots"), os.O_RDWR, 0644)
+	f.Truncate(29*historyRecord + 7)
+	f.Close()
+	store, _ = OpenFileStore(filepath.Join(dir, "nodes"))
+	defer store.Close()
+	h, _ = OpenHistory(filepath.Join(dir, "roots"))
+	defer h.Close()
+	if _, err := NewMMR(store, WithHistory(h)); err != nil {
+		t.Fatal(err)
+	}
+	check(h, false)
+	if e, _ := h.ByLeafCount(30); !e.Time.IsZero() {
+		t.Fatal("replayed entry has a push time")
+	}
+	if e, _ := h.ByLeafCount(29); e.Time.IsZero() {
+		t.Fatal("recorded entry lost its push time")
+	}
+
+	// a missing history is replayed in full
+	h2 := NewHistory()
+	if _, err := NewMMR(store, WithHistory(h2)); err != nil {
+		t.Fatal(err)
+	}
+	check(h2, false)
+
+	// so is one of other nodes
+	other := NewHistory()
+	om, _ := NewMMR(NewMemStore(), WithHistory(other))
+	for i := 0; i < 10; i++ {
+		om.Push(leafHash(i + 100))
+	}
+	if _, err := NewMMR(store, WithHistory(other)); err != nil {
+		t.Fatal(err)
+	}
+	check(other, false)
+}
+
+func TestHistoryFailedPush(t *testing.T) {
+	dir := t.TempDir()
+	h, _ := OpenHistory(filepath.Join(dir, "roots"))
+	m, _ := NewMMR(NewMemStore(), WithHistory(h))
+	for i := 0; i < 3; i++ {
+		m.Push(leafHash(i))
+	}
+	root, _ := m.Root()
+	// a closed history fails to record, the push is taken back
+	h.Close()
+	if _, err := m.Push(leafHash(3)); err == nil {
+		t.Fatal("push recorded in a closed history")
+	}
+	if r, _ := m.Root(); m.Size() != LeafCountToSize(3) || m.Store().Size() != m.Size() || r != root {
+		t.Fatalf("failed push left %d nodes", m.Store().Size())
+	}
+}
@@ -0,0 +1,77 @@
+package gommr
+
+import "time"
+
+// Merger defines how nodes of an mmr are combined. Merge returns the
+// parent of left and right, which is written at pos. BagPeaks combines a
+// peak with the bag of all peaks to its right in an mmr, or belt, of
+// mmrSize nodes.
+type Merger interface {
+	Merge(pos uint64, left, right Hash) Hash
+	BagPeaks(mmrSize uint64, left, right Hash) Hash
+}
+
+type rlpMerger struct{}
+
+func (rlpMerger) Merge(pos uint64, left, right Hash) Hash {
+	return merge2(left, right)
+}
+
+// BagPeaks puts the right hand side first, as the nervos crate does.
+func (rlpMerger) BagPeaks(mmrSize uint64, left, right Hash) Hash {
+	return merge2(right, left)
+}
+
+// DefaultMerger hashes the rlp list of both children with sha3-256.
+var DefaultMerger Merger = rlpMerger{}
+
+// Option configures an MMR.
+type Option func(*config)
+
+// config holds the options of New, NewMMR and NewBelt.
+type config struct {
+	merger  Merger
+	scheme  string
+	belt    bool
+	history *History
+	now     func() time.Time
+}
+
+// newConfig applies opts over the defaults.
+func newConfig(opts []Option) (*config, error) {
+	c := &config{merger: DefaultMerger, scheme: "rlp", now: time.Now}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.merger == nil {
+		return nil, ErrUnknownScheme
+	}
+	return c, nil
+}
+
+// WithMerger makes the mmr combine nodes with merger. Its dumps name no
+// scheme unless WithScheme is given as well.
+func WithMerger(merger Merger) Option {
+	return func(c *config) {
+		c.merger = merger
+		c.scheme = ""
+	}
+}
+
+// WithScheme makes the mmr combine nodes with the merger of the registered
+// scheme name, which its dumps record. NewMMR fails with ErrUnknownScheme
+// if name is not registered.
+func WithScheme(name string) Option {
+	return func(c *config) {
+		s, _ := LookupScheme(name)
+		c.merger = s.Merger
+		c.scheme = name
+	}
+}
+
+// WithBelt makes New open a merkle mountain belt instead of an mmr.
+func WithBelt() Option {
+	return func(c *config) {
+		c.belt = true
+	}
+}
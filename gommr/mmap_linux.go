@@ -0,0 +1,225 @@
+//go:build linux
+
+package gommr
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+var ErrMmapFile = errors.New("gommr: not an mmap store file")
+
+// The file of an MmapStore starts with a 32 byte header, the magic and the
+// number of stored positions, followed by the hash of pos at offset
+// (pos+1)*32. The file is grown in chunks ahead of the stored positions.
+const mmapMagic = "gommrmap"
+
+// mmapChunk is the number of bytes the file grows by at least.
+var mmapChunk = 4 << 20
+
+// MmapStore keeps hashes in a memory mapped file. Reads copy straight from
+// the mapping, and View hands out the mapped bytes themselves, so proofs
+// are generated without a syscall per node.
+//
+// Growing the file maps it again. Older mappings are only unmapped on
+// Close, so views taken before a remap stay valid; they share the pages of
+// the file and see the same hashes as the current mapping.
+//
+// An append survives a crash of the process once it returns, the page
+// cache keeps it. Only Sync makes appends survive a power loss: the kernel
+// writes dirty pages back in any order, so before a Sync the size on disk
+// may count hashes that never got there.
+type MmapStore struct {
+	lock    sync.RWMutex
+	file    *os.File
+	data    []byte
+	retired [][]byte
+	size    uint64
+}
+
+// OpenMmapStore opens or creates the store at path.
+func OpenMmapStore(path string) (*MmapStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := &MmapStore{file: f}
+	if err := s.open(); err != nil {
+		s.unmap()
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *MmapStore) open() error {
+	info, err := s.file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		if err := s.grow(32); err != nil {
+			return err
+		}
+		copy(s.data, mmapMagic)
+		return nil
+	}
+	if info.Size() < 32 || info.Size()%32 != 0 {
+		return ErrMmapFile
+	}
+	if err := s.remap(int(info.Size())); err != nil {
+		return err
+	}
+	if string(s.data[:8]) != mmapMagic {
+		return ErrMmapFile
+	}
+	size := binary.BigEndian.Uint64(s.data[8:])
+	if size > uint64(len(s.data)/32-1) || size != 0 && !ValidSize(size) {
+		return ErrMmapFile
+	}
+	s.size = size
+	return nil
+}
+
+// grow makes room for n bytes, growing the file by half of its size but at
+// least by a chunk.
+func (s *MmapStore) grow(n int) error {
+	if n <= len(s.data) {
+		return nil
+	}
+	length := len(s.data) + len(s.data)/2
+	if length < len(s.data)+mmapChunk {
+		length = len(s.data) + mmapChunk
+	}
+	if length < n {
+		length = n
+	}
+	length = (length + 31) &^ 31
+	if err := s.file.Truncate(int64(length)); err != nil {
+		return err
+	}
+	return s.remap(length)
+}
+
+func (s *MmapStore) remap(length int) error {
+	data, err := syscall.Mmap(int(s.file.Fd()), 0, length, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	if s.data != nil {
+		s.retired = append(s.retired, s.data)
+	}
+	s.data = data
+	return nil
+}
+
+func (s *MmapStore) unmap() error {
+	var err error
+	for _, data := range append(s.retired, s.data) {
+		if data == nil {
+			continue
+		}
+		if uerr := syscall.Munmap(data); err == nil {
+			err = uerr
+		}
+	}
+	s.data, s.retired = nil, nil
+	return err
+}
+
+func (s *MmapStore) Get(pos uint64) (Hash, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if pos >= s.size {
+		return Hash{}, ErrOutOfRange
+	}
+	return BytesToHash(s.data[(pos+1)*32 : (pos+2)*32]), nil
+}
+
+// View returns the hash at pos as a slice of the mapping. It stays valid
+// until Close; a view of a position dropped by Truncate shows whatever is
+// appended there later.
+func (s *MmapStore) View(pos uint64) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if pos >= s.size {
+		return nil, ErrOutOfRange
+	}
+	return s.data[(pos+1)*32 : (pos+2)*32 : (pos+2)*32], nil
+}
+
+func (s *MmapStore) Append(pos uint64, hashes []Hash) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if pos != s.size {
+		return ErrBadAppend
+	}
+	end := pos + uint64(len(hashes))
+	if err := s.grow(int(end+1) * 32); err != nil {
+		return err
+	}
+	for i, h := range hashes {
+		copy(s.data[(pos+uint64(i)+1)*32:], h[:])
+	}
+	// the size goes last, a crash of the process before it leaves the
+	// append out; the pages may still reach the disk in another order
+	binary.BigEndian.PutUint64(s.data[8:], end)
+	s.size = end
+	return nil
+}
+
+func (s *MmapStore) Size() uint64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.size
+}
+
+// Truncate only moves the size, the file keeps its length so that no view
+// points past its end.
+func (s *MmapStore) Truncate(size uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if size > s.size {
+		return ErrOutOfRange
+	}
+	binary.BigEndian.PutUint64(s.data[8:], size)
+	s.size = size
+	return nil
+}
+
+func (s *MmapStore) Rewrite(pos uint64, h Hash) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if pos >= s.size {
+		return ErrOutOfRange
+	}
+	copy(s.data[(pos+1)*32:], h[:])
+	return nil
+}
+
+// Sync flushes the mapping to disk, after which the appends so far
+// survive a power loss.
+func (s *MmapStore) Sync() error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	_, _, errno := syscall.Syscall(syscall.SYS_MSYNC, uintptr(unsafe.Pointer(&s.data[0])), uintptr(len(s.data)), syscall.MS_SYNC)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Close unmaps the file. Views must not be used afterwards.
+func (s *MmapStore) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	err := s.unmap()
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+//go:build linux
+
+package gommr
+
+import (
+	"bytes"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestMmapStore(t *testing.T) {
+	defer func(chunk int) { mmapChunk = chunk }(mmapChunk)
+	mmapChunk = 1024
+
+	path := filepath.Join(t.TempDir(), "nodes")
+	store, err := OpenMmapStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := buildMMR(t, NewMemStore(), 2000)
+	m := buildMMR(t, store, 10)
+	first, _ := store.View(0)
+
+	// readers hold views and look up hashes while pushes remap the file
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				size := store.Size()
+				for pos := uint64(0); pos < size; pos += 7 {
+					v, err := store.View(pos)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					want, _ := ref.Get(pos)
+					if !bytes.Equal(v, want[:]) {
+						t.Errorf("view of %d differs", pos)
+						return
+					}
+				}
+			}
+		}()
+	}
+	for i := 10; i < 2000; i++ {
+		m.Push(leafHash(i))
+	}
+	close(done)
+	wg.Wait()
+	if len(store.retired) == 0 {
+		t.Fatal("file was never remapped")
+	}
+	if want, _ := ref.Get(0); !bytes.Equal(first, want[:]) {
+		t.Fatal("view from before the remaps changed")
+	}
+
+	want, _ := ref.Root()
+	root, _ := m.Root()
+	proof, err := m.GenProof(LeafIndexToPos(1234))
+	if err != nil || root != want || !proof.Verify(root, LeafIndexToPos(1234), leafHash(1234)) {
+		t.Fatalf("root %x, want %x, proof %v", root, want, err)
+	}
+
+	m.Rewind(LeafCountToSize(1500))
+	store.Close()
+	store, err = OpenMmapStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	m = buildMMR(t, store, 1500)
+	want, _ = ref.RootAt(LeafCountToSize(1500))
+	if got, _ := m.Root(); got != want || m.LeafCount() != 1500 {
+		t.Fatalf("reopened at %d leaves, root %x, want %x", m.LeafCount(), got, want)
+	}
+}
@@ -0,0 +1,31 @@
+//go:build !linux
+
+package gommr
+
+import "errors"
+
+var (
+	ErrMmapFile = errors.New("gommr: not an mmap store file")
+	ErrNoMmap   = errors.New("gommr: mmap store is only supported on linux")
+)
+
+// MmapStore is only available on linux, OpenMmapStore fails elsewhere.
+type MmapStore struct {
+	Store
+}
+
+func OpenMmapStore(path string) (*MmapStore, error) {
+	return nil, ErrNoMmap
+}
+
+func (s *MmapStore) View(pos uint64) ([]byte, error) {
+	return nil, ErrNoMmap
+}
+
+func (s *MmapStore) Sync() error {
+	return ErrNoMmap
+}
+
+func (s *MmapStore) Close() error {
+	return ErrNoMmap
+}
@@ -6,6 +6,7 @@ import (
 	// "fmt"
 	// "math/big"
 	"bytes"
+	"time"
 
 	"github.com/go-mmr/gommr/rlp"
 	"golang.org/x/crypto/sha3"
@@ -63,16 +64,45 @@ func newMerkleProof(mmrSize uint64, proof []Hash) *MerkleProof {
 		proofs:  proof,
 	}
 }
+
+// NewMerkleProof builds a proof from its parts, e.g. after decoding.
+func NewMerkleProof(mmrSize uint64, proof []Hash) *MerkleProof {
+	return newMerkleProof(mmrSize, proof)
+}
+
+// MmrSize returns the size of the mmr the proof was generated for.
+func (m *MerkleProof) MmrSize() uint64 { return m.mmrSize }
+
+// Proofs returns the sibling and peak hashes of the proof.
+func (m *MerkleProof) Proofs() []Hash { return m.proofs }
+
+// Verify reports whether leaf_hash at pos leads to root.
+func (m *MerkleProof) Verify(root Hash, pos uint64, leaf_hash Hash) bool {
+	return m.verify(root, pos, leaf_hash)
+}
+
 func (m *MerkleProof) verify(root Hash, pos uint64, leaf_hash Hash) bool {
+	return m.verify_with(DefaultMerger, root, pos, leaf_hash)
+}
+
+// VerifyWith is like Verify for an mmr built with merger.
+func (m *MerkleProof) VerifyWith(merger Merger, root Hash, pos uint64, leaf_hash Hash) bool {
+	return m.verify_with(merger, root, pos, leaf_hash)
+}
+
+func (m *MerkleProof) verify_with(merger Merger, root Hash, pos uint64, leaf_hash Hash) bool {
+	if pos >= m.mmrSize {
+		return false
+	}
 	peaks := get_peaks(m.mmrSize)
 	height := 0
 	for _, proof := range m.proofs {
 		// verify bagging peaks
 		if pos_in_peaks(pos, peaks) {
 			if pos == peaks[len(peaks)-1] {
-				leaf_hash = merge2(leaf_hash, proof)
+				leaf_hash = merger.BagPeaks(m.mmrSize, proof, leaf_hash)
 			} else {
-				leaf_hash = merge2(proof, leaf_hash)
+				leaf_hash = merger.BagPeaks(m.mmrSize, leaf_hash, proof)
 				pos = peaks[len(peaks)-1]
 			}
 			continue
@@ -81,11 +111,11 @@ func (m *MerkleProof) verify(root Hash, pos uint64, leaf_hash Hash) bool {
 		pos_height, next_height := pos_height_in_tree(pos), pos_height_in_tree(pos+1)
 		if next_height > pos_height {
 			// we are in right child
-			leaf_hash = merge2(proof, leaf_hash)
 			pos += 1
+			leaf_hash = merger.Merge(pos, proof, leaf_hash)
 		} else {
-			leaf_hash = merge2(leaf_hash, proof)
 			pos += parent_offset(height)
+			leaf_hash = merger.Merge(pos, leaf_hash, proof)
 		}
 		height += 1
 	}
@@ -93,8 +123,13 @@ func (m *MerkleProof) verify(root Hash, pos uint64, leaf_hash Hash) bool {
 }
 
 type mmr struct {
-	values   []*Node
+	store    Store
+	merger   Merger
 	cur_size uint64
+	// scheme names the merger in dumps, set by WithScheme
+	scheme  string
+	history *History
+	now     func() time.Time
 }
 
 //              14
@@ -110,49 +145,98 @@ type mmr struct {
 //    0   1 3
 
 func new_mmr() *mmr {
+	return new_mmr_with_store(NewMemStore())
+}
+func new_mmr_with_store(store Store) *mmr {
 	return &mmr{
-		values:   make([]*Node, 0, 0),
-		cur_size: 0,
+		store:    store,
+		merger:   DefaultMerger,
+		scheme:   "rlp",
+		cur_size: store.Size(),
+		now:      time.Now,
+	}
+}
+
+func (m *mmr) get(pos uint64) (Hash, error) {
+	if pos >= m.cur_size {
+		return Hash{}, ErrOutOfRange
 	}
+	return m.store.Get(pos)
 }
 
-func (m *mmr) push(n *Node) *Node {
+func (m *mmr) push(n *Node) (*Node, error) {
 	height, pos := 0, m.cur_size
 	n.index = pos
-	m.values = append(m.values, n)
+	batch := []Hash{n.getHash()}
 	for pos_height_in_tree(pos+1) > height {
 		pos++
 		// calculate pos of left child and right child
 		left_pos := pos - parent_offset(height)
-		right_pos := left_pos + sibling_offset(height)
-		left, right := m.values[left_pos], m.values[right_pos]
-		parent := &Node{index: pos}
-		merge(parent, left, right)
-		m.values = append(m.values, parent)
+		left, err := m.store.Get(left_pos)
+		if err != nil {
+			return nil, err
+		}
+		right := batch[len(batch)-1]
+		batch = append(batch, m.merger.Merge(pos, left, right))
 		height++
 	}
+	size := m.cur_size
+	if err := m.store.Append(size, batch); err != nil {
+		return nil, err
+	}
 	m.cur_size = pos + 1
-	return n
+	if m.history != nil {
+		if err := m.record(); err != nil {
+			// the push fails as a whole, take the nodes back
+			if terr := m.store.Truncate(size); terr != nil {
+				return nil, terr
+			}
+			m.cur_size = size
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// rewind drops every node from size on, size has to be a valid mmr size.
+func (m *mmr) rewind(size uint64) error {
+	if size > m.cur_size || !ValidSize(size) && size != 0 {
+		return ErrBadSize
+	}
+	if err := m.store.Truncate(size); err != nil {
+		return err
+	}
+	if m.history != nil {
+		if err := m.history.truncate(SizeToLeafCount(size)); err != nil {
+			return err
+		}
+	}
+	m.cur_size = size
+	return nil
 }
 
 // func (m *mmr) pop() *Node {
 
 // }
 // func (m *mmr) getLast()
-func (m *mmr) getRoot() Hash {
+func (m *mmr) getRoot() (Hash, error) {
 	if m.cur_size == 0 {
-		return Hash{0}
+		return Hash{0}, nil
 	}
 	if m.cur_size == 1 {
-		return m.values[0].getHash()
+		return m.get(0)
 	}
 	return m.bag_rhs_peaks(0, get_peaks(m.cur_size))
 }
-func (m *mmr) bag_rhs_peaks(pos uint64, peaks []uint64) Hash {
+func (m *mmr) bag_rhs_peaks(pos uint64, peaks []uint64) (Hash, error) {
 	rhs_peak_hashes := make([]Hash, 0, 0)
 	for _, v := range peaks {
 		if v > pos {
-			rhs_peak_hashes = append(rhs_peak_hashes, m.values[v].getHash())
+			h, err := m.get(v)
+			if err != nil {
+				return Hash{}, err
+			}
+			rhs_peak_hashes = append(rhs_peak_hashes, h)
 		}
 	}
 	for len(rhs_peak_hashes) > 1 {
@@ -162,48 +246,57 @@ func (m *mmr) bag_rhs_peaks(pos uint64, peaks []uint64) Hash {
 		last = len(rhs_peak_hashes) - 1
 		left := rhs_peak_hashes[last]
 		rhs_peak_hashes = rhs_peak_hashes[:last]
-		rhs_peak_hashes = append(rhs_peak_hashes, merge2(right, left))
+		rhs_peak_hashes = append(rhs_peak_hashes, m.merger.BagPeaks(m.cur_size, left, right))
 	}
 	if len(rhs_peak_hashes) == 1 {
-		return rhs_peak_hashes[0]
+		return rhs_peak_hashes[0], nil
 	} else {
-		return Hash{0}
+		return Hash{0}, nil
 	}
 }
-func (m *mmr) gen_proof(pos uint64) *MerkleProof {
+func (m *mmr) gen_proof(pos uint64) (*MerkleProof, error) {
+	if pos >= m.cur_size {
+		return nil, ErrOutOfRange
+	}
 	proofs := make([]Hash, 0, 0)
 	height := 0
 	for pos < m.cur_size {
 		pos_height, next_height := pos_height_in_tree(pos), pos_height_in_tree(pos+1)
+		var sib_pos uint64
 		if next_height > pos_height {
 			// get left child sib
-			sib_pos := pos - sibling_offset(height)
+			sib_pos = pos - sibling_offset(height)
 			// break if sib is out of mmr
 			if sib_pos >= m.cur_size {
 				break
 			}
-			proofs = append(proofs, m.values[sib_pos].getHash())
 			// goto parent node
 			pos = pos + 1
 		} else {
 			// get right child
-			sib_pos := pos + sibling_offset(height)
+			sib_pos = pos + sibling_offset(height)
 			// break if sib is out of mmr
 			if sib_pos >= m.cur_size {
 				break
 			}
-			proofs = append(proofs, m.values[sib_pos].getHash())
 			// goto parent node
-			next_pos := pos + parent_offset(height)
-			pos = next_pos
+			pos = pos + parent_offset(height)
+		}
+		sib, err := m.get(sib_pos)
+		if err != nil {
+			return nil, err
 		}
+		proofs = append(proofs, sib)
 		height += 1
 	}
 	// now pos is peak of the mountain(because pos can't find a sibling)
 	peak_pos := pos
 	peaks := get_peaks(m.cur_size)
 	// bagging rhs peaks into one hash
-	rhs_peak_hash := m.bag_rhs_peaks(peak_pos, peaks)
+	rhs_peak_hash, err := m.bag_rhs_peaks(peak_pos, peaks)
+	if err != nil {
+		return nil, err
+	}
 	if !equal_hash(rhs_peak_hash, Hash{0}) {
 		proofs = append(proofs, rhs_peak_hash)
 	}
@@ -211,8 +304,12 @@ func (m *mmr) gen_proof(pos uint64) *MerkleProof {
 	for i := len(peaks) - 1; i >= 0; i-- {
 		p := peaks[i]
 		if p < pos {
-			proofs = append(proofs, m.values[p].getHash())
+			h, err := m.get(p)
+			if err != nil {
+				return nil, err
+			}
+			proofs = append(proofs, h)
 		}
 	}
-	return newMerkleProof(m.cur_size, proofs)
+	return newMerkleProof(m.cur_size, proofs), nil
 }
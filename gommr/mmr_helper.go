@@ -95,3 +95,51 @@ func pos_in_peaks(pos uint64, peaks []uint64) bool {
 	}
 	return false
 }
+
+// PosHeight returns the height of the node at pos, leaves have height 0.
+func PosHeight(pos uint64) int {
+	return pos_height_in_tree(pos)
+}
+
+// ParentOffset returns the distance from a left child at height to its parent.
+func ParentOffset(height int) uint64 {
+	return parent_offset(height)
+}
+
+// SiblingOffset returns the distance between two siblings at height.
+func SiblingOffset(height int) uint64 {
+	return sibling_offset(height)
+}
+
+// Peaks returns the positions of the peaks of an mmr with mmrSize nodes,
+// ordered from left to right.
+func Peaks(mmrSize uint64) []uint64 {
+	if mmrSize == 0 {
+		return nil
+	}
+	return get_peaks(mmrSize)
+}
+
+// LeafIndexToPos returns the position of the index-th leaf.
+func LeafIndexToPos(index uint64) uint64 {
+	return 2*index - uint64(bits.OnesCount64(index))
+}
+
+// LeafCountToSize returns the mmr size after count leaves were pushed.
+func LeafCountToSize(count uint64) uint64 {
+	return 2*count - uint64(bits.OnesCount64(count))
+}
+
+// SizeToLeafCount returns the number of leaves of an mmr with mmrSize nodes.
+func SizeToLeafCount(mmrSize uint64) uint64 {
+	count := uint64(0)
+	for _, p := range Peaks(mmrSize) {
+		count += uint64(1) << uint64(pos_height_in_tree(p))
+	}
+	return count
+}
+
+// ValidSize reports whether mmrSize is the size of an mmr built by push.
+func ValidSize(mmrSize uint64) bool {
+	return LeafCountToSize(SizeToLeafCount(mmrSize)) == mmrSize
+}
@@ -21,15 +21,16 @@ func run_mmr(count int,proof_pos uint64)  {
 	positions := make([]*Node,0,0)
 	
 	for i:=0;i<count;i++ {
-		positions = append(positions,mmr.push(&Node{
+		n, _ := mmr.push(&Node{
 			value:	BytesToHash(IntToBytes(i)),
-		}))
+		})
+		positions = append(positions,n)
 	}
-	merkle_root := mmr.getRoot()
+	merkle_root, _ := mmr.getRoot()
 	// proof
     pos := positions[proof_pos].index
     // generate proof for proof_elem
-    proof := mmr.gen_proof(pos)
+    proof, _ := mmr.gen_proof(pos)
     // verify proof
 	result := proof.verify(merkle_root, pos,positions[proof_pos].getHash())
 	fmt.Println("result:",result)
@@ -37,4 +38,27 @@ func run_mmr(count int,proof_pos uint64)  {
 func Test01(t *testing.T)  {
 	run_mmr(100,30)
 	fmt.Println("finish")
-}
\ No newline at end of file
+}
+func TestPositions(t *testing.T) {
+	m := new_mmr()
+	for i := uint64(0); i < 100; i++ {
+		n, err := m.push(&Node{value: BytesToHash(IntToBytes(int(i)))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n.index != LeafIndexToPos(i) {
+			t.Fatalf("leaf %d at %d, want %d", i, n.index, LeafIndexToPos(i))
+		}
+		if m.cur_size != LeafCountToSize(i+1) || SizeToLeafCount(m.cur_size) != i+1 {
+			t.Fatalf("size mismatch after %d leaves", i+1)
+		}
+		for size := LeafCountToSize(i) + 1; size < m.cur_size; size++ {
+			if ValidSize(size) {
+				t.Fatalf("size %d reported valid", size)
+			}
+		}
+		if !ValidSize(m.cur_size) {
+			t.Fatalf("size %d reported invalid", m.cur_size)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Package mmrsync finds where two mmrs diverge and brings a local mmr up
+// to a remote one it is a prefix of.
+//
+// The peaks of both at the smaller leaf count are compared first: equal
+// peaks cover equal leaves, so the first differing peak bounds the
+// divergence to its mountain. The largest common leaf count is then found
+// by a binary search over the roots of earlier sizes within it. The
+// remote is reached through the Remote interface, any transport that can
+// answer for the roots and leaves of earlier sizes will do.
+package mmrsync
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/go-mmr/gommr"
+)
+
+var (
+	ErrFork     = errors.New("mmrsync: the mmrs diverge")
+	ErrBadReply = errors.New("mmrsync: remote sent leaves that do not match its root")
+)
+
+// MaxBatch bounds the leaves fetched at once.
+const MaxBatch = 1024
+
+// Remote is the other mmr, with sizes given as leaf counts.
+type Remote interface {
+	LeafCount() (uint64, error)
+	// Peaks returns the peak hashes of the mmr of leafCount leaves from
+	// left to right.
+	Peaks(leafCount uint64) ([]gommr.Hash, error)
+	// Root returns the root of the mmr of leafCount leaves.
+	Root(leafCount uint64) (gommr.Hash, error)
+	// Leaves returns the leaf hashes from start up to end.
+	Leaves(start, end uint64) ([]gommr.Hash, error)
+}
+
+// Local serves an mmr as a Remote, for in-process peers and the local
+// side of a comparison.
+type Local struct {
+	M *gommr.MMR
+}
+
+func (l Local) LeafCount() (uint64, error) {
+	return l.M.LeafCount(), nil
+}
+
+func (l Local) Peaks(leafCount uint64) ([]gommr.Hash, error) {
+	if leafCount > l.M.LeafCount() {
+		return nil, gommr.ErrOutOfRange
+	}
+	var res []gommr.Hash
+	if leafCount == 0 {
+		return res, nil
+	}
+	for _, pos := range gommr.Peaks(gommr.LeafCountToSize(leafCount)) {
+		h, err := l.M.Get(pos)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, h)
+	}
+	return res, nil
+}
+
+func (l Local) Root(leafCount uint64) (gommr.Hash, error) {
+	return l.M.RootAt(gommr.LeafCountToSize(leafCount))
+}
+
+func (l Local) Leaves(start, end uint64) ([]gommr.Hash, error) {
+	if start > end || end > l.M.LeafCount() {
+		return nil, gommr.ErrOutOfRange
+	}
+	res := make([]gommr.Hash, 0, end-start)
+	for i := start; i < end; i++ {
+		h, err := l.M.Get(gommr.LeafIndexToPos(i))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, h)
+	}
+	return res, nil
+}
+
+// Result describes two mmrs. Common is the largest leaf count at which
+// they agree. If it is below both leaf counts they fork, and Common is the
+// index of the first differing leaf.
+type Result struct {
+	LocalLeaves  uint64
+	RemoteLeaves uint64
+	Common       uint64
+	Fetched      uint64
+}
+
+// Forked reports whether neither mmr is a prefix of the other.
+func (r *Result) Forked() bool {
+	return r.Common < r.LocalLeaves && r.Common < r.RemoteLeaves
+}
+
+// Compare finds the largest common leaf count of local and remote.
+func Compare(local *gommr.MMR, remote Remote) (*Result, error) {
+	lc := local.LeafCount()
+	rc, err := remote.LeafCount()
+	if err != nil {
+		return nil, err
+	}
+	r := &Result{LocalLeaves: lc, RemoteLeaves: rc}
+	n := lc
+	if rc < n {
+		n = rc
+	}
+	if r.Common, err = common(Local{local}, remote, n); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// common returns the largest leaf count up to n at which a and b agree.
+func common(a, b Remote, n uint64) (uint64, error) {
+	if n == 0 {
+		return 0, nil
+	}
+	pa, err := a.Peaks(n)
+	if err != nil {
+		return 0, err
+	}
+	pb, err := b.Peaks(n)
+	if err != nil {
+		return 0, err
+	}
+	if len(pa) != len(pb) {
+		return 0, ErrBadReply
+	}
+	// lo leaves are known to agree, the mmrs differ at end leaves
+	var lo, end uint64
+	for i, h := 0, 63; h >= 0; h-- {
+		if n&(1<<uint(h)) == 0 {
+			continue
+		}
+		if pa[i] != pb[i] {
+			end = lo + 1<<uint(h)
+			break
+		}
+		lo += 1 << uint(h)
+		i++
+	}
+	if lo == n {
+		return n, nil
+	}
+	var ferr error
+	k := sort.Search(int(end-lo), func(i int) bool {
+		if ferr != nil {
+			return true
+		}
+		count := lo + 1 + uint64(i)
+		ra, err := a.Root(count)
+		if err != nil {
+			ferr = err
+			return true
+		}
+		rb, err := b.Root(count)
+		if err != nil {
+			ferr = err
+			return true
+		}
+		return ra != rb
+	})
+	if ferr != nil {
+		return 0, ferr
+	}
+	return lo + uint64(k), nil
+}
+
+// Sync compares local with remote and, if local is a prefix of it,
+// appends the missing leaves, checking the root after every batch. It
+// returns ErrFork, along with the result, if the mmrs diverge.
+func Sync(local *gommr.MMR, remote Remote) (*Result, error) {
+	r, err := Compare(local, remote)
+	if err != nil {
+		return nil, err
+	}
+	if r.Forked() {
+		return r, ErrFork
+	}
+	for count := r.LocalLeaves; count < r.RemoteLeaves; {
+		end := count + MaxBatch
+		if end > r.RemoteLeaves {
+			end = r.RemoteLeaves
+		}
+		leaves, err := remote.Leaves(count, end)
+		if err != nil {
+			return r, err
+		}
+		want, err := remote.Root(end)
+		if err != nil {
+			return r, err
+		}
+		size := local.Size()
+		if uint64(len(leaves)) != end-count {
+			return r, ErrBadReply
+		}
+		for _, leaf := range leaves {
+			if _, err := local.Push(leaf); err != nil {
+				local.Rewind(size)
+				return r, err
+			}
+		}
+		if root, err := local.Root(); err != nil || root != want {
+			local.Rewind(size)
+			if err == nil {
+				err = ErrBadReply
+			}
+			return r, err
+		}
+		r.Fetched += end - count
+		count = end
+	}
+	return r, nil
+}
@@ -0,0 +1,101 @@
+package mmrsync
+
+import (
+	"testing"
+
+	"github.com/go-mmr/gommr"
+)
+
+func build(t *testing.T, count int, fork int) *gommr.MMR {
+	m, err := gommr.NewMMR(gommr.NewMemStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < count; i++ {
+		leaf := gommr.RlpHash(uint64(i))
+		if i >= fork {
+			leaf[0] ^= 1
+		}
+		m.Push(leaf)
+	}
+	return m
+}
+
+// counting counts the root requests and can tamper with leaves.
+type counting struct {
+	Local
+	roots  int
+	tamper bool
+}
+
+func (c *counting) Root(leafCount uint64) (gommr.Hash, error) {
+	c.roots++
+	return c.Local.Root(leafCount)
+}
+
+func (c *counting) Leaves(start, end uint64) ([]gommr.Hash, error) {
+	leaves, err := c.Local.Leaves(start, end)
+	if c.tamper && len(leaves) > 0 {
+		leaves[len(leaves)-1][0] ^= 1
+	}
+	return leaves, err
+}
+
+func TestCompare(t *testing.T) {
+	for _, tc := range []struct{ local, remote, fork int }{
+		{0, 0, 0}, {0, 5, 100}, {5, 0, 100}, {13, 13, 100}, {13, 40, 100}, {40, 13, 100},
+		{13, 13, 0}, {13, 13, 12}, {64, 64, 31}, {64, 64, 32}, {100, 77, 50}, {77, 100, 76},
+		{1000, 1000, 513}, {1000, 3000, 999},
+	} {
+		local := build(t, tc.local, 1<<30)
+		remote := &counting{Local: Local{build(t, tc.remote, tc.fork)}}
+		r, err := Compare(local, remote)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := uint64(tc.local)
+		if tc.remote < tc.local {
+			want = uint64(tc.remote)
+		}
+		if uint64(tc.fork) < want {
+			want = uint64(tc.fork)
+		}
+		if r.Common != want || r.Forked() != (want < uint64(tc.local) && want < uint64(tc.remote)) {
+			t.Fatalf("%+v: result %+v", tc, r)
+		}
+		if remote.roots > 11 {
+			t.Fatalf("%+v: %d root requests", tc, remote.roots)
+		}
+	}
+}
+
+func TestSync(t *testing.T) {
+	local := build(t, 100, 1<<30)
+	remote := build(t, 2500, 1<<30)
+	r, err := Sync(local, Local{remote})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := local.Root()
+	want, _ := remote.Root()
+	if r.Fetched != 2400 || got != want {
+		t.Fatalf("fetched %d leaves, root %x, want %x", r.Fetched, got, want)
+	}
+	if r, err := Sync(local, Local{remote}); err != nil || r.Fetched != 0 {
+		t.Fatalf("second sync: %+v %v", r, err)
+	}
+
+	forked := build(t, 3000, 1234)
+	if r, err := Sync(local, Local{forked}); err != ErrFork || r.Common != 1234 {
+		t.Fatalf("sync with fork: %+v %v", r, err)
+	}
+	if local.LeafCount() != 2500 {
+		t.Fatal("leaves of a fork were appended")
+	}
+
+	local = build(t, 10, 1<<30)
+	bad := &counting{Local: Local{remote}, tamper: true}
+	if _, err := Sync(local, bad); err != ErrBadReply || local.LeafCount() != 10 {
+		t.Fatalf("tampered leaves: %v, %d leaves", err, local.LeafCount())
+	}
+}
@@ -0,0 +1,88 @@
+// Package nervos mirrors the API of the nervos merkle-mountain-range crate,
+// which mmr.go was ported from. Given the same merge function the roots and
+// proofs are identical to the crate's.
+package nervos
+
+import (
+	"github.com/go-mmr/gommr"
+)
+
+// Merge is the crate's Merge trait. Peaks are bagged with the right hand
+// side first, as the default merge_peaks does.
+type Merge interface {
+	Merge(lhs, rhs gommr.Hash) gommr.Hash
+}
+
+// MergeFunc adapts a function to Merge.
+type MergeFunc func(lhs, rhs gommr.Hash) gommr.Hash
+
+func (f MergeFunc) Merge(lhs, rhs gommr.Hash) gommr.Hash {
+	return f(lhs, rhs)
+}
+
+type merger struct {
+	m Merge
+}
+
+func (m merger) Merge(pos uint64, left, right gommr.Hash) gommr.Hash {
+	return m.m.Merge(left, right)
+}
+
+func (m merger) BagPeaks(mmrSize uint64, left, right gommr.Hash) gommr.Hash {
+	return m.m.Merge(right, left)
+}
+
+// Merger returns the gommr merger for m.
+func Merger(m Merge) gommr.Merger {
+	return merger{m}
+}
+
+// NewMMR opens an mmr on store that merges with m. Its dumps name no
+// scheme; to import them elsewhere by name, Register m and open the mmr
+// with gommr.WithScheme instead.
+func NewMMR(store gommr.Store, m Merge) (*gommr.MMR, error) {
+	return gommr.NewMMR(store, gommr.WithMerger(Merger(m)))
+}
+
+// Register makes m known as the scheme name, hashing with the multihash
+// hashCode.
+func Register(name string, hashCode uint64, m Merge) {
+	gommr.RegisterScheme(gommr.Scheme{Name: name, HashCode: hashCode, Merger: Merger(m)})
+}
+
+// MerkleProof is the crate's MerkleProof, its items may prove several
+// leaves at once.
+type MerkleProof struct {
+	MmrSize uint64
+	Proof   []gommr.Hash
+}
+
+// GenProof is MMR::gen_proof for leaf positions.
+func GenProof(m *gommr.MMR, positions []uint64) (*MerkleProof, error) {
+	p, err := m.GenBatchProof(positions)
+	if err != nil {
+		return nil, err
+	}
+	return &MerkleProof{MmrSize: p.MmrSize, Proof: p.Items}, nil
+}
+
+func (p *MerkleProof) batch() *gommr.BatchProof {
+	return &gommr.BatchProof{MmrSize: p.MmrSize, Items: p.Proof}
+}
+
+// CalculateRoot is MerkleProof::calculate_root.
+func (p *MerkleProof) CalculateRoot(m Merge, leaves []gommr.Leaf) (gommr.Hash, error) {
+	return p.batch().CalculateRoot(Merger(m), leaves)
+}
+
+// Verify is MerkleProof::verify.
+func (p *MerkleProof) Verify(m Merge, root gommr.Hash, leaves []gommr.Leaf) bool {
+	return p.batch().Verify(Merger(m), root, leaves)
+}
+
+// CalculateRootWithNewLeaf is MerkleProof::calculate_root_with_new_leaf:
+// the root after new_elem is pushed at new_pos, growing the mmr to
+// new_mmr_size.
+func (p *MerkleProof) CalculateRootWithNewLeaf(m Merge, leaves []gommr.Leaf, newPos uint64, newElem gommr.Hash, newMmrSize uint64) (gommr.Hash, error) {
+	return p.batch().CalculateRootWithNewLeaf(Merger(m), leaves, newPos, newElem, newMmrSize)
+}
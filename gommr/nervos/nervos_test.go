@@ -0,0 +1,151 @@
+package nervos
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/go-mmr/gommr"
+)
+
+var sha256Merge = MergeFunc(func(lhs, rhs gommr.Hash) gommr.Hash {
+	return sha256.Sum256(append(lhs[:], rhs[:]...))
+})
+
+func leaf(i uint64) gommr.Hash {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], uint32(i))
+	return sha256.Sum256(b[:])
+}
+
+type vectors struct {
+	Cases []struct {
+		Leaves          uint64 `json:"leaves"`
+		MmrSize         uint64 `json:"mmr_size"`
+		Root            string `json:"root"`
+		RootWithNewLeaf string `json:"root_with_new_leaf"`
+		NewMmrSize      uint64 `json:"new_mmr_size"`
+		Proofs          []struct {
+			LeafIndices  []uint64 `json:"leaf_indices"`
+			Items        []string `json:"items"`
+			NewLeafError string   `json:"new_leaf_error"`
+		} `json:"proofs"`
+	} `json:"cases"`
+}
+
+func decodeHash(t *testing.T, s string) gommr.Hash {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 32 {
+		t.Fatalf("bad hash %q", s)
+	}
+	return gommr.BytesToHash(b)
+}
+
+// TestVectors checks roots and proofs against testdata/vectors.json,
+// see testdata/gen_vectors.py.
+func TestVectors(t *testing.T) {
+	data, err := os.ReadFile("testdata/vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v vectors
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range v.Cases {
+		m, _ := NewMMR(gommr.NewMemStore(), sha256Merge)
+		for i := uint64(0); i < c.Leaves; i++ {
+			m.Push(leaf(i))
+		}
+		root, _ := m.Root()
+		if m.Size() != c.MmrSize || root != decodeHash(t, c.Root) {
+			t.Fatalf("%d leaves: size %d root %x, want %d %s", c.Leaves, m.Size(), root, c.MmrSize, c.Root)
+		}
+		for _, vp := range c.Proofs {
+			var (
+				positions []uint64
+				leaves    []gommr.Leaf
+			)
+			for _, index := range vp.LeafIndices {
+				pos := gommr.LeafIndexToPos(index)
+				positions = append(positions, pos)
+				leaves = append(leaves, gommr.Leaf{Pos: pos, Hash: leaf(index)})
+			}
+			proof, err := GenProof(m, positions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(proof.Proof) != len(vp.Items) {
+				t.Fatalf("%d leaves, proof for %v: %d items, want %d", c.Leaves, vp.LeafIndices, len(proof.Proof), len(vp.Items))
+			}
+			for i, item := range vp.Items {
+				if proof.Proof[i] != decodeHash(t, item) {
+					t.Fatalf("%d leaves, proof for %v: item %d differs", c.Leaves, vp.LeafIndices, i)
+				}
+			}
+			if !proof.Verify(sha256Merge, root, leaves) {
+				t.Fatalf("%d leaves: proof for %v failed", c.Leaves, vp.LeafIndices)
+			}
+			got, err := proof.CalculateRootWithNewLeaf(sha256Merge, leaves, c.MmrSize, leaf(c.Leaves), c.NewMmrSize)
+			if vp.NewLeafError != "" {
+				// a proof with bagged right hand peaks cannot be extended
+				if err != gommr.ErrCorruptedProof {
+					t.Fatalf("%d leaves: root with new leaf for %v: %v, want %s", c.Leaves, vp.LeafIndices, err, vp.NewLeafError)
+				}
+				continue
+			}
+			if err != nil || got != decodeHash(t, c.RootWithNewLeaf) {
+				t.Fatalf("%d leaves: root with new leaf for %v differs: %v", c.Leaves, vp.LeafIndices, err)
+			}
+		}
+	}
+}
+
+// TestRootWithNewLeaf checks calculate_root_with_new_leaf for every leaf
+// of mmrs whose proofs never bag right hand peaks.
+func TestRootWithNewLeaf(t *testing.T) {
+	for count := uint64(1); count < 40; count++ {
+		m, _ := NewMMR(gommr.NewMemStore(), sha256Merge)
+		for i := uint64(0); i < count; i++ {
+			m.Push(leaf(i))
+		}
+		size := m.Size()
+		index := count - 1
+		pos := gommr.LeafIndexToPos(index)
+		proof, err := GenProof(m, []uint64{pos})
+		if err != nil {
+			t.Fatal(err)
+		}
+		newPos, _ := m.Push(leaf(count))
+		want, _ := m.Root()
+		got, err := proof.CalculateRootWithNewLeaf(sha256Merge, []gommr.Leaf{{Pos: pos, Hash: leaf(index)}}, newPos, leaf(count), m.Size())
+		if err != nil {
+			t.Fatalf("%d leaves: %v", count, err)
+		}
+		if got != want || newPos != size {
+			t.Fatalf("%d leaves: root with new leaf %x, want %x", count, got, want)
+		}
+	}
+}
+
+// TestDefaultMerge checks that the rlp merge of gommr is a Merge like any
+// other: an mmr built through the adapter has the same root.
+func TestDefaultMerge(t *testing.T) {
+	rlpMerge := MergeFunc(func(lhs, rhs gommr.Hash) gommr.Hash {
+		return gommr.RlpHash([]gommr.Hash{lhs, rhs})
+	})
+	a, _ := gommr.NewMMR(gommr.NewMemStore())
+	b, _ := NewMMR(gommr.NewMemStore(), rlpMerge)
+	for i := uint64(0); i < 50; i++ {
+		a.Push(leaf(i))
+		b.Push(leaf(i))
+		ra, _ := a.Root()
+		rb, _ := b.Root()
+		if ra != rb {
+			t.Fatalf("%d leaves: roots differ", i+1)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Exports vectors.json from the merkle-mountain-range crate itself:
+//
+//     cargo run --manifest-path export/Cargo.toml > vectors.json
+use ckb_merkle_mountain_range::{
+    leaf_index_to_mmr_size, leaf_index_to_pos, util::MemMMR, Error, Merge, Result,
+};
+use serde_json::{json, Value};
+use sha2::{Digest, Sha256};
+
+#[derive(Clone, Debug, PartialEq, Eq)]
+struct H([u8; 32]);
+
+struct MergeSha256;
+
+impl Merge for MergeSha256 {
+    type Item = H;
+    fn merge(lhs: &H, rhs: &H) -> Result<H> {
+        let mut h = Sha256::new();
+        h.update(lhs.0);
+        h.update(rhs.0);
+        Ok(H(h.finalize().into()))
+    }
+}
+
+fn leaf(i: u64) -> H {
+    H(Sha256::digest((i as u32).to_le_bytes()).into())
+}
+
+// proof sets of a case: the first, last and middle leaf, all leaves and
+// three sets picked by a fixed linear congruential generator
+fn sets(count: u64, seed: &mut u64) -> Vec<Vec<u64>> {
+    let mut sets = vec![vec![0], vec![count - 1], vec![count / 2], (0..count).collect()];
+    for _ in 0..3 {
+        let mut set = Vec::new();
+        for _ in 0..count.min(4) {
+            *seed = seed.wrapping_mul(6364136223846793005).wrapping_add(1442695040888963407);
+            set.push((*seed >> 33) % count);
+        }
+        set.sort();
+        set.dedup();
+        sets.push(set);
+    }
+    sets
+}
+
+fn main() {
+    let mut seed = 7u64;
+    let mut cases = Vec::new();
+    for count in [1u64, 2, 3, 4, 5, 7, 8, 11, 19, 32, 33, 100] {
+        let mut mmr = MemMMR::<H, MergeSha256>::default();
+        for i in 0..count {
+            mmr.push(leaf(i)).unwrap();
+        }
+        let size = mmr.mmr_size();
+        let root = mmr.get_root().unwrap();
+        let mut next = MemMMR::<H, MergeSha256>::default();
+        for i in 0..=count {
+            next.push(leaf(i)).unwrap();
+        }
+        let new_root = next.get_root().unwrap();
+        let new_size = leaf_index_to_mmr_size(count);
+        assert_eq!(new_size, next.mmr_size());
+
+        let mut proofs = Vec::new();
+        for indices in sets(count, &mut seed) {
+            let leaves: Vec<(u64, H)> = indices.iter().map(|&i| (leaf_index_to_pos(i), leaf(i))).collect();
+            let proof = mmr.gen_proof(leaves.iter().map(|l| l.0).collect()).unwrap();
+            assert!(proof.verify(root.clone(), leaves.clone()).unwrap());
+            let new_leaf_error = match proof.calculate_root_with_new_leaf(
+                leaves,
+                leaf_index_to_pos(count),
+                leaf(count),
+                new_size,
+            ) {
+                Ok(r) => {
+                    assert_eq!(r, new_root);
+                    Value::Null
+                }
+                Err(Error::CorruptedProof) => json!("corrupted proof"),
+                Err(e) => panic!("{:?}", e),
+            };
+            proofs.push(json!({
+                "leaf_indices": indices,
+                "items": proof.proof_items().iter().map(|h| hex::encode(h.0)).collect::<Vec<_>>(),
+                "new_leaf_error": new_leaf_error,
+            }));
+        }
+        cases.push(json!({
+            "leaves": count,
+            "mmr_size": size,
+            "root": hex::encode(root.0),
+            "proofs": proofs,
+            "root_with_new_leaf": hex::encode(new_root.0),
+            "new_mmr_size": new_size,
+        }));
+    }
+    let out = json!({
+        "merge": "sha256(lhs || rhs)",
+        "leaf": "sha256(u32 little endian index)",
+        "cases": cases,
+    });
+    println!("{}", serde_json::to_string_pretty(&out).unwrap());
+}
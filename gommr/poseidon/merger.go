@@ -0,0 +1,79 @@
+package poseidon
+
+import (
+	"math/big"
+
+	"github.com/go-mmr/gommr"
+)
+
+// FieldToHash encodes a field element as a 32 byte big endian hash.
+func FieldToHash(x *big.Int) gommr.Hash {
+	var h gommr.Hash
+	new(big.Int).Mod(x, Modulus).FillBytes(h[:])
+	return h
+}
+
+// HashToField decodes a hash, which has to be a canonical field element.
+func HashToField(h gommr.Hash) (*big.Int, error) {
+	x := new(big.Int).SetBytes(h[:])
+	if x.Cmp(Modulus) >= 0 {
+		return nil, ErrField
+	}
+	return x, nil
+}
+
+// LeafHash hashes a field element into a leaf, Poseidon(1).
+func LeafHash(x *big.Int) (gommr.Hash, error) {
+	h, err := Hash(x)
+	if err != nil {
+		return gommr.Hash{}, err
+	}
+	return FieldToHash(h), nil
+}
+
+// Invalid is the parent of a child that is no canonical field element.
+// It is no field element either, so it climbs up to the root, which then
+// matches no root of canonical nodes: Merge can not fail, but reducing the
+// child would let x and x+p prove the same leaf.
+var Invalid = func() (h gommr.Hash) {
+	for i := range h {
+		h[i] = 0xff
+	}
+	return h
+}()
+
+func hash2(left, right gommr.Hash) gommr.Hash {
+	l, err := HashToField(left)
+	if err != nil {
+		return Invalid
+	}
+	r, err := HashToField(right)
+	if err != nil {
+		return Invalid
+	}
+	h, _ := Hash(l, r)
+	return FieldToHash(h)
+}
+
+type merger struct{}
+
+func (merger) Merge(pos uint64, left, right gommr.Hash) gommr.Hash {
+	return hash2(left, right)
+}
+
+// BagPeaks puts the right hand side first, like gommr's default merger.
+func (merger) BagPeaks(mmrSize uint64, left, right gommr.Hash) gommr.Hash {
+	return hash2(right, left)
+}
+
+// Merger merges nodes with Poseidon(2) of the children as field elements.
+var Merger gommr.Merger = merger{}
+
+// HashCode is the multihash code envelopes record for the scheme. The
+// multicodec table has none for Poseidon over BN254, it is taken from the
+// private use range.
+const HashCode = 0x300000
+
+func init() {
+	gommr.RegisterScheme(gommr.Scheme{Name: "poseidon", HashCode: HashCode, Merger: Merger})
+}
@@ -0,0 +1,204 @@
+// Package poseidon implements the Poseidon hash over the BN254 scalar
+// field with the parameters of circomlib: the x^5 S-box, 8 full rounds, the
+// partial rounds of RoundsP and constants from the Grain LFSR of the
+// reference implementation. Its Merger builds mmrs whose roots a circom
+// circuit can recompute.
+package poseidon
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+)
+
+var (
+	ErrInputs = errors.New("poseidon: 1 to 16 inputs are supported")
+	ErrField  = errors.New("poseidon: input is not a field element")
+)
+
+// Modulus is the order of the BN254 scalar field.
+var Modulus, _ = new(big.Int).SetString("21888242871839275222246405745257275088548364400416034343698204186575808495617", 10)
+
+// RoundsF is the number of full rounds, half of them before and half after
+// the partial rounds.
+const RoundsF = 8
+
+// RoundsP holds the number of partial rounds for widths 2 to 17, as in
+// circomlib's poseidon.circom.
+var RoundsP = []int{56, 57, 56, 60, 60, 63, 64, 63, 60, 66, 60, 65, 70, 60, 64, 68}
+
+// Params are the constants of a Poseidon permutation of width T.
+type Params struct {
+	T       int
+	RoundsF int
+	RoundsP int
+	// C holds T round constants per round.
+	C []*big.Int
+	// M is the MDS matrix.
+	M [][]*big.Int
+}
+
+// grain is the self-shrinking Grain LFSR of generate_parameters_grain.sage.
+type grain struct {
+	state [80]byte
+}
+
+func newGrain(t, roundsF, roundsP int) *grain {
+	g := &grain{}
+	i := 0
+	put := func(v, n int) {
+		for b := n - 1; b >= 0; b-- {
+			g.state[i] = byte(v>>uint(b)) & 1
+			i++
+		}
+	}
+	put(1, 2) // prime field
+	put(0, 4) // x^alpha S-box
+	put(254, 12)
+	put(t, 12)
+	put(roundsF, 10)
+	put(roundsP, 10)
+	put(1<<30-1, 30)
+	for j := 0; j < 160; j++ {
+		g.next()
+	}
+	return g
+}
+
+func (g *grain) next() byte {
+	s := &g.state
+	bit := s[62] ^ s[51] ^ s[38] ^ s[23] ^ s[13] ^ s[0]
+	copy(s[:], s[1:])
+	s[79] = bit
+	return bit
+}
+
+func (g *grain) bit() byte {
+	for {
+		b1, b2 := g.next(), g.next()
+		if b1 == 1 {
+			return b2
+		}
+	}
+}
+
+func (g *grain) bits(n int) *big.Int {
+	v := new(big.Int)
+	for i := 0; i < n; i++ {
+		v.Lsh(v, 1)
+		if g.bit() == 1 {
+			v.SetBit(v, 0, 1)
+		}
+	}
+	return v
+}
+
+// Generate derives the constants for width t. Round constants are
+// rejection sampled, the MDS matrix is the Cauchy matrix 1/(x_i + y_j) of
+// the next 2t reduced samples.
+func Generate(t, roundsF, roundsP int) *Params {
+	g := newGrain(t, roundsF, roundsP)
+	p := &Params{T: t, RoundsF: roundsF, RoundsP: roundsP}
+	for len(p.C) < (roundsF+roundsP)*t {
+		if c := g.bits(254); c.Cmp(Modulus) < 0 {
+			p.C = append(p.C, c)
+		}
+	}
+next:
+	for {
+		xs := make([]*big.Int, 2*t)
+		seen := map[string]bool{}
+		for i := range xs {
+			xs[i] = g.bits(254)
+			xs[i].Mod(xs[i], Modulus)
+			if seen[xs[i].String()] {
+				continue next
+			}
+			seen[xs[i].String()] = true
+		}
+		p.M = make([][]*big.Int, t)
+		for i := 0; i < t; i++ {
+			p.M[i] = make([]*big.Int, t)
+			for j := 0; j < t; j++ {
+				sum := new(big.Int).Add(xs[i], xs[t+j])
+				if sum.Mod(sum, Modulus).Sign() == 0 {
+					continue next
+				}
+				p.M[i][j] = sum.ModInverse(sum, Modulus)
+			}
+		}
+		return p
+	}
+}
+
+var (
+	paramsLock sync.Mutex
+	params     = map[int]*Params{}
+)
+
+// ParamsFor returns the circomlib parameters for width t, 2 <= t <= 17.
+func ParamsFor(t int) (*Params, error) {
+	if t < 2 || t-2 >= len(RoundsP) {
+		return nil, ErrInputs
+	}
+	paramsLock.Lock()
+	defer paramsLock.Unlock()
+	p, ok := params[t]
+	if !ok {
+		p = Generate(t, RoundsF, RoundsP[t-2])
+		params[t] = p
+	}
+	return p, nil
+}
+
+func pow5(x *big.Int) {
+	x2 := new(big.Int).Mul(x, x)
+	x2.Mod(x2, Modulus)
+	x4 := x2.Mul(x2, x2)
+	x4.Mod(x4, Modulus)
+	x.Mul(x, x4).Mod(x, Modulus)
+}
+
+// Permute applies the permutation to state, which has T elements.
+func (p *Params) Permute(state []*big.Int) {
+	tmp := new(big.Int)
+	next := make([]*big.Int, p.T)
+	for r := 0; r < p.RoundsF+p.RoundsP; r++ {
+		for i := range state {
+			state[i].Add(state[i], p.C[r*p.T+i]).Mod(state[i], Modulus)
+		}
+		if r < p.RoundsF/2 || r >= p.RoundsF/2+p.RoundsP {
+			for _, x := range state {
+				pow5(x)
+			}
+		} else {
+			pow5(state[0])
+		}
+		for i := range next {
+			next[i] = new(big.Int)
+			for j, x := range state {
+				next[i].Add(next[i], tmp.Mul(p.M[i][j], x))
+			}
+			next[i].Mod(next[i], Modulus)
+		}
+		copy(state, next)
+	}
+}
+
+// Hash is circomlib's Poseidon(n): the first element of the permuted state
+// [0, inputs...].
+func Hash(inputs ...*big.Int) (*big.Int, error) {
+	p, err := ParamsFor(len(inputs) + 1)
+	if err != nil {
+		return nil, err
+	}
+	state := []*big.Int{new(big.Int)}
+	for _, in := range inputs {
+		if in.Sign() < 0 || in.Cmp(Modulus) >= 0 {
+			return nil, ErrField
+		}
+		state = append(state, new(big.Int).Set(in))
+	}
+	p.Permute(state)
+	return state[0], nil
+}
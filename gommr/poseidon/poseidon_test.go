@@ -0,0 +1,122 @@
+package poseidon
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/go-mmr/gommr"
+)
+
+func hexInt(s string) *big.Int {
+	x, _ := new(big.Int).SetString(s, 16)
+	return x
+}
+
+// Vectors of circomlibjs' poseidon tests.
+func TestCircomlibVectors(t *testing.T) {
+	for _, c := range []struct {
+		inputs []int64
+		want   string
+	}{
+		{[]int64{1}, "29176100eaa962bdc1fe6c654d6a3c130e96a4d1168b33848b897dc502820133"},
+		{[]int64{1, 2}, "115cc0f5e7d690413df64c6b9662e9cf2a3617f2743245519e19607a4417189a"},
+		{[]int64{1, 2, 3, 4}, "299c867db6c1fdd79dcefa40e4510b9837e60ebb1ce0663dbaa525df65250465"},
+	} {
+		var inputs []*big.Int
+		for _, in := range c.inputs {
+			inputs = append(inputs, big.NewInt(in))
+		}
+		h, err := Hash(inputs...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Cmp(hexInt(c.want)) != 0 {
+			t.Fatalf("poseidon%v = %x, want %s", c.inputs, h, c.want)
+		}
+	}
+	if _, err := Hash(); err != ErrInputs {
+		t.Fatalf("no inputs: %v", err)
+	}
+	if _, err := Hash(Modulus); err != ErrField {
+		t.Fatalf("input out of field: %v", err)
+	}
+}
+
+// The first entries of circomlib's poseidon_constants for width 3.
+func TestConstants(t *testing.T) {
+	p, err := ParamsFor(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.C) != 3*(8+57) || len(p.M) != 3 {
+		t.Fatalf("%d constants, %d rows", len(p.C), len(p.M))
+	}
+	if p.C[0].Cmp(hexInt("0ee9a592ba9a9518d05986d656f40c2114c4993c11bb29938d21d47304cd8e6e")) != 0 {
+		t.Fatalf("C[0] = %x", p.C[0])
+	}
+	if p.M[0][0].Cmp(hexInt("109b7f411ba0e4c9b2b70caf5c36a7b194be7c11ad24378bfedb68592ba8118b")) != 0 {
+		t.Fatalf("M[0][0] = %x", p.M[0][0])
+	}
+}
+
+func TestMerger(t *testing.T) {
+	m, err := gommr.NewMMR(gommr.NewMemStore(), gommr.WithScheme("poseidon"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var leaves []gommr.Hash
+	for i := int64(0); i < 11; i++ {
+		leaf, err := LeafHash(big.NewInt(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaves = append(leaves, leaf)
+		m.Push(leaf)
+	}
+	n2, _ := m.Get(2)
+	want, _ := Hash(new(big.Int).SetBytes(leaves[0][:]), new(big.Int).SetBytes(leaves[1][:]))
+	if n2 != FieldToHash(want) {
+		t.Fatal("node 2 is not poseidon of leaves 0 and 1")
+	}
+	root, _ := m.Root()
+	if _, err := HashToField(root); err != nil {
+		t.Fatal("root is not a field element")
+	}
+	for i := range leaves {
+		pos := gommr.LeafIndexToPos(uint64(i))
+		proof, err := m.GenProof(pos)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !proof.VerifyWith(Merger, root, pos, leaves[i]) {
+			t.Fatalf("proof of leaf %d failed", i)
+		}
+	}
+	var max gommr.Hash
+	for i := range max {
+		max[i] = 0xff
+	}
+	if _, err := HashToField(max); err != ErrField {
+		t.Fatal("hash above the modulus decoded")
+	}
+
+	// leaf 3 plus the modulus is the same field element, but no proof
+	pos := gommr.LeafIndexToPos(3)
+	proof, _ := m.GenProof(pos)
+	var alias gommr.Hash
+	new(big.Int).Add(new(big.Int).SetBytes(leaves[3][:]), Modulus).FillBytes(alias[:])
+	if proof.VerifyWith(Merger, root, pos, alias) {
+		t.Fatal("non-canonical leaf verifies")
+	}
+	if Merger.Merge(2, leaves[0], alias) != Invalid || Merger.BagPeaks(3, max, leaves[0]) != Invalid {
+		t.Fatal("non-canonical child merged")
+	}
+
+	env, err := gommr.NewEnvelope("poseidon", 3, root, proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.Verify(root, leaves[3]); err != nil {
+		t.Fatalf("envelope: %v", err)
+	}
+}
@@ -0,0 +1,343 @@
+// Package replication copies an mmr from a leader to followers over TCP.
+//
+// A follower opens a connection and sends a Hello with its leaf count. The
+// leader answers with a stream of Batches, starting at that leaf count,
+// each carrying the leaves and the checkpoint of the mmr after them signed
+// by the leader. Messages are RLP values. The follower appends the leaves
+// and only keeps them if its root matches the checkpoint. As followers
+// always start from their own size, they resume where they left off after
+// a disconnect.
+package replication
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-mmr/gommr"
+	"github.com/go-mmr/gommr/checkpoint"
+	"github.com/go-mmr/gommr/rlp"
+)
+
+var (
+	ErrDiverged     = errors.New("replication: follower is not a prefix of the leader")
+	ErrRootMismatch = errors.New("replication: root does not match the signed checkpoint")
+	ErrClosed       = errors.New("replication: leader closed")
+)
+
+// MaxBatch bounds the leaves of a batch.
+const MaxBatch = 1024
+
+// Hello opens a replication stream.
+type Hello struct {
+	LeafCount uint64
+}
+
+// Batch appends Leaves at leaf index First. Checkpoint is the signed
+// checkpoint of the mmr after the batch.
+type Batch struct {
+	First      uint64
+	Leaves     []gommr.Hash
+	Checkpoint []byte
+}
+
+// Leader serves its mmr to followers. Leaves have to be appended through
+// Append for the followers to be told about them.
+type Leader struct {
+	mmr    *gommr.MMR
+	signer *checkpoint.Signer
+
+	lock    sync.Mutex
+	changed chan struct{}
+	closed  bool
+	lns     map[net.Listener]bool
+	conns   map[net.Conn]bool
+	wg      sync.WaitGroup
+}
+
+// NewLeader returns a leader of m signing checkpoints with signer, whose
+// name is the origin of the checkpoints.
+func NewLeader(m *gommr.MMR, signer *checkpoint.Signer) *Leader {
+	return &Leader{
+		mmr:     m,
+		signer:  signer,
+		changed: make(chan struct{}),
+		lns:     make(map[net.Listener]bool),
+		conns:   make(map[net.Conn]bool),
+	}
+}
+
+// Append appends leaves and wakes the followers.
+func (l *Leader) Append(leaves ...gommr.Hash) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for _, leaf := range leaves {
+		if _, err := l.mmr.Push(leaf); err != nil {
+			return err
+		}
+	}
+	if !l.closed {
+		close(l.changed)
+		l.changed = make(chan struct{})
+	}
+	return nil
+}
+
+// Serve accepts followers on ln until ln or the leader is closed.
+func (l *Leader) Serve(ln net.Listener) error {
+	l.lock.Lock()
+	if l.closed {
+		l.lock.Unlock()
+		return ErrClosed
+	}
+	l.lns[ln] = true
+	l.lock.Unlock()
+	defer func() {
+		l.lock.Lock()
+		delete(l.lns, ln)
+		l.lock.Unlock()
+	}()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			l.lock.Lock()
+			closed := l.closed
+			l.lock.Unlock()
+			if closed {
+				return ErrClosed
+			}
+			return err
+		}
+		if !l.track(conn) {
+			conn.Close()
+			return ErrClosed
+		}
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+			defer l.untrack(conn)
+			l.serveConn(conn)
+		}()
+	}
+}
+
+func (l *Leader) track(conn net.Conn) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.closed {
+		return false
+	}
+	l.conns[conn] = true
+	return true
+}
+
+func (l *Leader) untrack(conn net.Conn) {
+	conn.Close()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	delete(l.conns, conn)
+}
+
+// Close stops serving and drops all followers.
+func (l *Leader) Close() error {
+	l.lock.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.changed)
+	}
+	for ln := range l.lns {
+		ln.Close()
+	}
+	for conn := range l.conns {
+		conn.Close()
+	}
+	l.lock.Unlock()
+	l.wg.Wait()
+	return nil
+}
+
+// wait returns the leaf count and a channel closed on the next append.
+func (l *Leader) wait() (uint64, <-chan struct{}, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.mmr.LeafCount(), l.changed, !l.closed
+}
+
+func (l *Leader) serveConn(conn net.Conn) error {
+	var hello Hello
+	if err := rlp.NewStream(conn, 0).Decode(&hello); err != nil {
+		return err
+	}
+	next := hello.LeafCount
+	if count, _, _ := l.wait(); next > count {
+		// let the follower see that it is ahead
+		b, err := l.batch(count, count)
+		if err != nil {
+			return err
+		}
+		return rlp.Encode(conn, b)
+	}
+	// followers send nothing after the hello, the read returns once the
+	// connection is gone
+	gone := make(chan struct{})
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		io.Copy(io.Discard, conn)
+		close(gone)
+	}()
+	first := true
+	for {
+		count, changed, open := l.wait()
+		if !open {
+			return ErrClosed
+		}
+		for first || next < count {
+			end := count
+			if end-next > MaxBatch {
+				end = next + MaxBatch
+			}
+			b, err := l.batch(next, end)
+			if err != nil {
+				return err
+			}
+			if err := rlp.Encode(conn, b); err != nil {
+				return err
+			}
+			next, first = end, false
+		}
+		select {
+		case <-changed:
+		case <-gone:
+			return io.ErrUnexpectedEOF
+		}
+	}
+}
+
+// batch returns the leaves from start up to end with the signed
+// checkpoint after them.
+func (l *Leader) batch(start, end uint64) (*Batch, error) {
+	b := &Batch{First: start}
+	for i := start; i < end; i++ {
+		h, err := l.mmr.Get(gommr.LeafIndexToPos(i))
+		if err != nil {
+			return nil, err
+		}
+		b.Leaves = append(b.Leaves, h)
+	}
+	size := gommr.LeafCountToSize(end)
+	root, err := l.mmr.RootAt(size)
+	if err != nil {
+		return nil, err
+	}
+	c := &checkpoint.Checkpoint{Origin: l.signer.Name(), Size: size, Root: root, Time: time.Now()}
+	if b.Checkpoint, err = c.Sign(l.signer); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Follower applies the stream of a leader to its mmr, which has to use
+// the merger of the leader.
+type Follower struct {
+	mmr *gommr.MMR
+	log *checkpoint.Verifier
+
+	lock   sync.Mutex
+	latest []byte
+}
+
+// NewFollower returns a follower appending to m the leaves of the leader
+// signing with the key of log.
+func NewFollower(m *gommr.MMR, log *checkpoint.Verifier) *Follower {
+	return &Follower{mmr: m, log: log}
+}
+
+// Checkpoint returns the latest signed checkpoint the follower matched,
+// or nil.
+func (f *Follower) Checkpoint() []byte {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.latest
+}
+
+// Sync replicates over conn until the stream ends or fails.
+func (f *Follower) Sync(conn net.Conn) error {
+	if err := rlp.Encode(conn, Hello{LeafCount: f.mmr.LeafCount()}); err != nil {
+		return err
+	}
+	s := rlp.NewStream(conn, 0)
+	for {
+		var b Batch
+		if err := s.Decode(&b); err != nil {
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		if err := f.apply(&b); err != nil {
+			return err
+		}
+	}
+}
+
+func (f *Follower) apply(b *Batch) error {
+	size := f.mmr.Size()
+	if b.First != f.mmr.LeafCount() || len(b.Leaves) > MaxBatch {
+		return ErrDiverged
+	}
+	c, _, err := checkpoint.Verify(b.Checkpoint, f.log)
+	if err != nil {
+		return err
+	}
+	for _, leaf := range b.Leaves {
+		if _, err := f.mmr.Push(leaf); err != nil {
+			f.mmr.Rewind(size)
+			return err
+		}
+	}
+	root, err := f.mmr.Root()
+	if err != nil {
+		f.mmr.Rewind(size)
+		return err
+	}
+	if c.Size != f.mmr.Size() || c.Root != root {
+		f.mmr.Rewind(size)
+		return ErrRootMismatch
+	}
+	f.lock.Lock()
+	f.latest = b.Checkpoint
+	f.lock.Unlock()
+	return nil
+}
+
+// Run keeps the follower connected to the leader at addr, reconnecting
+// after retry when the connection drops, until stop is closed. It gives up
+// on ErrDiverged and ErrRootMismatch, which a reconnect does not fix.
+func (f *Follower) Run(addr string, retry time.Duration, stop <-chan struct{}) error {
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			done := make(chan struct{})
+			go func() {
+				select {
+				case <-stop:
+				case <-done:
+				}
+				conn.Close()
+			}()
+			err = f.Sync(conn)
+			close(done)
+			if err == ErrDiverged || err == ErrRootMismatch {
+				return err
+			}
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(retry):
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package replication
+
+import (
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-mmr/gommr"
+	"github.com/go-mmr/gommr/checkpoint"
+	"github.com/go-mmr/gommr/rlp"
+)
+
+func newKey(t *testing.T, name string) (*checkpoint.Signer, *checkpoint.Verifier) {
+	skey, vkey, err := checkpoint.GenerateKey(rand.Reader, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _ := checkpoint.NewSigner(skey)
+	v, _ := checkpoint.NewVerifier(vkey)
+	return s, v
+}
+
+func leaves(from, to int) []gommr.Hash {
+	var res []gommr.Hash
+	for i := from; i < to; i++ {
+		res = append(res, gommr.RlpHash(uint64(i)))
+	}
+	return res
+}
+
+func serve(t *testing.T, l *Leader, addr string) string {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go l.Serve(ln)
+	return ln.Addr().String()
+}
+
+func waitFor(t *testing.T, m *gommr.MMR, count uint64) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for m.LeafCount() < count {
+		if time.Now().After(deadline) {
+			t.Fatalf("follower at %d leaves, want %d", m.LeafCount(), count)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestReplication(t *testing.T) {
+	signer, verifier := newKey(t, "example.com/log")
+	lm, _ := gommr.NewMMR(gommr.NewMemStore())
+	leader := NewLeader(lm, signer)
+	// a backlog of several batches
+	if err := leader.Append(leaves(0, 2*MaxBatch+100)...); err != nil {
+		t.Fatal(err)
+	}
+	addr := serve(t, leader, "127.0.0.1:0")
+
+	stop := make(chan struct{})
+	var (
+		followers []*Follower
+		done      []chan error
+	)
+	for i := 0; i < 3; i++ {
+		fm, _ := gommr.NewMMR(gommr.NewMemStore())
+		f := NewFollower(fm, verifier)
+		ch := make(chan error, 1)
+		go func() { ch <- f.Run(addr, 10*time.Millisecond, stop) }()
+		followers = append(followers, f)
+		done = append(done, ch)
+	}
+	count := uint64(2*MaxBatch + 100)
+	for _, n := range []int{1, 7, 0, 300} {
+		leader.Append(leaves(int(count), int(count)+n)...)
+		count += uint64(n)
+		for _, f := range followers {
+			waitFor(t, f.mmr, count)
+		}
+	}
+	want, _ := lm.Root()
+	for i, f := range followers {
+		if root, _ := f.mmr.Root(); root != want {
+			t.Fatalf("follower %d root %x, want %x", i, root, want)
+		}
+		c, _, err := checkpoint.Verify(f.Checkpoint(), verifier)
+		if err != nil || c.Size != lm.Size() || c.Root != want {
+			t.Fatalf("follower %d checkpoint %+v: %v", i, c, err)
+		}
+	}
+
+	// the followers resume from their size once the leader is back
+	leader.Close()
+	leader = NewLeader(lm, signer)
+	leader.Append(leaves(int(count), int(count)+50)...)
+	count += 50
+	serve(t, leader, addr)
+	for _, f := range followers {
+		waitFor(t, f.mmr, count)
+	}
+	close(stop)
+	for i, ch := range done {
+		if err := <-ch; err != nil {
+			t.Fatalf("follower %d: %v", i, err)
+		}
+	}
+	want, _ = lm.Root()
+	if root, _ := followers[0].mmr.Root(); root != want {
+		t.Fatal("roots differ after resume")
+	}
+	defer leader.Close()
+
+	sync := func(f *Follower) error {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		return f.Sync(conn)
+	}
+	// a follower with a different history does not take the leaves
+	fm, _ := gommr.NewMMR(gommr.NewMemStore())
+	fm.Push(gommr.Hash{1})
+	if err := sync(NewFollower(fm, verifier)); err != ErrRootMismatch || fm.LeafCount() != 1 {
+		t.Fatalf("different history: %v, %d leaves", err, fm.LeafCount())
+	}
+	// nor one ahead of the leader
+	fm, _ = gommr.NewMMR(gommr.NewMemStore())
+	for _, leaf := range leaves(0, int(count)+1) {
+		fm.Push(leaf)
+	}
+	if err := sync(NewFollower(fm, verifier)); err != ErrDiverged {
+		t.Fatalf("follower ahead: %v", err)
+	}
+	// nor one of another log
+	_, other := newKey(t, "example.com/log")
+	fm, _ = gommr.NewMMR(gommr.NewMemStore())
+	if err := sync(NewFollower(fm, other)); err != checkpoint.ErrUnverified || fm.LeafCount() != 0 {
+		t.Fatalf("checkpoint of another key: %v", err)
+	}
+}
+
+func TestFollowerGone(t *testing.T) {
+	signer, _ := newKey(t, "example.com/log")
+	lm, _ := gommr.NewMMR(gommr.NewMemStore())
+	leader := NewLeader(lm, signer)
+	defer leader.Close()
+	leader.Append(leaves(0, 3)...)
+	addr := serve(t, leader, "127.0.0.1:0")
+	conns := func() int {
+		leader.lock.Lock()
+		defer leader.lock.Unlock()
+		return len(leader.conns)
+	}
+	for i := 0; i < 3; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// take the first batch, then leave
+		var b Batch
+		if err := rlp.Encode(conn, Hello{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := rlp.NewStream(conn, 0).Decode(&b); err != nil || len(b.Leaves) != 3 {
+			t.Fatalf("first batch of %d leaves: %v", len(b.Leaves), err)
+		}
+		conn.Close()
+	}
+	// the leader drops the connections without waiting for an append
+	deadline := time.Now().Add(10 * time.Second)
+	for conns() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d connections of gone followers left", conns())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
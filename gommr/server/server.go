@@ -0,0 +1,359 @@
+// Package server exposes an mmr over HTTP with JSON bodies and hex hashes:
+//
+//	POST /append                  {"leaves": [hash, ...]}
+//	GET  /root
+//	GET  /proof/{leaf}
+//	GET  /consistency?from=&to=   mmr sizes, to defaults to the current size
+//	GET  /leaves?start=&end=      leaf indices, end is exclusive
+//
+// Errors are answered with {"error": message}, a failed append also tells
+// how many of its leaves made it in, see AppendError. An append is only
+// answered once the store given WithSync is synced. Package client talks
+// to it.
+package server
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-mmr/gommr"
+)
+
+// MaxLeaves bounds the leaves of one append or leaves request.
+const MaxLeaves = 1024
+
+// Hash is a gommr.Hash in hex in JSON.
+type Hash gommr.Hash
+
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(h[:])), nil
+}
+
+func (h *Hash) UnmarshalText(b []byte) error {
+	s := strings.TrimPrefix(string(b), "0x")
+	if hex.DecodedLen(len(s)) != len(h) {
+		return errors.New("server: hash is not 32 bytes")
+	}
+	_, err := hex.Decode(h[:], []byte(s))
+	return err
+}
+
+// Hashes converts hashes to their JSON form.
+func Hashes(hashes []gommr.Hash) []Hash {
+	res := make([]Hash, len(hashes))
+	for i, h := range hashes {
+		res[i] = Hash(h)
+	}
+	return res
+}
+
+// GommrHashes converts hashes from their JSON form.
+func GommrHashes(hashes []Hash) []gommr.Hash {
+	res := make([]gommr.Hash, len(hashes))
+	for i, h := range hashes {
+		res[i] = gommr.Hash(h)
+	}
+	return res
+}
+
+// AppendRequest is the body of POST /append.
+type AppendRequest struct {
+	Leaves []Hash `json:"leaves"`
+}
+
+// Root is the reply of GET /root.
+type Root struct {
+	Size      uint64 `json:"size"`
+	LeafCount uint64 `json:"leaf_count"`
+	Root      Hash   `json:"root"`
+}
+
+// AppendResponse is the reply of POST /append, First is the index of the
+// first appended leaf.
+type AppendResponse struct {
+	First uint64 `json:"first"`
+	Root
+}
+
+// Proof is the reply of GET /proof/{leaf}, an inclusion proof against the
+// root of Size nodes.
+type Proof struct {
+	Leaf     uint64 `json:"leaf"`
+	LeafHash Hash   `json:"leaf_hash"`
+	Size     uint64 `json:"size"`
+	Root     Hash   `json:"root"`
+	Items    []Hash `json:"items"`
+}
+
+// Consistency is the reply of GET /consistency.
+type Consistency struct {
+	OldSize  uint64 `json:"old_size"`
+	NewSize  uint64 `json:"new_size"`
+	OldPeaks []Hash `json:"old_peaks"`
+	Items    []Hash `json:"items"`
+}
+
+// Leaves is the reply of GET /leaves.
+type Leaves struct {
+	Start  uint64 `json:"start"`
+	Leaves []Hash `json:"leaves"`
+}
+
+// Error is the reply of a failed request.
+type Error struct {
+	Error string `json:"error"`
+}
+
+// AppendError is the reply of an append that failed after appending the
+// first Appended leaves of the request, from leaf index First on. When
+// only the sync failed, all of them are appended but may be lost.
+type AppendError struct {
+	Error    string `json:"error"`
+	First    uint64 `json:"first"`
+	Appended uint64 `json:"appended"`
+}
+
+// Server serves an mmr. Appends are serialized with the reads, so a proof
+// always matches the root it is sent with.
+type Server struct {
+	lock  sync.RWMutex
+	mmr   *gommr.MMR
+	store Syncer
+	mux   *http.ServeMux
+}
+
+// Syncer is a store that can be flushed to disk, such as gommr.FileStore.
+type Syncer interface {
+	Sync() error
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithSync makes the server sync store, the store of the mmr, before it
+// answers an append. Without it appends are acknowledged as soon as the
+// mmr holds them.
+func WithSync(store Syncer) Option {
+	return func(s *Server) {
+		s.store = store
+	}
+}
+
+// New returns a server of m.
+func New(m *gommr.MMR, opts ...Option) *Server {
+	s := &Server{mmr: m, mux: http.NewServeMux()}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.mux.HandleFunc("/append", s.append)
+	s.mux.HandleFunc("/root", s.root)
+	s.mux.HandleFunc("/proof/", s.proof)
+	s.mux.HandleFunc("/consistency", s.consistency)
+	s.mux.HandleFunc("/leaves", s.leaves)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func reply(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func fail(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Error{err.Error()})
+}
+
+func failAppend(w http.ResponseWriter, err error, first, appended uint64) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(AppendError{Error: err.Error(), First: first, Appended: appended})
+}
+
+func errStatus(err error) int {
+	switch err {
+	case gommr.ErrOutOfRange, gommr.ErrBadSize:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func method(w http.ResponseWriter, r *http.Request, m string) bool {
+	if r.Method != m {
+		fail(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return false
+	}
+	return true
+}
+
+func (s *Server) currentRoot() (Root, error) {
+	root, err := s.mmr.Root()
+	if err != nil {
+		return Root{}, err
+	}
+	return Root{Size: s.mmr.Size(), LeafCount: s.mmr.LeafCount(), Root: Hash(root)}, nil
+}
+
+func (s *Server) append(w http.ResponseWriter, r *http.Request) {
+	if !method(w, r, http.MethodPost) {
+		return
+	}
+	var req AppendRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		fail(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(req.Leaves) == 0 || len(req.Leaves) > MaxLeaves {
+		fail(w, http.StatusBadRequest, errors.New("append 1 to 1024 leaves"))
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	first := s.mmr.LeafCount()
+	for i, leaf := range req.Leaves {
+		if _, err := s.mmr.Push(gommr.Hash(leaf)); err != nil {
+			failAppend(w, err, first, uint64(i))
+			return
+		}
+	}
+	if s.store != nil {
+		// the leaves are in but may not survive a crash
+		if err := s.store.Sync(); err != nil {
+			failAppend(w, err, first, uint64(len(req.Leaves)))
+			return
+		}
+	}
+	root, err := s.currentRoot()
+	if err != nil {
+		fail(w, http.StatusInternalServerError, err)
+		return
+	}
+	reply(w, AppendResponse{First: first, Root: root})
+}
+
+func (s *Server) root(w http.ResponseWriter, r *http.Request) {
+	if !method(w, r, http.MethodGet) {
+		return
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	root, err := s.currentRoot()
+	if err != nil {
+		fail(w, http.StatusInternalServerError, err)
+		return
+	}
+	reply(w, root)
+}
+
+func (s *Server) proof(w http.ResponseWriter, r *http.Request) {
+	if !method(w, r, http.MethodGet) {
+		return
+	}
+	index, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/proof/"), 10, 64)
+	if err != nil {
+		fail(w, http.StatusBadRequest, errors.New("bad leaf index"))
+		return
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if index >= s.mmr.LeafCount() {
+		fail(w, http.StatusNotFound, gommr.ErrOutOfRange)
+		return
+	}
+	pos := gommr.LeafIndexToPos(index)
+	leaf, err := s.mmr.Get(pos)
+	if err != nil {
+		fail(w, errStatus(err), err)
+		return
+	}
+	proof, err := s.mmr.GenProof(pos)
+	if err != nil {
+		fail(w, errStatus(err), err)
+		return
+	}
+	root, err := s.mmr.Root()
+	if err != nil {
+		fail(w, http.StatusInternalServerError, err)
+		return
+	}
+	reply(w, Proof{Leaf: index, LeafHash: Hash(leaf), Size: proof.MmrSize(), Root: Hash(root), Items: Hashes(proof.Proofs())})
+}
+
+func queryUint(r *http.Request, name string, def uint64) (uint64, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, errors.New("bad " + name)
+	}
+	return n, nil
+}
+
+func (s *Server) consistency(w http.ResponseWriter, r *http.Request) {
+	if !method(w, r, http.MethodGet) {
+		return
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	from, err := queryUint(r, "from", 0)
+	if err != nil {
+		fail(w, http.StatusBadRequest, err)
+		return
+	}
+	to, err := queryUint(r, "to", s.mmr.Size())
+	if err != nil {
+		fail(w, http.StatusBadRequest, err)
+		return
+	}
+	p, err := s.mmr.GenConsistencyProof(from, to)
+	if err != nil {
+		fail(w, errStatus(err), err)
+		return
+	}
+	reply(w, Consistency{OldSize: p.OldSize, NewSize: p.NewSize, OldPeaks: Hashes(p.OldPeaks), Items: Hashes(p.Items)})
+}
+
+func (s *Server) leaves(w http.ResponseWriter, r *http.Request) {
+	if !method(w, r, http.MethodGet) {
+		return
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	count := s.mmr.LeafCount()
+	start, err := queryUint(r, "start", 0)
+	if err != nil {
+		fail(w, http.StatusBadRequest, err)
+		return
+	}
+	end, err := queryUint(r, "end", count)
+	if err != nil {
+		fail(w, http.StatusBadRequest, err)
+		return
+	}
+	if start > end || end > count || end-start > MaxLeaves {
+		fail(w, http.StatusBadRequest, errors.New("bad leaf range"))
+		return
+	}
+	res := Leaves{Start: start, Leaves: []Hash{}}
+	for i := start; i < end; i++ {
+		h, err := s.mmr.Get(gommr.LeafIndexToPos(i))
+		if err != nil {
+			fail(w, errStatus(err), err)
+			return
+		}
+		res.Leaves = append(res.Leaves, Hash(h))
+	}
+	reply(w, res)
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-mmr/gommr"
+)
+
+var errFull = errors.New("store is full")
+
+// fullStore fails every append once it holds limit nodes.
+type fullStore struct {
+	*gommr.MemStore
+	limit uint64
+}
+
+func (s *fullStore) Append(pos uint64, hashes []gommr.Hash) error {
+	if pos+uint64(len(hashes)) > s.limit {
+		return errFull
+	}
+	return s.MemStore.Append(pos, hashes)
+}
+
+func do(t *testing.T, h http.Handler, method, target, body string, res interface{}) int {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	if res != nil {
+		if err := json.NewDecoder(w.Body).Decode(res); err != nil {
+			t.Fatalf("%s %s: %v", method, target, err)
+		}
+	}
+	return w.Code
+}
+
+func leavesBody(from, to int) string {
+	var req AppendRequest
+	for i := from; i < to; i++ {
+		req.Leaves = append(req.Leaves, Hash(gommr.RlpHash(uint64(i))))
+	}
+	b, _ := json.Marshal(req)
+	return string(b)
+}
+
+func TestServer(t *testing.T) {
+	m, _ := gommr.NewMMR(gommr.NewMemStore())
+	s := New(m)
+	var res AppendResponse
+	if code := do(t, s, http.MethodPost, "/append", leavesBody(0, 11), &res); code != http.StatusOK || res.First != 0 || res.LeafCount != 11 {
+		t.Fatalf("append: %d %+v", code, res)
+	}
+	root, _ := m.Root()
+	var r Root
+	if do(t, s, http.MethodGet, "/root", "", &r); gommr.Hash(r.Root) != root || r.Size != m.Size() {
+		t.Fatalf("root %+v", r)
+	}
+	var p Proof
+	do(t, s, http.MethodGet, "/proof/7", "", &p)
+	proof := gommr.NewMerkleProof(p.Size, GommrHashes(p.Items))
+	if !proof.Verify(root, gommr.LeafIndexToPos(7), gommr.RlpHash(uint64(7))) || gommr.Hash(p.LeafHash) != gommr.RlpHash(uint64(7)) {
+		t.Fatalf("proof %+v", p)
+	}
+	var l Leaves
+	if do(t, s, http.MethodGet, "/leaves?start=9", "", &l); l.Start != 9 || len(l.Leaves) != 2 {
+		t.Fatalf("leaves %+v", l)
+	}
+
+	for _, tc := range []struct {
+		method, target, body string
+		status               int
+	}{
+		{http.MethodGet, "/append", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/root", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/append", "{", http.StatusBadRequest},
+		{http.MethodPost, "/append", `{"leaves": ["00"]}`, http.StatusBadRequest},
+		{http.MethodPost, "/append", `{"leaves": []}`, http.StatusBadRequest},
+		{http.MethodPost, "/append", leavesBody(0, MaxLeaves+1), http.StatusBadRequest},
+		{http.MethodGet, "/proof/x", "", http.StatusBadRequest},
+		{http.MethodGet, "/proof/11", "", http.StatusNotFound},
+		{http.MethodGet, "/consistency?from=5", "", http.StatusBadRequest},
+		{http.MethodGet, "/consistency?from=y", "", http.StatusBadRequest},
+		{http.MethodGet, "/leaves?start=3&end=2", "", http.StatusBadRequest},
+		{http.MethodGet, "/leaves?end=12", "", http.StatusBadRequest},
+	} {
+		var e Error
+		if code := do(t, s, tc.method, tc.target, tc.body, &e); code != tc.status || e.Error == "" {
+			t.Fatalf("%s %s: %d %q, want %d", tc.method, tc.target, code, e.Error, tc.status)
+		}
+	}
+	if r, _ := m.Root(); r != root {
+		t.Fatal("failed requests changed the mmr")
+	}
+}
+
+func TestPartialAppend(t *testing.T) {
+	// room for 5 leaves, 8 nodes
+	m, _ := gommr.NewMMR(&fullStore{MemStore: gommr.NewMemStore(), limit: 8})
+	s := New(m)
+	do(t, s, http.MethodPost, "/append", leavesBody(0, 2), nil)
+	var e AppendError
+	code := do(t, s, http.MethodPost, "/append", leavesBody(2, 8), &e)
+	if code != http.StatusInternalServerError || e.Error != errFull.Error() || e.First != 2 || e.Appended != 3 {
+		t.Fatalf("append: %d %+v", code, e)
+	}
+	if m.LeafCount() != 5 {
+		t.Fatalf("%d leaves after a partial append", m.LeafCount())
+	}
+}
+
+// syncStore counts its syncs and fails them once failing is set.
+type syncStore struct {
+	*gommr.MemStore
+	syncs   int
+	failing bool
+}
+
+func (s *syncStore) Sync() error {
+	if s.failing {
+		return errFull
+	}
+	s.syncs++
+	return nil
+}
+
+func TestAppendSync(t *testing.T) {
+	store := &syncStore{MemStore: gommr.NewMemStore()}
+	m, _ := gommr.NewMMR(store)
+	s := New(m, WithSync(store))
+	if code := do(t, s, http.MethodPost, "/append", leavesBody(0, 3), nil); code != http.StatusOK || store.syncs != 1 {
+		t.Fatalf("append: %d after %d syncs", code, store.syncs)
+	}
+	store.failing = true
+	var e AppendError
+	if code := do(t, s, http.MethodPost, "/append", leavesBody(3, 5), &e); code != http.StatusInternalServerError || e.First != 3 || e.Appended != 2 {
+		t.Fatalf("append with a failing sync: %d %+v", code, e)
+	}
+}
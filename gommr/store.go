@@ -0,0 +1,219 @@
+package gommr
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+var (
+	ErrOutOfRange = errors.New("gommr: position out of range")
+	ErrBadAppend  = errors.New("gommr: append position does not match store size")
+	ErrBadSize    = errors.New("gommr: not a valid mmr size")
+	ErrNoRewrite  = errors.New("gommr: store cannot rewrite nodes")
+)
+
+// Store holds the node hashes of an mmr by position. Positions are written
+// in order, a push hands the new leaf and all parents it creates to a
+// single Append call.
+type Store interface {
+	// Get returns the hash at pos.
+	Get(pos uint64) (Hash, error)
+	// Append writes hashes at pos, pos+1, ... pos must equal Size.
+	Append(pos uint64, hashes []Hash) error
+	// Size returns the number of stored positions.
+	Size() uint64
+	// Truncate drops all positions from size on.
+	Truncate(size uint64) error
+}
+
+// Rewriter is a Store that can overwrite a stored hash, which Rebuild
+// needs to repair nodes in place.
+type Rewriter interface {
+	Rewrite(pos uint64, h Hash) error
+}
+
+// MemStore keeps all hashes in memory.
+type MemStore struct {
+	lock   sync.RWMutex
+	hashes []Hash
+}
+
+func NewMemStore() *MemStore {
+	return &MemStore{}
+}
+
+func (s *MemStore) Get(pos uint64) (Hash, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if pos >= uint64(len(s.hashes)) {
+		return Hash{}, ErrOutOfRange
+	}
+	return s.hashes[pos], nil
+}
+
+func (s *MemStore) Append(pos uint64, hashes []Hash) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if pos != uint64(len(s.hashes)) {
+		return ErrBadAppend
+	}
+	s.hashes = append(s.hashes, hashes...)
+	return nil
+}
+
+func (s *MemStore) Size() uint64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return uint64(len(s.hashes))
+}
+
+func (s *MemStore) Truncate(size uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if size > uint64(len(s.hashes)) {
+		return ErrOutOfRange
+	}
+	s.hashes = s.hashes[:size]
+	return nil
+}
+
+func (s *MemStore) Rewrite(pos uint64, h Hash) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if pos >= uint64(len(s.hashes)) {
+		return ErrOutOfRange
+	}
+	s.hashes[pos] = h
+	return nil
+}
+
+// FileStore keeps hashes in a flat file, the hash at pos lives at offset
+// pos*32. Every append is first journaled in a write-ahead log next to
+// the file, see wal.go, so an append cut short by a crash is either
+// completed or dropped on open. The store always opens at a valid mmr
+// size.
+type FileStore struct {
+	lock sync.RWMutex
+	file *os.File
+	wal  *os.File
+	size uint64
+	// dirty is set while written hashes may not be on disk yet
+	dirty bool
+	// SyncWAL makes every append wait for its journal entry, and for the
+	// hashes of the append before, to reach the disk. An append that
+	// returned then survives a power loss. Without it appends only
+	// survive crashes of the process, see wal.go, until the next Sync.
+	SyncWAL bool
+}
+
+// OpenFileStore opens or creates the store at path and its journal at
+// path.wal, recovering from an interrupted append.
+func OpenFileStore(path string) (*FileStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	wal, err := os.OpenFile(path+".wal", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	s := &FileStore{file: f, wal: wal}
+	if err := s.recover(); err != nil {
+		f.Close()
+		wal.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStore) Get(pos uint64) (Hash, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var h Hash
+	if pos >= s.size {
+		return h, ErrOutOfRange
+	}
+	if _, err := s.file.ReadAt(h[:], int64(pos*32)); err != nil && err != io.EOF {
+		return h, err
+	}
+	return h, nil
+}
+
+func (s *FileStore) Append(pos uint64, hashes []Hash) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if pos != s.size {
+		return ErrBadAppend
+	}
+	if err := s.journal(pos, hashes); err != nil {
+		return err
+	}
+	if err := s.write(pos, hashes); err != nil {
+		return err
+	}
+	s.size += uint64(len(hashes))
+	return nil
+}
+
+func (s *FileStore) Size() uint64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.size
+}
+
+func (s *FileStore) Truncate(size uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if size > s.size {
+		return ErrOutOfRange
+	}
+	// the journaled append must not come back on the next open
+	if err := s.wal.Truncate(0); err != nil {
+		return err
+	}
+	if err := s.file.Truncate(int64(size * 32)); err != nil {
+		return err
+	}
+	s.size = size
+	return nil
+}
+
+// Rewrite overwrites the hash at pos in the file. It is not journaled: a
+// torn write leaves a node that a check finds again.
+func (s *FileStore) Rewrite(pos uint64, h Hash) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if pos >= s.size {
+		return ErrOutOfRange
+	}
+	s.dirty = true
+	_, err := s.file.WriteAt(h[:], int64(pos*32))
+	return err
+}
+
+// Sync flushes the file and the journal to disk.
+func (s *FileStore) Sync() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.wal.Sync(); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+func (s *FileStore) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	err := s.wal.Close()
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,99 @@
+package gommr
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func leafHash(i int) Hash {
+	return RlpHash(uint64(i))
+}
+
+func buildMMR(t *testing.T, store Store, count int) *MMR {
+	m, err := NewMMR(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int(m.LeafCount()); i < count; i++ {
+		if _, err := m.Push(leafHash(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+func TestMMRProofs(t *testing.T) {
+	m := buildMMR(t, NewMemStore(), 77)
+	root, err := m.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 77; i++ {
+		pos := LeafIndexToPos(uint64(i))
+		proof, err := m.GenProof(pos)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !proof.Verify(root, pos, leafHash(i)) {
+			t.Fatalf("proof for leaf %d failed", i)
+		}
+		if proof.Verify(root, pos, leafHash(i+1)) {
+			t.Fatalf("proof for leaf %d accepted wrong leaf", i)
+		}
+	}
+}
+
+func TestFileStoreReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nodes")
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := buildMMR(t, store, 40)
+	want, _ := m.Root()
+	store.Close()
+
+	// a torn write leaves a partial hash at the end of the file
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{1, 2, 3})
+	f.Close()
+
+	store, err = OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	m = buildMMR(t, store, 40)
+	if got, _ := m.Root(); got != want {
+		t.Fatalf("root after reopen %x, want %x", got, want)
+	}
+	m = buildMMR(t, store, 60)
+	if m.LeafCount() != 60 {
+		t.Fatalf("leaf count %d, want 60", m.LeafCount())
+	}
+}
+
+func TestRewind(t *testing.T) {
+	m := buildMMR(t, NewMemStore(), 50)
+	want, _ := buildMMR(t, NewMemStore(), 20).Root()
+	if got, err := m.RootAt(LeafCountToSize(20)); err != nil || got != want {
+		t.Fatalf("root at 20 leaves %x, want %x", got, want)
+	}
+	if err := m.Rewind(LeafCountToSize(20) + 2); err != ErrBadSize {
+		t.Fatalf("rewind to invalid size: %v", err)
+	}
+	if err := m.Rewind(LeafCountToSize(20)); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := m.Root()
+	if got != want {
+		t.Fatalf("root after rewind %x, want %x", got, want)
+	}
+	if _, err := NewMMR(&MemStore{hashes: make([]Hash, 2)}); err != ErrBadSize {
+		t.Fatalf("opened store with invalid size: %v", err)
+	}
+}
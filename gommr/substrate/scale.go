@@ -0,0 +1,151 @@
+package substrate
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+
+	"github.com/go-mmr/gommr"
+)
+
+var (
+	errShortInput    = errors.New("substrate: unexpected end of input")
+	errTrailingInput = errors.New("substrate: trailing bytes after proof")
+	errCompact       = errors.New("substrate: invalid compact integer")
+)
+
+// appendCompact appends the scale compact encoding of v.
+func appendCompact(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<6:
+		return append(b, byte(v<<2))
+	case v < 1<<14:
+		return binary.LittleEndian.AppendUint16(b, uint16(v<<2|1))
+	case v < 1<<30:
+		return binary.LittleEndian.AppendUint32(b, uint32(v<<2|2))
+	}
+	n := (bits.Len64(v) + 7) / 8
+	b = append(b, byte((n-4)<<2|3))
+	for i := 0; i < n; i++ {
+		b = append(b, byte(v>>(8*i)))
+	}
+	return b
+}
+
+type scaleReader struct {
+	b []byte
+}
+
+func (r *scaleReader) take(n int) ([]byte, error) {
+	if len(r.b) < n {
+		return nil, errShortInput
+	}
+	res := r.b[:n]
+	r.b = r.b[n:]
+	return res, nil
+}
+
+func (r *scaleReader) compact() (uint64, error) {
+	head, err := r.take(1)
+	if err != nil {
+		return 0, err
+	}
+	switch head[0] & 3 {
+	case 0:
+		return uint64(head[0] >> 2), nil
+	case 1:
+		rest, err := r.take(1)
+		if err != nil {
+			return 0, err
+		}
+		v := uint64(binary.LittleEndian.Uint16([]byte{head[0], rest[0]}) >> 2)
+		if v < 1<<6 {
+			return 0, errCompact
+		}
+		return v, nil
+	case 2:
+		rest, err := r.take(3)
+		if err != nil {
+			return 0, err
+		}
+		v := uint64(binary.LittleEndian.Uint32(append([]byte{head[0]}, rest...)) >> 2)
+		if v < 1<<14 {
+			return 0, errCompact
+		}
+		return v, nil
+	}
+	n := int(head[0]>>2) + 4
+	if n > 8 {
+		return 0, errCompact
+	}
+	rest, err := r.take(n)
+	if err != nil {
+		return 0, err
+	}
+	v := uint64(0)
+	for i := n - 1; i >= 0; i-- {
+		v = v<<8 | uint64(rest[i])
+	}
+	if v < 1<<30 || rest[n-1] == 0 {
+		return 0, errCompact
+	}
+	return v, nil
+}
+
+func (r *scaleReader) u64() (uint64, error) {
+	b, err := r.take(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(b), nil
+}
+
+// Encode returns the scale encoding of the proof.
+func (p *Proof) Encode() []byte {
+	b := appendCompact(nil, uint64(len(p.LeafIndices)))
+	for _, index := range p.LeafIndices {
+		b = binary.LittleEndian.AppendUint64(b, index)
+	}
+	b = binary.LittleEndian.AppendUint64(b, p.LeafCount)
+	b = appendCompact(b, uint64(len(p.Items)))
+	for _, item := range p.Items {
+		b = append(b, item[:]...)
+	}
+	return b
+}
+
+// DecodeProof decodes a scale encoded proof.
+func DecodeProof(b []byte) (*Proof, error) {
+	r := &scaleReader{b}
+	n, err := r.compact()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(r.b))/8 {
+		return nil, errShortInput
+	}
+	p := &Proof{LeafIndices: make([]uint64, n)}
+	for i := range p.LeafIndices {
+		if p.LeafIndices[i], err = r.u64(); err != nil {
+			return nil, err
+		}
+	}
+	if p.LeafCount, err = r.u64(); err != nil {
+		return nil, err
+	}
+	if n, err = r.compact(); err != nil {
+		return nil, err
+	}
+	if n > uint64(len(r.b))/32 {
+		return nil, errShortInput
+	}
+	p.Items = make([]gommr.Hash, n)
+	for i := range p.Items {
+		b, _ := r.take(32)
+		copy(p.Items[i][:], b)
+	}
+	if len(r.b) != 0 {
+		return nil, errTrailingInput
+	}
+	return p, nil
+}
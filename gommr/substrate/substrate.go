@@ -0,0 +1,119 @@
+// Package substrate generates and verifies mmr proofs in the format of
+// Substrate's pallet-mmr, as used by BEEFY: keccak-256 merging and proofs
+// made of leaf indices, the leaf count and the proof items.
+package substrate
+
+import (
+	"errors"
+
+	"github.com/go-mmr/gommr"
+	"golang.org/x/crypto/sha3"
+)
+
+var (
+	ErrLeafIndex  = errors.New("substrate: leaf index out of range")
+	ErrLeafHashes = errors.New("substrate: number of leaves does not match proof")
+	ErrRoot       = errors.New("substrate: root mismatch")
+)
+
+// Keccak256 hashes the concatenation of data.
+func Keccak256(data ...[]byte) gommr.Hash {
+	hw := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		hw.Write(d)
+	}
+	var h gommr.Hash
+	hw.Sum(h[:0])
+	return h
+}
+
+// LeafHash returns the hash of a scale encoded leaf.
+func LeafHash(encoded []byte) gommr.Hash {
+	return Keccak256(encoded)
+}
+
+type merger struct{}
+
+func (merger) Merge(pos uint64, left, right gommr.Hash) gommr.Hash {
+	return Keccak256(left[:], right[:])
+}
+
+// BagPeaks hashes the right hand side first, like merge_peaks in mmr-lib.
+func (merger) BagPeaks(mmrSize uint64, left, right gommr.Hash) gommr.Hash {
+	return Keccak256(right[:], left[:])
+}
+
+// Merger is the keccak-256 merge of pallet-mmr.
+var Merger gommr.Merger = merger{}
+
+func init() {
+	gommr.RegisterScheme(gommr.Scheme{Name: "substrate", HashCode: gommr.Keccak256, Merger: Merger})
+}
+
+// NewMMR opens an mmr on store that merges like pallet-mmr.
+func NewMMR(store gommr.Store) (*gommr.MMR, error) {
+	return gommr.NewMMR(store, gommr.WithScheme("substrate"))
+}
+
+// Proof is sp_mmr_primitives::LeafProof.
+type Proof struct {
+	LeafIndices []uint64
+	LeafCount   uint64
+	Items       []gommr.Hash
+}
+
+// GenerateProof proves the leaves with the given indices against the
+// current root of m.
+func GenerateProof(m *gommr.MMR, leafIndices []uint64) (*Proof, error) {
+	return GenerateHistoricalProof(m, leafIndices, m.LeafCount())
+}
+
+// GenerateHistoricalProof proves the leaves against the root the mmr had
+// when it held leafCount leaves.
+func GenerateHistoricalProof(m *gommr.MMR, leafIndices []uint64, leafCount uint64) (*Proof, error) {
+	positions := make([]uint64, len(leafIndices))
+	for i, index := range leafIndices {
+		if index >= leafCount {
+			return nil, ErrLeafIndex
+		}
+		positions[i] = gommr.LeafIndexToPos(index)
+	}
+	p, err := m.GenBatchProofAt(positions, gommr.LeafCountToSize(leafCount))
+	if err != nil {
+		return nil, err
+	}
+	return &Proof{
+		LeafIndices: append([]uint64{}, leafIndices...),
+		LeafCount:   leafCount,
+		Items:       p.Items,
+	}, nil
+}
+
+// CalculateRoot returns the root the proof leads to, leaves holds the
+// leaf hashes in the order of LeafIndices.
+func (p *Proof) CalculateRoot(leaves []gommr.Hash) (gommr.Hash, error) {
+	if len(leaves) != len(p.LeafIndices) {
+		return gommr.Hash{}, ErrLeafHashes
+	}
+	nodes := make([]gommr.Leaf, len(leaves))
+	for i, index := range p.LeafIndices {
+		if index >= p.LeafCount {
+			return gommr.Hash{}, ErrLeafIndex
+		}
+		nodes[i] = gommr.Leaf{Pos: gommr.LeafIndexToPos(index), Hash: leaves[i]}
+	}
+	batch := &gommr.BatchProof{MmrSize: gommr.LeafCountToSize(p.LeafCount), Items: p.Items}
+	return batch.CalculateRoot(Merger, nodes)
+}
+
+// Verify checks the proof for leaves against root.
+func (p *Proof) Verify(root gommr.Hash, leaves []gommr.Hash) error {
+	h, err := p.CalculateRoot(leaves)
+	if err != nil {
+		return err
+	}
+	if h != root {
+		return ErrRoot
+	}
+	return nil
+}
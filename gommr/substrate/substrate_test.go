@@ -0,0 +1,196 @@
+package substrate
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/go-mmr/gommr"
+)
+
+func leafData(i int) []byte {
+	// scale encoded u32
+	return []byte{byte(i), byte(i >> 8), byte(i >> 16), byte(i >> 24)}
+}
+
+func build(t *testing.T, count int) *gommr.MMR {
+	m, err := NewMMR(gommr.NewMemStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < count; i++ {
+		if _, err := m.Push(LeafHash(leafData(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+func cat(hs ...gommr.Hash) []byte {
+	var b []byte
+	for _, h := range hs {
+		b = append(b, h[:]...)
+	}
+	return b
+}
+
+// TestVectors spells out the hashing for small mmrs:
+//
+//	    6
+//	  2   5
+//	 0 1 3 4 7
+func TestVectors(t *testing.T) {
+	var l [5]gommr.Hash
+	for i := range l {
+		l[i] = Keccak256(leafData(i))
+	}
+	n2 := Keccak256(cat(l[0], l[1]))
+	n5 := Keccak256(cat(l[2], l[3]))
+	n6 := Keccak256(cat(n2, n5))
+
+	roots := []gommr.Hash{
+		l[0],
+		n2,
+		Keccak256(cat(l[2], n2)),
+		n6,
+		Keccak256(cat(l[4], n6)),
+	}
+	for i, want := range roots {
+		root, err := build(t, i+1).Root()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if root != want {
+			t.Errorf("%d leaves: root %x, want %x", i+1, root, want)
+		}
+	}
+
+	m := build(t, 5)
+	proof, err := GenerateProof(m, []uint64{2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Proof{LeafIndices: []uint64{2}, LeafCount: 5, Items: []gommr.Hash{l[3], n2, l[4]}}
+	if !bytes.Equal(proof.Encode(), want.Encode()) {
+		t.Fatalf("proof items %x, want %x", proof.Items, want.Items)
+	}
+	enc := "04" + "0200000000000000" + "0500000000000000" + "0c" +
+		hex.EncodeToString(cat(l[3], n2, l[4]))
+	if got := hex.EncodeToString(proof.Encode()); got != enc {
+		t.Fatalf("encoding %s, want %s", got, enc)
+	}
+	if err := proof.Verify(roots[4], []gommr.Hash{l[2]}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBatchAndHistoricalProofs(t *testing.T) {
+	m := build(t, 45)
+	for _, count := range []uint64{1, 2, 9, 31, 45} {
+		want, _ := build(t, int(count)).Root()
+		indices := []uint64{0, count / 2, count - 1}
+		proof, err := GenerateHistoricalProof(m, indices, count)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dec, err := DecodeProof(proof.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaves := make([]gommr.Hash, len(indices))
+		for i, index := range indices {
+			leaves[i] = LeafHash(leafData(int(index)))
+		}
+		if err := dec.Verify(want, leaves); err != nil {
+			t.Fatalf("%d leaves: %v", count, err)
+		}
+		leaves[0][0] ^= 1
+		if err := dec.Verify(want, leaves); err == nil {
+			t.Fatalf("%d leaves: wrong leaf accepted", count)
+		}
+	}
+	if _, err := GenerateHistoricalProof(m, []uint64{10}, 10); err != ErrLeafIndex {
+		t.Fatalf("proof for leaf beyond count: %v", err)
+	}
+}
+
+// TestSubstrateVectors checks the roots and encoded LeafProofs exported
+// from mmr-lib by testdata/export.
+func TestSubstrateVectors(t *testing.T) {
+	data, err := os.ReadFile("testdata/vectors.json")
+	if os.IsNotExist(err) {
+		t.Skip("testdata/vectors.json not exported yet, see testdata/README")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v struct {
+		Cases []struct {
+			Leaves uint64 `json:"leaves"`
+			Root   string `json:"root"`
+			Proofs []struct {
+				LeafIndices []uint64 `json:"leaf_indices"`
+				Encoded     string   `json:"encoded"`
+			} `json:"proofs"`
+		} `json:"cases"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	m := build(t, 40)
+	for _, c := range v.Cases {
+		root, err := m.RootAt(gommr.LeafCountToSize(c.Leaves))
+		if err != nil || hex.EncodeToString(root[:]) != c.Root {
+			t.Fatalf("%d leaves: root %x %v, want %s", c.Leaves, root, err, c.Root)
+		}
+		for _, vp := range c.Proofs {
+			proof, err := GenerateHistoricalProof(m, vp.LeafIndices, c.Leaves)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hex.EncodeToString(proof.Encode()); got != vp.Encoded {
+				t.Fatalf("%d leaves, proof for %v: encoding %s, want %s", c.Leaves, vp.LeafIndices, got, vp.Encoded)
+			}
+			enc, _ := hex.DecodeString(vp.Encoded)
+			dec, err := DecodeProof(enc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			leaves := make([]gommr.Hash, len(vp.LeafIndices))
+			for i, index := range vp.LeafIndices {
+				leaves[i] = LeafHash(leafData(int(index)))
+			}
+			if err := dec.Verify(root, leaves); err != nil {
+				t.Fatalf("%d leaves, proof for %v: %v", c.Leaves, vp.LeafIndices, err)
+			}
+		}
+	}
+}
+
+func TestCompact(t *testing.T) {
+	cases := map[uint64]string{
+		0:       "00",
+		1:       "04",
+		63:      "fc",
+		64:      "0101",
+		16383:   "fdff",
+		16384:   "02000100",
+		1 << 30: "0300000040",
+		1 << 32: "070000000001",
+	}
+	for v, want := range cases {
+		enc := appendCompact(nil, v)
+		if hex.EncodeToString(enc) != want {
+			t.Errorf("compact(%d) = %x, want %s", v, enc, want)
+		}
+		got, err := (&scaleReader{enc}).compact()
+		if err != nil || got != v {
+			t.Errorf("decode %s = %d, %v", want, got, err)
+		}
+	}
+	if _, err := DecodeProof([]byte{0x04, 1, 2}); err == nil {
+		t.Error("short proof decoded")
+	}
+}
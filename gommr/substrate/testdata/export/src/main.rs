@@ -0,0 +1,79 @@
+// Exports vectors.json from mmr-lib, the mmr crate under pallet-mmr, and
+// encodes its proofs as sp_mmr_primitives::LeafProof:
+//
+//     cargo run --manifest-path export/Cargo.toml > vectors.json
+use codec::Encode;
+use mmr_lib::{leaf_index_to_pos, util::MemMMR, Merge, Result};
+use serde_json::json;
+use sp_core::H256;
+use sp_mmr_primitives::LeafProof;
+use tiny_keccak::{Hasher, Keccak};
+
+fn keccak(data: &[&[u8]]) -> [u8; 32] {
+    let mut k = Keccak::v256();
+    for d in data {
+        k.update(d);
+    }
+    let mut out = [0u8; 32];
+    k.finalize(&mut out);
+    out
+}
+
+// Keccak256 merges like pallet_mmr::Hasher<Keccak256, _>.
+struct Keccak256;
+
+impl Merge for Keccak256 {
+    type Item = [u8; 32];
+    fn merge(left: &Self::Item, right: &Self::Item) -> Result<Self::Item> {
+        Ok(keccak(&[left, right]))
+    }
+}
+
+// leaf hashes the scale encoded u32 index, like leafData in the go tests.
+fn leaf(i: u64) -> [u8; 32] {
+    keccak(&[&(i as u32).encode()])
+}
+
+const LEAVES: u64 = 40;
+
+fn main() {
+    let mut cases = Vec::new();
+    for count in 1..=LEAVES {
+        let mut mmr = MemMMR::<[u8; 32], Keccak256>::default();
+        for i in 0..count {
+            mmr.push(leaf(i)).unwrap();
+        }
+        let root = mmr.get_root().unwrap();
+        let mut sets = vec![vec![0], vec![count - 1], vec![count / 2]];
+        if count > 2 {
+            sets.push(vec![0, count / 2, count - 1]);
+        }
+        let mut proofs = Vec::new();
+        for indices in sets {
+            let leaves: Vec<(u64, [u8; 32])> = indices.iter().map(|&i| (leaf_index_to_pos(i), leaf(i))).collect();
+            let proof = mmr.gen_proof(leaves.iter().map(|l| l.0).collect()).unwrap();
+            assert!(proof.verify(root, leaves).unwrap());
+            let encoded = LeafProof::<H256> {
+                leaf_indices: indices.clone(),
+                leaf_count: count,
+                items: proof.proof_items().iter().map(|h| H256::from(*h)).collect(),
+            }
+            .encode();
+            proofs.push(json!({
+                "leaf_indices": indices,
+                "encoded": hex::encode(encoded),
+            }));
+        }
+        cases.push(json!({
+            "leaves": count,
+            "root": hex::encode(root),
+            "proofs": proofs,
+        }));
+    }
+    let out = json!({
+        "merge": "keccak256(left || right)",
+        "leaf": "keccak256(scale u32 index)",
+        "cases": cases,
+    });
+    println!("{}", serde_json::to_string_pretty(&out).unwrap());
+}
@@ -0,0 +1,124 @@
+package utreexo
+
+import (
+	"github.com/go-mmr/gommr"
+)
+
+// Forest keeps every node, in gommr position order, so that it can prove
+// any leaf. Bridge nodes run a Forest, everybody else an Accumulator.
+type Forest struct {
+	nodes     []gommr.Hash
+	numLeaves uint64
+	merger    gommr.Merger
+}
+
+// NewForest returns an empty forest merging with gommr's default merger.
+func NewForest() *Forest {
+	return &Forest{merger: gommr.DefaultMerger}
+}
+
+// NumLeaves returns the number of leaves ever added, deleted or not.
+func (f *Forest) NumLeaves() uint64 {
+	return f.numLeaves
+}
+
+// Add appends leaves and records the Addition for proof updates.
+func (f *Forest) Add(leaves []gommr.Hash) (*Addition, error) {
+	for _, l := range leaves {
+		if l == empty {
+			return nil, ErrEmptyLeaf
+		}
+	}
+	add := &Addition{NumLeaves: f.numLeaves, Roots: f.roots(), Leaves: leaves}
+	for _, l := range leaves {
+		height, pos := 0, uint64(len(f.nodes))
+		f.nodes = append(f.nodes, l)
+		for gommr.PosHeight(pos+1) > height {
+			pos++
+			left := f.nodes[pos-gommr.ParentOffset(height)]
+			right := f.nodes[pos-1]
+			f.nodes = append(f.nodes, combine(f.merger, pos, left, right))
+			height++
+		}
+		f.numLeaves++
+	}
+	return add, nil
+}
+
+// climb calls fn for each node on the way from leaf index up to the child
+// of its root, with the positions of the node, its sibling and parent.
+func (f *Forest) climb(index uint64, fn func(pos, sib, parent uint64)) {
+	_, _, height, _ := treeOf(f.numLeaves, index)
+	pos := gommr.LeafIndexToPos(index)
+	for h := 0; h < height; h++ {
+		var sib, parent uint64
+		if gommr.PosHeight(pos+1) > h {
+			sib, parent = pos-gommr.SiblingOffset(h), pos+1
+		} else {
+			sib, parent = pos+gommr.SiblingOffset(h), pos+gommr.ParentOffset(h)
+		}
+		fn(pos, sib, parent)
+		pos = parent
+	}
+}
+
+// Prove returns the proof of the leaf at index.
+func (f *Forest) Prove(index uint64) (*Proof, error) {
+	if index >= f.numLeaves {
+		return nil, ErrLeafIndex
+	}
+	leaf := f.nodes[gommr.LeafIndexToPos(index)]
+	if leaf == empty {
+		return nil, ErrDuplicated
+	}
+	p := &Proof{Index: index, Leaf: leaf}
+	f.climb(index, func(_, sib, _ uint64) {
+		p.Siblings = append(p.Siblings, f.nodes[sib])
+	})
+	return p, nil
+}
+
+// Delete empties the leaves at indices, in order.
+func (f *Forest) Delete(indices []uint64) ([]Deletion, error) {
+	for i, index := range indices {
+		if index >= f.numLeaves {
+			return nil, ErrLeafIndex
+		}
+		if f.nodes[gommr.LeafIndexToPos(index)] == empty {
+			return nil, ErrDuplicated
+		}
+		for _, prev := range indices[:i] {
+			if prev == index {
+				return nil, ErrDuplicated
+			}
+		}
+	}
+	dels := make([]Deletion, 0, len(indices))
+	for _, index := range indices {
+		d := Deletion{Index: index, Path: []gommr.Hash{empty}}
+		f.nodes[gommr.LeafIndexToPos(index)] = empty
+		f.climb(index, func(pos, sib, parent uint64) {
+			if sib < pos {
+				f.nodes[parent] = combine(f.merger, parent, f.nodes[sib], f.nodes[pos])
+			} else {
+				f.nodes[parent] = combine(f.merger, parent, f.nodes[pos], f.nodes[sib])
+			}
+			d.Path = append(d.Path, f.nodes[parent])
+		})
+		dels = append(dels, d)
+	}
+	return dels, nil
+}
+
+func (f *Forest) roots() []gommr.Hash {
+	var roots []gommr.Hash
+	for _, pos := range gommr.Peaks(uint64(len(f.nodes))) {
+		roots = append(roots, f.nodes[pos])
+	}
+	return roots
+}
+
+// Accumulator returns the roots of the forest as an Accumulator.
+func (f *Forest) Accumulator() *Accumulator {
+	return &Accumulator{NumLeaves: f.numLeaves, Roots: f.roots(), merger: f.merger}
+}
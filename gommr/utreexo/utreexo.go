@@ -0,0 +1,248 @@
+// Package utreexo is a dynamic hash accumulator in the style of Utreexo.
+// Leaves live in a forest of perfect trees, one per set bit of the leaf
+// count, which are exactly the mountains of a gommr mmr. Deleting a leaf
+// empties it: a node with two empty children is empty, any other node
+// merges its children as usual, with a deleted one as the zero hash.
+// Proofs stay O(log n).
+//
+// Unlike Utreexo, deletion does not swap leaves into the holes it leaves
+// behind: deleted leaves keep their index and the forest never shrinks,
+// so NumLeaves counts every leaf ever added.
+package utreexo
+
+import (
+	"errors"
+	"math/bits"
+
+	"github.com/go-mmr/gommr"
+)
+
+var (
+	ErrEmptyLeaf  = errors.New("utreexo: zero hash is reserved for deleted leaves")
+	ErrBadProof   = errors.New("utreexo: proof does not verify")
+	ErrLeafIndex  = errors.New("utreexo: leaf index out of range")
+	ErrDuplicated = errors.New("utreexo: leaf deleted twice")
+)
+
+var empty gommr.Hash
+
+// nodePos returns the mmr position of the node at height covering the
+// leaves from index start.
+func nodePos(start uint64, height int) uint64 {
+	return gommr.LeafIndexToPos(start) + (uint64(2) << uint64(height)) - 2
+}
+
+// combine merges two children of a parent at pos. A child is never passed
+// through in place of its parent: an inner node could then be proven as a
+// leaf of its own subtree.
+func combine(merger gommr.Merger, pos uint64, left, right gommr.Hash) gommr.Hash {
+	if left == empty && right == empty {
+		return empty
+	}
+	return merger.Merge(pos, left, right)
+}
+
+// treeOf returns the index, first leaf and height of the tree holding leaf
+// index in a forest of numLeaves leaves. Trees are ordered from the
+// largest, leftmost one.
+func treeOf(numLeaves, index uint64) (tree int, start uint64, height int, ok bool) {
+	if index >= numLeaves {
+		return 0, 0, 0, false
+	}
+	for h := 63; h >= 0; h-- {
+		if numLeaves&(1<<uint(h)) == 0 {
+			continue
+		}
+		size := uint64(1) << uint(h)
+		if index < start+size {
+			return tree, start, h, true
+		}
+		start += size
+		tree++
+	}
+	return 0, 0, 0, false
+}
+
+// Proof proves Leaf at Index. Siblings are ordered bottom-up, deleted
+// siblings are zero.
+type Proof struct {
+	Index    uint64
+	Leaf     gommr.Hash
+	Siblings []gommr.Hash
+}
+
+// path returns the hashes of the leaf's ancestors, from the leaf itself
+// up to the root of its tree, if the leaf had hash leaf.
+func (p *Proof) path(merger gommr.Merger, start uint64, leaf gommr.Hash) []gommr.Hash {
+	path := make([]gommr.Hash, 0, len(p.Siblings)+1)
+	path = append(path, leaf)
+	cur := leaf
+	for h, sib := range p.Siblings {
+		first := start + (p.Index-start)>>uint(h+1)<<uint(h+1)
+		pos := nodePos(first, h+1)
+		if (p.Index>>uint(h))&1 == 0 {
+			cur = combine(merger, pos, cur, sib)
+		} else {
+			cur = combine(merger, pos, sib, cur)
+		}
+		path = append(path, cur)
+	}
+	return path
+}
+
+// Clone returns a deep copy of the proof.
+func (p *Proof) Clone() *Proof {
+	return &Proof{Index: p.Index, Leaf: p.Leaf, Siblings: append([]gommr.Hash{}, p.Siblings...)}
+}
+
+// Accumulator holds only the tree roots. Deleted trees have a zero root.
+// An Accumulator made without New, such as a decoded one, merges with
+// gommr's default merger.
+type Accumulator struct {
+	NumLeaves uint64
+	Roots     []gommr.Hash
+	merger    gommr.Merger
+}
+
+// New returns an empty accumulator merging with gommr's default merger.
+func New() *Accumulator {
+	return &Accumulator{merger: gommr.DefaultMerger}
+}
+
+func (a *Accumulator) getMerger() gommr.Merger {
+	if a.merger == nil {
+		return gommr.DefaultMerger
+	}
+	return a.merger
+}
+
+func (a *Accumulator) clone() *Accumulator {
+	return &Accumulator{NumLeaves: a.NumLeaves, Roots: append([]gommr.Hash{}, a.Roots...), merger: a.merger}
+}
+
+// Addition records an Add so that proofs can be updated.
+type Addition struct {
+	NumLeaves uint64
+	Roots     []gommr.Hash
+	Leaves    []gommr.Hash
+}
+
+// Add appends leaves, merging trees of equal height like gommr's push.
+func (a *Accumulator) Add(leaves []gommr.Hash) (*Addition, error) {
+	for _, l := range leaves {
+		if l == empty {
+			return nil, ErrEmptyLeaf
+		}
+	}
+	add := &Addition{NumLeaves: a.NumLeaves, Roots: append([]gommr.Hash{}, a.Roots...), Leaves: leaves}
+	for _, l := range leaves {
+		node, start := l, a.NumLeaves
+		for h := 0; a.NumLeaves&(1<<uint(h)) != 0; h++ {
+			root := a.Roots[len(a.Roots)-1]
+			a.Roots = a.Roots[:len(a.Roots)-1]
+			start -= uint64(1) << uint(h)
+			node = combine(a.getMerger(), nodePos(start, h+1), root, node)
+		}
+		a.Roots = append(a.Roots, node)
+		a.NumLeaves++
+	}
+	return add, nil
+}
+
+// Verify reports whether the proof holds against the current roots.
+func (a *Accumulator) Verify(p *Proof) bool {
+	if p.Leaf == empty {
+		return false
+	}
+	tree, start, height, ok := treeOf(a.NumLeaves, p.Index)
+	if !ok || len(p.Siblings) != height {
+		return false
+	}
+	path := p.path(a.getMerger(), start, p.Leaf)
+	return path[len(path)-1] == a.Roots[tree]
+}
+
+// Deletion records the deletion of a leaf: the new hashes of its
+// ancestors, bottom-up, starting with the now empty leaf.
+type Deletion struct {
+	Index uint64
+	Path  []gommr.Hash
+}
+
+// Delete removes the proven leaves. Proofs are checked and deleted one by
+// one, updating the remaining proofs of the batch in between.
+func (a *Accumulator) Delete(proofs []*Proof) ([]Deletion, error) {
+	pending := make([]*Proof, len(proofs))
+	for i, p := range proofs {
+		pending[i] = p.Clone()
+	}
+	next := a.clone()
+	dels := make([]Deletion, 0, len(proofs))
+	for i, p := range pending {
+		if !next.Verify(p) {
+			for _, d := range dels {
+				if d.Index == p.Index {
+					return nil, ErrDuplicated
+				}
+			}
+			return nil, ErrBadProof
+		}
+		tree, start, _, _ := treeOf(next.NumLeaves, p.Index)
+		path := p.path(next.getMerger(), start, empty)
+		next.Roots[tree] = path[len(path)-1]
+		d := Deletion{Index: p.Index, Path: path}
+		dels = append(dels, d)
+		for _, q := range pending[i+1:] {
+			q.UpdateDelete(a.NumLeaves, d)
+		}
+	}
+	*a = *next
+	return dels, nil
+}
+
+// UpdateAdd extends the proof after an Add by replaying the merges and
+// collecting the other side of each merge the proven leaf's tree takes
+// part in.
+func (p *Proof) UpdateAdd(merger gommr.Merger, add *Addition) {
+	numLeaves := add.NumLeaves
+	roots := append([]gommr.Hash{}, add.Roots...)
+	// the tree holding the proven leaf is the stack entry it started in
+	tracked, _, _, _ := treeOf(numLeaves, p.Index)
+	for _, l := range add.Leaves {
+		node, start := l, numLeaves
+		nodeTracked := false
+		for h := 0; numLeaves&(1<<uint(h)) != 0; h++ {
+			root := roots[len(roots)-1]
+			rootTracked := tracked == len(roots)-1
+			roots = roots[:len(roots)-1]
+			if rootTracked {
+				p.Siblings = append(p.Siblings, node)
+			} else if nodeTracked {
+				p.Siblings = append(p.Siblings, root)
+			}
+			start -= uint64(1) << uint(h)
+			node = combine(merger, nodePos(start, h+1), root, node)
+			nodeTracked = nodeTracked || rootTracked
+		}
+		roots = append(roots, node)
+		if nodeTracked {
+			tracked = len(roots) - 1
+		}
+		numLeaves++
+	}
+}
+
+// UpdateDelete refreshes the proof after another leaf of a forest with
+// numLeaves leaves was deleted. The two paths meet at one level, where the
+// sibling of this proof is an ancestor of the deleted leaf.
+func (p *Proof) UpdateDelete(numLeaves uint64, d Deletion) {
+	treeP, _, _, okP := treeOf(numLeaves, p.Index)
+	treeD, _, _, okD := treeOf(numLeaves, d.Index)
+	if !okP || !okD || treeP != treeD || p.Index == d.Index {
+		return
+	}
+	level := bits.Len64(p.Index^d.Index) - 1
+	if level < len(p.Siblings) && level < len(d.Path) {
+		p.Siblings[level] = d.Path[level]
+	}
+}
@@ -0,0 +1,233 @@
+package utreexo
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/go-mmr/gommr"
+)
+
+func leafHash(i int) gommr.Hash {
+	return gommr.RlpHash(uint64(i))
+}
+
+func leaves(from, to int) []gommr.Hash {
+	var hs []gommr.Hash
+	for i := from; i < to; i++ {
+		hs = append(hs, leafHash(i))
+	}
+	return hs
+}
+
+func sameRoots(a, b *Accumulator) bool {
+	if a.NumLeaves != b.NumLeaves || len(a.Roots) != len(b.Roots) {
+		return false
+	}
+	for i := range a.Roots {
+		if a.Roots[i] != b.Roots[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAddMatchesMMR(t *testing.T) {
+	acc := New()
+	m, err := gommr.NewMMR(gommr.NewMemStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 40; i++ {
+		if _, err := acc.Add([]gommr.Hash{leafHash(i)}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.Push(leafHash(i)); err != nil {
+			t.Fatal(err)
+		}
+		// without deletions the roots are the mmr peaks
+		peaks := gommr.Peaks(m.Size())
+		if len(peaks) != len(acc.Roots) {
+			t.Fatalf("%d leaves: %d roots, want %d", i+1, len(acc.Roots), len(peaks))
+		}
+		for j, pos := range peaks {
+			h, _ := m.Get(pos)
+			if h != acc.Roots[j] {
+				t.Fatalf("%d leaves: root %d differs from peak at %d", i+1, j, pos)
+			}
+		}
+	}
+	if _, err := acc.Add([]gommr.Hash{{}}); err != ErrEmptyLeaf {
+		t.Fatalf("empty leaf added: %v", err)
+	}
+}
+
+func TestZeroAccumulator(t *testing.T) {
+	var acc Accumulator
+	want := New()
+	acc.Add(leaves(0, 5))
+	want.Add(leaves(0, 5))
+	if !sameRoots(&acc, want) {
+		t.Fatal("zero accumulator differs from New")
+	}
+	p := &Proof{Index: 4, Leaf: leafHash(4)}
+	if !acc.Verify(p) {
+		t.Fatal("proof of the last leaf failed")
+	}
+	if _, err := acc.Delete([]*Proof{p}); err != nil || acc.Roots[1] != empty {
+		t.Fatalf("delete: %v", err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	f := NewForest()
+	f.Add(leaves(0, 13))
+	acc := f.Accumulator()
+	for i := uint64(0); i < 13; i++ {
+		p, err := f.Prove(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !acc.Verify(p) {
+			t.Fatalf("proof of leaf %d does not verify", i)
+		}
+	}
+	var proofs []*Proof
+	for _, i := range []uint64{4, 5, 1, 12} {
+		p, _ := f.Prove(i)
+		proofs = append(proofs, p)
+	}
+	dels, err := acc.Delete(proofs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fdels, err := f.Delete([]uint64{4, 5, 1, 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameRoots(acc, f.Accumulator()) {
+		t.Fatal("accumulator and forest disagree after delete")
+	}
+	for i := range dels {
+		for j := range dels[i].Path {
+			if dels[i].Path[j] != fdels[i].Path[j] {
+				t.Fatalf("deletion %d differs at level %d", i, j)
+			}
+		}
+	}
+	// the tree of leaf 12 is gone, so is the subtree of 4 and 5
+	if acc.Roots[2] != (gommr.Hash{}) {
+		t.Fatal("root of a fully deleted tree is not empty")
+	}
+	for _, p := range proofs {
+		if acc.Verify(p) {
+			t.Fatalf("deleted leaf %d still verifies", p.Index)
+		}
+	}
+	if _, err := acc.Delete(proofs[:1]); err != ErrBadProof {
+		t.Fatalf("stale proof deleted: %v", err)
+	}
+	if _, err := f.Prove(4); err != ErrDuplicated {
+		t.Fatalf("deleted leaf proven: %v", err)
+	}
+	if _, err := f.Delete([]uint64{0, 0}); err != ErrDuplicated {
+		t.Fatalf("leaf deleted twice: %v", err)
+	}
+	if _, err := f.Prove(13); err != ErrLeafIndex {
+		t.Fatalf("missing leaf proven: %v", err)
+	}
+	for i := uint64(0); i < 13; i++ {
+		p, err := f.Prove(i)
+		if err == ErrDuplicated {
+			continue
+		}
+		if err != nil || !acc.Verify(p) {
+			t.Fatalf("proof of leaf %d does not verify after delete", i)
+		}
+		if i == 6 && p.Siblings[1] != (gommr.Hash{}) {
+			t.Fatal("sibling of leaves 6 and 7 is not empty")
+		}
+	}
+}
+
+func TestForgedProof(t *testing.T) {
+	f := NewForest()
+	f.Add(leaves(0, 4))
+	acc := f.Accumulator()
+	// the parent of leaves 0 and 1 posing as leaf 0 with a deleted sibling
+	forged := &Proof{Index: 0, Leaf: f.nodes[2], Siblings: []gommr.Hash{{}, f.nodes[5]}}
+	if acc.Verify(forged) {
+		t.Fatal("inner node verifies as a leaf")
+	}
+	if _, err := acc.Delete([]*Proof{forged}); err != ErrBadProof {
+		t.Fatalf("forged proof deleted: %v", err)
+	}
+	if !sameRoots(acc, f.Accumulator()) {
+		t.Fatal("forged proof changed the roots")
+	}
+	if p, _ := f.Prove(1); !acc.Verify(p) {
+		t.Fatal("leaf 1 lost to a forged proof")
+	}
+}
+
+func TestProofUpdates(t *testing.T) {
+	rnd := rand.New(rand.NewSource(7))
+	f := NewForest()
+	acc := New()
+	held := map[uint64]*Proof{}
+	next := 0
+	for round := 0; round < 60; round++ {
+		n := 1 + rnd.Intn(5)
+		add, err := acc.Add(leaves(next, next+n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Add(leaves(next, next+n))
+		for _, p := range held {
+			p.UpdateAdd(gommr.DefaultMerger, add)
+		}
+		for i := next; i < next+n; i++ {
+			if rnd.Intn(2) == 0 {
+				p, _ := f.Prove(uint64(i))
+				held[uint64(i)] = p
+			}
+		}
+		next += n
+
+		var del []*Proof
+		var indices []uint64
+		for i, p := range held {
+			if rnd.Intn(4) == 0 {
+				del = append(del, p)
+				indices = append(indices, i)
+			}
+		}
+		numLeaves := acc.NumLeaves
+		dels, err := acc.Delete(del)
+		if err != nil {
+			t.Fatalf("round %d: %v", round, err)
+		}
+		if _, err := f.Delete(indices); err != nil {
+			t.Fatal(err)
+		}
+		for _, i := range indices {
+			delete(held, i)
+		}
+		for _, p := range held {
+			for _, d := range dels {
+				p.UpdateDelete(numLeaves, d)
+			}
+		}
+		if !sameRoots(acc, f.Accumulator()) {
+			t.Fatalf("round %d: accumulator and forest disagree", round)
+		}
+		for i, p := range held {
+			if !acc.Verify(p) {
+				t.Fatalf("round %d: updated proof of leaf %d does not verify", round, i)
+			}
+			fresh, _ := f.Prove(i)
+			if len(fresh.Siblings) != len(p.Siblings) {
+				t.Fatalf("round %d: updated proof of leaf %d has %d siblings, want %d", round, i, len(p.Siblings), len(fresh.Siblings))
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package gommr
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+// The write-ahead log of a FileStore holds the last append as a single
+// record at offset 0:
+//
+//	pos     uint64, big endian
+//	count   uint32, big endian
+//	hashes  count*32 bytes
+//	crc     uint32, CRC-32C of all of the above
+//
+// An append writes the record before the hashes, so a crash either leaves
+// a torn record, with the store untouched, or a whole one, which is
+// written again on open. Truncate clears the log first, so a rewound
+// append is never replayed.
+//
+// The record only covers the last append, so with SyncWAL an append first
+// syncs the hashes of the one before it, whose record it is about to
+// overwrite, and then syncs its own record. Without SyncWAL nothing is
+// synced: the log still completes or drops an append cut short by a crash
+// of the process, but a power loss may lose or garble anything written
+// since the last Sync.
+
+const walHeader = 12
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+func walRecord(pos uint64, hashes []Hash) []byte {
+	b := make([]byte, walHeader, walHeader+32*len(hashes)+4)
+	binary.BigEndian.PutUint64(b, pos)
+	binary.BigEndian.PutUint32(b[8:], uint32(len(hashes)))
+	for _, h := range hashes {
+		b = append(b, h[:]...)
+	}
+	return binary.BigEndian.AppendUint32(b, crc32.Checksum(b, crcTable))
+}
+
+// parseWALRecord returns the append of a log, ok is false if the record is
+// missing or torn.
+func parseWALRecord(b []byte) (pos uint64, hashes []Hash, ok bool) {
+	if len(b) < walHeader+4 {
+		return 0, nil, false
+	}
+	count := uint64(binary.BigEndian.Uint32(b[8:]))
+	end := walHeader + 32*count
+	if uint64(len(b)) < end+4 || binary.BigEndian.Uint32(b[end:]) != crc32.Checksum(b[:end], crcTable) {
+		return 0, nil, false
+	}
+	for i := uint64(0); i < count; i++ {
+		hashes = append(hashes, BytesToHash(b[walHeader+32*i:walHeader+32*i+32]))
+	}
+	return binary.BigEndian.Uint64(b), hashes, true
+}
+
+func (s *FileStore) journal(pos uint64, hashes []Hash) error {
+	if s.SyncWAL && s.dirty {
+		if err := s.file.Sync(); err != nil {
+			return err
+		}
+		s.dirty = false
+	}
+	if _, err := s.wal.WriteAt(walRecord(pos, hashes), 0); err != nil {
+		return err
+	}
+	if s.SyncWAL {
+		return s.wal.Sync()
+	}
+	return nil
+}
+
+func (s *FileStore) write(pos uint64, hashes []Hash) error {
+	buf := make([]byte, 0, len(hashes)*32)
+	for _, h := range hashes {
+		buf = append(buf, h[:]...)
+	}
+	s.dirty = true
+	_, err := s.file.WriteAt(buf, int64(pos*32))
+	return err
+}
+
+// recover sets the size of a store being opened. A whole journaled append
+// that reaches the end of the file is written again, a torn or stale one is
+// dropped. What is left is cut to the largest valid mmr size, which also
+// drops the partial hash or the missing parents of a store written
+// without a journal.
+func (s *FileStore) recover() error {
+	info, err := s.file.Stat()
+	if err != nil {
+		return err
+	}
+	size := uint64(info.Size()) / 32
+	rec, err := io.ReadAll(io.NewSectionReader(s.wal, 0, 1<<62))
+	if err != nil {
+		return err
+	}
+	if pos, hashes, ok := parseWALRecord(rec); ok && pos <= size && size <= pos+uint64(len(hashes)) {
+		if err := s.write(pos, hashes); err != nil {
+			return err
+		}
+		if err := s.file.Sync(); err != nil {
+			return err
+		}
+		size = pos + uint64(len(hashes))
+	}
+	size = validSizeBelow(size)
+	if uint64(info.Size()) != size*32 {
+		if err := s.file.Truncate(int64(size * 32)); err != nil {
+			return err
+		}
+	}
+	if err := s.wal.Truncate(0); err != nil {
+		return err
+	}
+	s.size = size
+	return nil
+}
+
+// validSizeBelow returns the largest valid mmr size not above size.
+func validSizeBelow(size uint64) uint64 {
+	count := (size + 64) / 2
+	for count > 0 && LeafCountToSize(count) > size {
+		count--
+	}
+	return LeafCountToSize(count)
+}
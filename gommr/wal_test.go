@@ -0,0 +1,116 @@
+package gommr
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWALRecovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nodes")
+	open := func() (*FileStore, *MMR) {
+		t.Helper()
+		store, err := OpenFileStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := NewMMR(store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store, m
+	}
+	store, m := open()
+	m = buildMMR(t, store, 15)
+	before, _ := m.Root()
+	after, _ := buildMMR(t, NewMemStore(), 16).Root()
+	store.Close()
+
+	// the 16th leaf creates four parents, i.e. 5 hashes from position 26
+	ref := buildMMR(t, NewMemStore(), 16)
+	var hashes []Hash
+	for pos := uint64(26); pos < 31; pos++ {
+		h, _ := ref.Get(pos)
+		hashes = append(hashes, h)
+	}
+	rec := walRecord(26, hashes)
+	crash := func(wal []byte, written int) {
+		t.Helper()
+		if err := os.WriteFile(path+".wal", wal, 0644); err != nil {
+			t.Fatal(err)
+		}
+		f, _ := os.OpenFile(path, os.O_RDWR, 0644)
+		f.Truncate(26 * 32)
+		for i := 0; i < written; i++ {
+			f.WriteAt(hashes[i][:], int64(26+i)*32)
+		}
+		if written == 0 {
+			// a torn hash
+			f.WriteAt([]byte{1, 2, 3}, 26*32)
+		}
+		f.Close()
+	}
+	for _, tc := range []struct {
+		name    string
+		wal     []byte
+		written int
+		want    Hash
+	}{
+		{"journaled, nothing written", rec, 0, after},
+		{"journaled, leaf written", rec, 1, after},
+		{"journaled, some parents written", rec, 3, after},
+		{"journaled, all written", rec, 5, after},
+		{"torn journal", rec[:len(rec)-7], 0, before},
+		{"corrupt journal", append(append([]byte{}, rec[:20]...), append([]byte{0xff}, rec[21:]...)...), 0, before},
+		{"no journal, leaf written", nil, 1, before},
+		{"no journal, some parents written", nil, 4, before},
+	} {
+		crash(tc.wal, tc.written)
+		store, m := open()
+		if r, err := m.Check(); err != nil || !r.OK() {
+			t.Fatalf("%s: check %+v %v", tc.name, r, err)
+		}
+		if got, _ := m.Root(); got != tc.want {
+			t.Fatalf("%s: root at %d leaves is not a committed one", tc.name, m.LeafCount())
+		}
+		if info, _ := os.Stat(path + ".wal"); info.Size() != 0 {
+			t.Fatalf("%s: journal kept after recovery", tc.name)
+		}
+		store.Close()
+	}
+
+	// a rewound append is not replayed
+	store, m = open()
+	buildMMR(t, store, 16)
+	m.Rewind(LeafCountToSize(15))
+	store.Close()
+	store, m = open()
+	defer store.Close()
+	if got, _ := m.Root(); got != before || m.LeafCount() != 15 {
+		t.Fatalf("rewound leaf came back, %d leaves", m.LeafCount())
+	}
+}
+
+func TestSyncWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nodes")
+	store, _ := OpenFileStore(path)
+	store.SyncWAL = true
+	m := buildMMR(t, store, 20)
+	want, _ := m.Root()
+	// the hashes of the last append wait for the next append or Sync
+	if !store.dirty {
+		t.Fatal("last append marked as synced")
+	}
+	m.Push(leafHash(20))
+	m.Rewind(LeafCountToSize(20))
+	if err := store.Sync(); err != nil || store.dirty {
+		t.Fatalf("sync: %v", err)
+	}
+	store.Close()
+	store, _ = OpenFileStore(path)
+	defer store.Close()
+	m, _ = NewMMR(store)
+	if got, _ := m.Root(); got != want {
+		t.Fatalf("root after reopen %x, want %x", got, want)
+	}
+}
@@ -0,0 +1,191 @@
+package witness
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-mmr/gommr"
+	"github.com/go-mmr/gommr/checkpoint"
+)
+
+// ErrBadResponse is returned by the clients when a server answers with an
+// error status or a malformed body.
+var ErrBadResponse = errors.New("witness: bad response")
+
+// maxBody bounds the request and response bodies.
+const maxBody = 1 << 20
+
+// Handler serves a witness:
+//
+//	POST /cosign          body: signed checkpoint, reply: cosigned checkpoint
+//	GET  /latest?origin=  reply: latest cosigned checkpoint of the log
+//
+// Checkpoints of unknown logs get 404, stale or inconsistent ones 409.
+func Handler(w *Witness) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cosign", func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		msg, err := io.ReadAll(io.LimitReader(r.Body, maxBody))
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		cosigned, err := w.Cosign(msg)
+		if err != nil {
+			http.Error(rw, err.Error(), cosignStatus(err))
+			return
+		}
+		rw.Write(cosigned)
+	})
+	mux.HandleFunc("/latest", func(rw http.ResponseWriter, r *http.Request) {
+		msg := w.Latest(r.URL.Query().Get("origin"))
+		if msg == nil {
+			http.NotFound(rw, r)
+			return
+		}
+		rw.Write(msg)
+	})
+	return mux
+}
+
+func cosignStatus(err error) int {
+	switch err {
+	case ErrUnknownLog:
+		return http.StatusNotFound
+	case ErrStale, ErrInconsistent:
+		return http.StatusConflict
+	case checkpoint.ErrBadSignature, checkpoint.ErrUnverified, checkpoint.ErrOrigin:
+		return http.StatusForbidden
+	case checkpoint.ErrCheckpoint, checkpoint.ErrNote:
+		return http.StatusBadRequest
+	}
+	return http.StatusBadGateway
+}
+
+// ProofHandler serves the consistency proofs of a log:
+//
+//	GET /consistency?old=&new=
+//
+// The reply holds the sizes and the base64 old peaks and items, one per
+// line.
+func ProofHandler(m *gommr.MMR) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/consistency", func(rw http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		oldSize, err1 := strconv.ParseUint(q.Get("old"), 10, 64)
+		newSize, err2 := strconv.ParseUint(q.Get("new"), 10, 64)
+		if err1 != nil || err2 != nil {
+			http.Error(rw, "bad size", http.StatusBadRequest)
+			return
+		}
+		proof, err := m.GenConsistencyProof(oldSize, newSize)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rw.Write(marshalProof(proof))
+	})
+	return mux
+}
+
+func marshalProof(p *gommr.ConsistencyProof) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%d\n%d\n", p.OldSize, p.NewSize)
+	for _, h := range append(append([]gommr.Hash{}, p.OldPeaks...), p.Items...) {
+		b.WriteString(base64.StdEncoding.EncodeToString(h[:]) + "\n")
+	}
+	return b.Bytes()
+}
+
+func unmarshalProof(b []byte) (*gommr.ConsistencyProof, error) {
+	lines := strings.Split(string(b), "\n")
+	if len(lines) < 3 || lines[len(lines)-1] != "" {
+		return nil, ErrBadResponse
+	}
+	lines = lines[:len(lines)-1]
+	oldSize, err1 := strconv.ParseUint(lines[0], 10, 64)
+	newSize, err2 := strconv.ParseUint(lines[1], 10, 64)
+	if err1 != nil || err2 != nil || oldSize != 0 && !gommr.ValidSize(oldSize) {
+		return nil, ErrBadResponse
+	}
+	p := &gommr.ConsistencyProof{OldSize: oldSize, NewSize: newSize}
+	var hashes []gommr.Hash
+	for _, line := range lines[2:] {
+		h, err := base64.StdEncoding.DecodeString(line)
+		if err != nil || len(h) != len(gommr.Hash{}) {
+			return nil, ErrBadResponse
+		}
+		hashes = append(hashes, gommr.BytesToHash(h))
+	}
+	peaks := 0
+	if oldSize != 0 {
+		peaks = len(gommr.Peaks(oldSize))
+	}
+	if len(hashes) < peaks {
+		return nil, ErrBadResponse
+	}
+	p.OldPeaks, p.Items = hashes[:peaks], hashes[peaks:]
+	return p, nil
+}
+
+// Client fetches consistency proofs from a ProofHandler at URL.
+type Client struct {
+	URL    string
+	Client *http.Client
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.Client != nil {
+		return c.Client
+	}
+	return http.DefaultClient
+}
+
+// ConsistencyProof implements Log.
+func (c *Client) ConsistencyProof(oldSize, newSize uint64) (*gommr.ConsistencyProof, error) {
+	q := url.Values{"old": {strconv.FormatUint(oldSize, 10)}, "new": {strconv.FormatUint(newSize, 10)}}
+	resp, err := c.httpClient().Get(c.URL + "/consistency?" + q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	body, err := readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalProof(body)
+}
+
+// Submit sends a signed checkpoint to the witness at addr and returns the
+// cosigned checkpoint.
+func Submit(client *http.Client, addr string, msg []byte) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Post(addr+"/cosign", "text/plain; charset=utf-8", bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+	return readBody(resp)
+}
+
+func readBody(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, ErrBadResponse
+	}
+	return body, nil
+}
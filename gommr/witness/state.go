@@ -0,0 +1,98 @@
+package witness
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// State keeps the latest checkpoint cosigned for every log, so that a
+// restarted witness still refuses to cosign a fork of what it cosigned.
+type State interface {
+	// Load returns the latest checkpoint cosigned for origin, or nil.
+	Load(origin string) ([]byte, error)
+	// Store records msg as the latest checkpoint cosigned for origin. It
+	// must be durable when Store returns.
+	Store(origin string, msg []byte) error
+}
+
+// MemState keeps the state in memory, for tests and witnesses that are
+// never restarted.
+type MemState struct {
+	lock sync.Mutex
+	msgs map[string][]byte
+}
+
+func NewMemState() *MemState {
+	return &MemState{msgs: make(map[string][]byte)}
+}
+
+func (s *MemState) Load(origin string) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.msgs[origin], nil
+}
+
+func (s *MemState) Store(origin string, msg []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.msgs[origin] = msg
+	return nil
+}
+
+// DirState keeps the checkpoint of each log in a file of a directory,
+// named by the hex of the origin.
+type DirState struct {
+	dir string
+}
+
+// OpenDirState opens the state in dir, creating it if needed.
+func OpenDirState(dir string) (*DirState, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DirState{dir: dir}, nil
+}
+
+func (s *DirState) path(origin string) string {
+	return filepath.Join(s.dir, hex.EncodeToString([]byte(origin)))
+}
+
+func (s *DirState) Load(origin string) ([]byte, error) {
+	msg, err := os.ReadFile(s.path(origin))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return msg, err
+}
+
+// Store writes msg to a temporary file, syncs it and renames it over the
+// old one, then syncs the directory.
+func (s *DirState) Store(origin string, msg []byte) error {
+	tmp := s.path(origin) + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(msg); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path(origin)); err != nil {
+		return err
+	}
+	d, err := os.Open(s.dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,178 @@
+// Package witness cosigns mmr checkpoints. A witness keeps the latest
+// checkpoint it cosigned for every log it follows in its State and cosigns
+// a newer one only if the log proves it to be an extension of the old one,
+// so a log cannot show different histories to clients that check for
+// cosignatures.
+package witness
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+
+	"github.com/go-mmr/gommr"
+	"github.com/go-mmr/gommr/checkpoint"
+)
+
+var (
+	ErrUnknownLog   = errors.New("witness: unknown log")
+	ErrStale        = errors.New("witness: checkpoint is older than the latest cosigned one")
+	ErrInconsistent = errors.New("witness: checkpoint is not consistent with the latest cosigned one")
+)
+
+// Log is the source of consistency proofs of a log.
+type Log interface {
+	ConsistencyProof(oldSize, newSize uint64) (*gommr.ConsistencyProof, error)
+}
+
+type logState struct {
+	// lock guards latest and cosigned, it is not held while fetching a
+	// proof
+	lock     sync.Mutex
+	verifier *checkpoint.Verifier
+	merger   gommr.Merger
+	source   Log
+	latest   *checkpoint.Checkpoint
+	cosigned []byte
+}
+
+// Witness cosigns checkpoints of the logs added to it.
+type Witness struct {
+	signer *checkpoint.Signer
+	state  State
+	lock   sync.RWMutex
+	logs   map[string]*logState
+}
+
+// New returns a witness cosigning with signer, which records what it
+// cosigned in state.
+func New(signer *checkpoint.Signer, state State) *Witness {
+	return &Witness{signer: signer, state: state, logs: make(map[string]*logState)}
+}
+
+// Verifier returns the verifier of the witness key.
+func (w *Witness) Verifier() *checkpoint.Verifier {
+	return w.signer.Verifier()
+}
+
+// AddLog follows the log signing with the key of verifier, whose name is
+// the origin. The mmr of the log merges with merger and source serves its
+// consistency proofs. The latest checkpoint cosigned for the log is loaded
+// from the state.
+func (w *Witness) AddLog(verifier *checkpoint.Verifier, merger gommr.Merger, source Log) error {
+	l := &logState{verifier: verifier, merger: merger, source: source}
+	msg, err := w.state.Load(verifier.Name())
+	if err != nil {
+		return err
+	}
+	if msg != nil {
+		c, _, err := checkpoint.Verify(msg, verifier)
+		if err != nil {
+			return err
+		}
+		l.latest, l.cosigned = c, msg
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.logs[verifier.Name()] = l
+	return nil
+}
+
+func (w *Witness) log(origin string) *logState {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return w.logs[origin]
+}
+
+// Latest returns the latest checkpoint cosigned for origin, or nil.
+func (w *Witness) Latest(origin string) []byte {
+	l := w.log(origin)
+	if l == nil {
+		return nil
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.cosigned
+}
+
+// Cosign checks a signed checkpoint against the latest one cosigned for
+// its log and returns it with the witness signature added. The first
+// checkpoint of a log is taken as it is.
+func (w *Witness) Cosign(msg []byte) ([]byte, error) {
+	head, err := checkpoint.ParseCheckpoint(noteText(msg))
+	if err != nil {
+		return nil, err
+	}
+	l := w.log(head.Origin)
+	if l == nil {
+		return nil, ErrUnknownLog
+	}
+	c, _, err := checkpoint.Verify(msg, l.verifier)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		l.lock.Lock()
+		prev := l.latest
+		l.lock.Unlock()
+		if err := l.check(prev, c); err != nil {
+			return nil, err
+		}
+		cosigned, ok, err := w.commit(l, prev, c, msg)
+		if ok || err != nil {
+			return cosigned, err
+		}
+		// another checkpoint was cosigned meanwhile, check against it
+	}
+}
+
+// check proves c to extend prev, which may be nil.
+func (l *logState) check(prev, c *checkpoint.Checkpoint) error {
+	switch {
+	case prev == nil:
+	case c.Size < prev.Size:
+		return ErrStale
+	case c.Size == prev.Size:
+		if c.Root != prev.Root {
+			return ErrInconsistent
+		}
+	default:
+		proof, err := l.source.ConsistencyProof(prev.Size, c.Size)
+		if err != nil {
+			return err
+		}
+		if proof.OldSize != prev.Size || proof.NewSize != c.Size || !proof.Verify(l.merger, prev.Root, c.Root) {
+			return ErrInconsistent
+		}
+	}
+	return nil
+}
+
+// commit cosigns msg and records it as the latest checkpoint of the log,
+// unless the latest one is no longer prev.
+func (w *Witness) commit(l *logState, prev, c *checkpoint.Checkpoint, msg []byte) ([]byte, bool, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.latest != prev {
+		return nil, false, nil
+	}
+	cosigned, err := checkpoint.Cosign(msg, w.signer)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := w.state.Store(c.Origin, cosigned); err != nil {
+		return nil, false, err
+	}
+	l.latest, l.cosigned = c, cosigned
+	return cosigned, true, nil
+}
+
+// noteText returns the text of a signed note, it only serves to find the
+// log before the note is opened with the log key.
+func noteText(msg []byte) string {
+	i := bytes.Index(msg, []byte("\n\n"))
+	if i < 0 {
+		return ""
+	}
+	return string(msg[:i+1])
+}
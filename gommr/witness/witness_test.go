@@ -0,0 +1,244 @@
+package witness
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-mmr/gommr"
+	"github.com/go-mmr/gommr/checkpoint"
+)
+
+const origin = "example.com/log"
+
+type testLog struct {
+	m      *gommr.MMR
+	signer *checkpoint.Signer
+}
+
+func (l *testLog) push(t *testing.T, from, to int) {
+	for i := from; i < to; i++ {
+		if _, err := l.m.Push(gommr.RlpHash(uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func (l *testLog) ConsistencyProof(oldSize, newSize uint64) (*gommr.ConsistencyProof, error) {
+	return l.m.GenConsistencyProof(oldSize, newSize)
+}
+
+func (l *testLog) checkpoint(t *testing.T) []byte {
+	c, err := checkpoint.New(l.signer.Name(), l.m, time.Unix(1700000000, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := c.Sign(l.signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func newSigner(t *testing.T, name string) *checkpoint.Signer {
+	skey, _, err := checkpoint.GenerateKey(rand.Reader, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := checkpoint.NewSigner(skey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestWitnesses(t *testing.T) {
+	logSigner := newSigner(t, origin)
+	m, _ := gommr.NewMMR(gommr.NewMemStore())
+	log := &testLog{m: m, signer: logSigner}
+	logSrv := httptest.NewServer(ProofHandler(m))
+	defer logSrv.Close()
+
+	var (
+		witnesses []*Witness
+		urls      []string
+	)
+	for i := 0; i < 3; i++ {
+		w := New(newSigner(t, fmt.Sprintf("witness%d", i)), NewMemState())
+		if err := w.AddLog(logSigner.Verifier(), gommr.DefaultMerger, &Client{URL: logSrv.URL}); err != nil {
+			t.Fatal(err)
+		}
+		srv := httptest.NewServer(Handler(w))
+		defer srv.Close()
+		witnesses = append(witnesses, w)
+		urls = append(urls, srv.URL)
+	}
+	verifiers := []*checkpoint.Verifier{logSigner.Verifier()}
+	for _, w := range witnesses {
+		verifiers = append(verifiers, w.Verifier())
+	}
+
+	leaves := 0
+	for _, n := range []int{1, 1, 4, 11, 16, 0, 33} {
+		log.push(t, leaves, leaves+n)
+		leaves += n
+		msg := log.checkpoint(t)
+		for i, u := range urls {
+			cosigned, err := Submit(nil, u, msg)
+			if err != nil {
+				t.Fatalf("%d leaves: witness %d: %v", leaves, i, err)
+			}
+			note, err := checkpoint.Open(cosigned, verifiers...)
+			if err != nil || len(note.Verified) != 2 || note.Verified[1].Name != fmt.Sprintf("witness%d", i) {
+				t.Fatalf("%d leaves: cosigned by witness %d: %v", leaves, i, err)
+			}
+		}
+	}
+	resp, err := http.Get(urls[0] + "/latest?origin=" + origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest, err := readBody(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, _, err := checkpoint.Verify(latest, logSigner.Verifier()); err != nil || c.Size != m.Size() {
+		t.Fatalf("latest checkpoint: %v", err)
+	}
+
+	// the log shows a second history with a rewritten leaf, while its
+	// proof server follows the first
+	size := m.Size()
+	log.push(t, leaves, leaves+10)
+	forked, _ := gommr.NewMMR(gommr.NewMemStore())
+	fork := &testLog{m: forked, signer: logSigner}
+	fork.push(t, 0, 20)
+	forked.Push(gommr.Hash{1})
+	fork.push(t, 21, leaves+5)
+	forkMsg := fork.checkpoint(t)
+	if _, err := Submit(nil, urls[0], forkMsg); err != ErrBadResponse {
+		t.Fatalf("forked checkpoint cosigned: %v", err)
+	}
+	if _, err := witnesses[0].Cosign(forkMsg); err != ErrInconsistent {
+		t.Fatalf("forked checkpoint: %v", err)
+	}
+	// even when the fork serves its own proofs
+	forkSrv := httptest.NewServer(ProofHandler(forked))
+	defer forkSrv.Close()
+	witnesses[1].AddLog(logSigner.Verifier(), gommr.DefaultMerger, &Client{URL: forkSrv.URL})
+	witnesses[1].Cosign(latest)
+	if _, err := witnesses[1].Cosign(forkMsg); err != ErrInconsistent {
+		t.Fatalf("forked checkpoint with its own proofs: %v", err)
+	}
+
+	// a fork of the same size only differs in the root
+	forked.Rewind(size)
+	if _, err := witnesses[2].Cosign(fork.checkpoint(t)); err != ErrInconsistent {
+		t.Fatalf("same size fork: %v", err)
+	}
+	if _, err := witnesses[2].Cosign(log.checkpoint(t)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := witnesses[2].Cosign(latest); err != ErrStale {
+		t.Fatalf("stale checkpoint: %v", err)
+	}
+	other := &testLog{m: m, signer: newSigner(t, "example.com/other")}
+	if _, err := witnesses[2].Cosign(other.checkpoint(t)); err != ErrUnknownLog {
+		t.Fatalf("checkpoint of an unknown log: %v", err)
+	}
+	impostor := &testLog{m: m, signer: newSigner(t, origin)}
+	if _, err := witnesses[2].Cosign(impostor.checkpoint(t)); err != checkpoint.ErrUnverified {
+		t.Fatalf("checkpoint signed by another key: %v", err)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	logSigner := newSigner(t, origin)
+	m, _ := gommr.NewMMR(gommr.NewMemStore())
+	log := &testLog{m: m, signer: logSigner}
+	log.push(t, 0, 20)
+	msg := log.checkpoint(t)
+	dir := t.TempDir()
+	signer := newSigner(t, "witness")
+	open := func() *Witness {
+		state, err := OpenDirState(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := New(signer, state)
+		if err := w.AddLog(logSigner.Verifier(), gommr.DefaultMerger, log); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+	w := open()
+	if _, err := w.Cosign(msg); err != nil {
+		t.Fatal(err)
+	}
+	cosigned := w.Latest(origin)
+
+	// a fork of the same size is refused after a restart
+	w = open()
+	if got := w.Latest(origin); string(got) != string(cosigned) {
+		t.Fatalf("latest after restart %q", got)
+	}
+	forked, _ := gommr.NewMMR(gommr.NewMemStore())
+	fork := &testLog{m: forked, signer: logSigner}
+	fork.push(t, 1, 21)
+	if _, err := w.Cosign(fork.checkpoint(t)); err != ErrInconsistent {
+		t.Fatalf("fork after restart: %v", err)
+	}
+	log.push(t, 20, 30)
+	if _, err := w.Cosign(log.checkpoint(t)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := open().Cosign(msg); err != ErrStale {
+		t.Fatalf("stale checkpoint after restart: %v", err)
+	}
+}
+
+// blockingLog serves proofs of m once release is closed.
+type blockingLog struct {
+	m       *gommr.MMR
+	asked   chan struct{}
+	release chan struct{}
+}
+
+func (l *blockingLog) ConsistencyProof(oldSize, newSize uint64) (*gommr.ConsistencyProof, error) {
+	close(l.asked)
+	<-l.release
+	return l.m.GenConsistencyProof(oldSize, newSize)
+}
+
+func TestCosignUnlocked(t *testing.T) {
+	logSigner := newSigner(t, origin)
+	m, _ := gommr.NewMMR(gommr.NewMemStore())
+	log := &testLog{m: m, signer: logSigner}
+	source := &blockingLog{m: m, asked: make(chan struct{}), release: make(chan struct{})}
+	w := New(newSigner(t, "witness"), NewMemState())
+	w.AddLog(logSigner.Verifier(), gommr.DefaultMerger, source)
+	log.push(t, 0, 5)
+	first := log.checkpoint(t)
+	if _, err := w.Cosign(first); err != nil {
+		t.Fatal(err)
+	}
+	log.push(t, 5, 9)
+	second := log.checkpoint(t)
+	done := make(chan error)
+	go func() {
+		_, err := w.Cosign(second)
+		done <- err
+	}()
+	<-source.asked
+	// the log is not locked while its proof is fetched
+	if got := w.Latest(origin); string(got) == "" {
+		t.Fatal("no latest checkpoint")
+	}
+	close(source.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,183 @@
+// Package zip221 builds the Zcash history tree of ZIP-221 (FlyClient) on
+// the gommr position layout. Its nodes carry node data: a subtree
+// commitment, the time, target, note commitment tree root and height
+// ranges of the subtree, its total work and transaction counts. Node data
+// is hashed with BLAKE2b-256 personalized by the consensus branch id.
+package zip221
+
+import (
+	"encoding/binary"
+	"math/big"
+
+	"github.com/go-mmr/gommr"
+)
+
+// Node data versions. V2 adds the Orchard fields, it is used from NU5 on.
+const (
+	V1 = 1
+	V2 = 2
+)
+
+// NodeData is the data of a history tree node.
+type NodeData struct {
+	Version           int
+	ConsensusBranchID uint32
+
+	SubtreeCommitment gommr.Hash
+	StartTime         uint32
+	EndTime           uint32
+	StartTarget       uint32
+	EndTarget         uint32
+	StartSaplingRoot  gommr.Hash
+	EndSaplingRoot    gommr.Hash
+	SubtreeTotalWork  *big.Int
+	StartHeight       uint64
+	EndHeight         uint64
+	SaplingTxCount    uint64
+
+	// V2 only
+	StartOrchardRoot gommr.Hash
+	EndOrchardRoot   gommr.Hash
+	OrchardTxCount   uint64
+}
+
+func appendCompactSize(b []byte, v uint64) []byte {
+	switch {
+	case v < 0xfd:
+		return append(b, byte(v))
+	case v <= 0xffff:
+		return binary.LittleEndian.AppendUint16(append(b, 0xfd), uint16(v))
+	case v <= 0xffffffff:
+		return binary.LittleEndian.AppendUint32(append(b, 0xfe), uint32(v))
+	}
+	return binary.LittleEndian.AppendUint64(append(b, 0xff), v)
+}
+
+// Serialize returns the consensus serialization of the node data.
+func (n *NodeData) Serialize() []byte {
+	b := make([]byte, 0, 244)
+	b = append(b, n.SubtreeCommitment[:]...)
+	b = binary.LittleEndian.AppendUint32(b, n.StartTime)
+	b = binary.LittleEndian.AppendUint32(b, n.EndTime)
+	b = binary.LittleEndian.AppendUint32(b, n.StartTarget)
+	b = binary.LittleEndian.AppendUint32(b, n.EndTarget)
+	b = append(b, n.StartSaplingRoot[:]...)
+	b = append(b, n.EndSaplingRoot[:]...)
+	var work [32]byte
+	if n.SubtreeTotalWork != nil {
+		n.SubtreeTotalWork.FillBytes(work[:])
+	}
+	for i := 31; i >= 0; i-- {
+		b = append(b, work[i])
+	}
+	b = appendCompactSize(b, n.StartHeight)
+	b = appendCompactSize(b, n.EndHeight)
+	b = appendCompactSize(b, n.SaplingTxCount)
+	if n.Version >= V2 {
+		b = append(b, n.StartOrchardRoot[:]...)
+		b = append(b, n.EndOrchardRoot[:]...)
+		b = appendCompactSize(b, n.OrchardTxCount)
+	}
+	return b
+}
+
+// personalization returns "ZcashHistory" followed by the little endian
+// branch id.
+func personalization(branchID uint32) [16]byte {
+	var p [16]byte
+	copy(p[:], "ZcashHistory")
+	binary.LittleEndian.PutUint32(p[12:], branchID)
+	return p
+}
+
+func historyHash(branchID uint32, data []byte) gommr.Hash {
+	return blake2b256Personal(personalization(branchID), data)
+}
+
+// Hash returns the hash of the serialized node data.
+func (n *NodeData) Hash() gommr.Hash {
+	return historyHash(n.ConsensusBranchID, n.Serialize())
+}
+
+// Combine returns the parent of left and right. Its commitment is the hash
+// of both serialized children, ranges span from left to right and work and
+// counts are summed.
+func Combine(left, right *NodeData) *NodeData {
+	data := append(left.Serialize(), right.Serialize()...)
+	return &NodeData{
+		Version:           left.Version,
+		ConsensusBranchID: left.ConsensusBranchID,
+		SubtreeCommitment: historyHash(left.ConsensusBranchID, data),
+		StartTime:         left.StartTime,
+		EndTime:           right.EndTime,
+		StartTarget:       left.StartTarget,
+		EndTarget:         right.EndTarget,
+		StartSaplingRoot:  left.StartSaplingRoot,
+		EndSaplingRoot:    right.EndSaplingRoot,
+		SubtreeTotalWork:  new(big.Int).Add(left.work(), right.work()),
+		StartHeight:       left.StartHeight,
+		EndHeight:         right.EndHeight,
+		SaplingTxCount:    left.SaplingTxCount + right.SaplingTxCount,
+		StartOrchardRoot:  left.StartOrchardRoot,
+		EndOrchardRoot:    right.EndOrchardRoot,
+		OrchardTxCount:    left.OrchardTxCount + right.OrchardTxCount,
+	}
+}
+
+func (n *NodeData) work() *big.Int {
+	if n.SubtreeTotalWork == nil {
+		return new(big.Int)
+	}
+	return n.SubtreeTotalWork
+}
+
+// Block holds the header fields a leaf is built from.
+type Block struct {
+	Hash           gommr.Hash
+	Time           uint32
+	Bits           uint32
+	SaplingRoot    gommr.Hash
+	Height         uint64
+	SaplingTxCount uint64
+	OrchardRoot    gommr.Hash
+	OrchardTxCount uint64
+}
+
+// NewLeaf returns the node data of a block.
+func NewLeaf(version int, branchID uint32, b *Block) *NodeData {
+	return &NodeData{
+		Version:           version,
+		ConsensusBranchID: branchID,
+		SubtreeCommitment: b.Hash,
+		StartTime:         b.Time,
+		EndTime:           b.Time,
+		StartTarget:       b.Bits,
+		EndTarget:         b.Bits,
+		StartSaplingRoot:  b.SaplingRoot,
+		EndSaplingRoot:    b.SaplingRoot,
+		SubtreeTotalWork:  Work(b.Bits),
+		StartHeight:       b.Height,
+		EndHeight:         b.Height,
+		SaplingTxCount:    b.SaplingTxCount,
+		StartOrchardRoot:  b.OrchardRoot,
+		EndOrchardRoot:    b.OrchardRoot,
+		OrchardTxCount:    b.OrchardTxCount,
+	}
+}
+
+// Work returns the expected work of a block with compact target bits,
+// 2^256 / (target + 1).
+func Work(bits uint32) *big.Int {
+	exp := uint(bits >> 24)
+	target := big.NewInt(int64(bits & 0x007fffff))
+	if exp <= 3 {
+		target.Rsh(target, 8*(3-exp))
+	} else {
+		target.Lsh(target, 8*(exp-3))
+	}
+	if bits&0x00800000 != 0 || target.Sign() == 0 {
+		return new(big.Int)
+	}
+	work := new(big.Int).Lsh(big.NewInt(1), 256)
+	return work.Div(work, target.Add(target, big.NewInt(1)))
+}
@@ -0,0 +1,106 @@
+# Independent Python port of the ZIP-221 node data rules, used to produce
+# vectors.json:
+#
+#   python3 gen_vectors.py > vectors.json
+import hashlib, json, struct
+
+def personal(branch):
+    return b"ZcashHistory" + struct.pack("<I", branch)
+
+def H(branch, data):
+    return hashlib.blake2b(data, digest_size=32, person=personal(branch)).digest()
+
+def compact(v):
+    if v < 0xfd: return bytes([v])
+    if v <= 0xffff: return b"\xfd" + struct.pack("<H", v)
+    if v <= 0xffffffff: return b"\xfe" + struct.pack("<I", v)
+    return b"\xff" + struct.pack("<Q", v)
+
+def work(bits):
+    exp, mant = bits >> 24, bits & 0x7fffff
+    target = mant >> (8 * (3 - exp)) if exp <= 3 else mant << (8 * (exp - 3))
+    if bits & 0x800000 or target == 0: return 0
+    return (1 << 256) // (target + 1)
+
+def ser(n, version):
+    b = n["commitment"] + struct.pack("<IIII", n["start_time"], n["end_time"], n["start_target"], n["end_target"])
+    b += n["start_sapling"] + n["end_sapling"] + n["work"].to_bytes(32, "little")
+    b += compact(n["start_height"]) + compact(n["end_height"]) + compact(n["sapling_tx"])
+    if version >= 2:
+        b += n["start_orchard"] + n["end_orchard"] + compact(n["orchard_tx"])
+    return b
+
+def combine(l, r, branch, version):
+    return {
+        "commitment": H(branch, ser(l, version) + ser(r, version)),
+        "start_time": l["start_time"], "end_time": r["end_time"],
+        "start_target": l["start_target"], "end_target": r["end_target"],
+        "start_sapling": l["start_sapling"], "end_sapling": r["end_sapling"],
+        "work": l["work"] + r["work"],
+        "start_height": l["start_height"], "end_height": r["end_height"],
+        "sapling_tx": l["sapling_tx"] + r["sapling_tx"],
+        "start_orchard": l["start_orchard"], "end_orchard": r["end_orchard"],
+        "orchard_tx": l["orchard_tx"] + r["orchard_tx"],
+    }
+
+def block(height):
+    s = lambda tag: hashlib.sha256(tag + struct.pack("<Q", height)).digest()
+    return {
+        "hash": s(b"block"), "time": 1600000000 + 75 * height,
+        "bits": 0x1d00ffff if height % 3 else 0x1c7fffff,
+        "sapling_root": s(b"sapling"), "height": height, "sapling_tx": height % 5,
+        "orchard_root": s(b"orchard"), "orchard_tx": height % 3,
+    }
+
+def leaf(b):
+    return {
+        "commitment": b["hash"], "start_time": b["time"], "end_time": b["time"],
+        "start_target": b["bits"], "end_target": b["bits"],
+        "start_sapling": b["sapling_root"], "end_sapling": b["sapling_root"],
+        "work": work(b["bits"]), "start_height": b["height"], "end_height": b["height"],
+        "sapling_tx": b["sapling_tx"],
+        "start_orchard": b["orchard_root"], "end_orchard": b["orchard_root"],
+        "orchard_tx": b["orchard_tx"],
+    }
+
+def pos_height(pos):
+    pos += 1
+    while not (pos & (pos + 1)) == 0:
+        pos -= (1 << (pos.bit_length() - 1)) - 1
+    return pos.bit_length() - 1
+
+def peaks(size):
+    res, pos = [], 0
+    while size > 0:
+        h = 0
+        while (2 << (h + 1)) - 1 <= size: h += 1
+        tree = (2 << h) - 1
+        res.append(pos + tree - 1); pos += tree; size -= tree
+    return res
+
+def roots(branch, version, heights):
+    nodes, out = [], []
+    for height in heights:
+        pos = len(nodes)
+        nodes.append(leaf(block(height)))
+        h = 0
+        while pos_height(pos + 1) > h:
+            pos += 1
+            nodes.append(combine(nodes[pos - (2 << h)], nodes[pos - 1], branch, version))
+            h += 1
+        ps = peaks(len(nodes))
+        root = nodes[ps[-1]]
+        for p in reversed(ps[:-1]):
+            root = combine(nodes[p], root, branch, version)
+        out.append({"height": height, "root": H(branch, ser(root, version)).hex(),
+                    "root_node": ser(root, version).hex()})
+    return out
+
+cases = [
+    {"name": "heartwood", "version": 1, "branch_id": 0xf5b9230b, "first": 903000, "count": 20},
+    {"name": "canopy", "version": 1, "branch_id": 0xe9ff75a6, "first": 1046400, "count": 9},
+    {"name": "nu5", "version": 2, "branch_id": 0xc2d6d0b4, "first": 1687104, "count": 13},
+]
+for c in cases:
+    c["roots"] = roots(c["branch_id"], c["version"], range(c["first"], c["first"] + c["count"]))
+print(json.dumps({"cases": cases}, indent=1))
@@ -0,0 +1,171 @@
+package zip221
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-mmr/gommr"
+)
+
+var (
+	errBranchID = errors.New("zip221: leaf of a different consensus branch")
+	errHeight   = errors.New("zip221: block height is not consecutive")
+)
+
+// Tree is the history tree of one network upgrade epoch.
+type Tree struct {
+	branchID uint32
+	version  int
+	nodes    []*NodeData
+}
+
+func NewTree(version int, branchID uint32) *Tree {
+	return &Tree{branchID: branchID, version: version}
+}
+
+// BranchID returns the consensus branch id of the epoch.
+func (t *Tree) BranchID() uint32 {
+	return t.branchID
+}
+
+// Append adds a leaf, merging equal height peaks like gommr's push.
+func (t *Tree) Append(leaf *NodeData) error {
+	if leaf.ConsensusBranchID != t.branchID || leaf.Version != t.version {
+		return errBranchID
+	}
+	height, pos := 0, uint64(len(t.nodes))
+	t.nodes = append(t.nodes, leaf)
+	for gommr.PosHeight(pos+1) > height {
+		pos++
+		left := t.nodes[pos-gommr.ParentOffset(height)]
+		right := t.nodes[pos-1]
+		t.nodes = append(t.nodes, Combine(left, right))
+		height++
+	}
+	return nil
+}
+
+// Size returns the number of nodes.
+func (t *Tree) Size() uint64 {
+	return uint64(len(t.nodes))
+}
+
+// Len returns the number of leaves.
+func (t *Tree) Len() uint64 {
+	return gommr.SizeToLeafCount(t.Size())
+}
+
+// Node returns the node at pos.
+func (t *Tree) Node(pos uint64) *NodeData {
+	return t.nodes[pos]
+}
+
+// RootNode combines the peaks from right to left, each peak being the
+// left child of the bag to its right. It returns nil for an empty tree.
+func (t *Tree) RootNode() *NodeData {
+	if len(t.nodes) == 0 {
+		return nil
+	}
+	peaks := gommr.Peaks(t.Size())
+	root := t.nodes[peaks[len(peaks)-1]]
+	for i := len(peaks) - 2; i >= 0; i-- {
+		root = Combine(t.nodes[peaks[i]], root)
+	}
+	return root
+}
+
+// Root returns hashLightClientRoot, the hash of the root node, or zero for
+// an empty tree.
+func (t *Tree) Root() gommr.Hash {
+	root := t.RootNode()
+	if root == nil {
+		return gommr.Hash{}
+	}
+	return root.Hash()
+}
+
+// Upgrade is a network upgrade that resets the history tree.
+type Upgrade struct {
+	Name     string
+	Height   uint64
+	BranchID uint32
+	Version  int
+}
+
+// Mainnet lists the upgrades of Zcash mainnet that use the history tree,
+// up to NU6.1. A History needs every later upgrade too, or it goes on
+// appending to the tree of the last one it knows; pass NewHistory a table
+// with them appended.
+var Mainnet = []Upgrade{
+	{"Heartwood", 903000, 0xf5b9230b, V1},
+	{"Canopy", 1046400, 0xe9ff75a6, V1},
+	{"NU5", 1687104, 0xc2d6d0b4, V2},
+	{"NU6", 2726400, 0xc8e71055, V2},
+	{"NU6.1", 3146400, 0x4dec4df0, V2},
+}
+
+// History follows a chain across network upgrades. Each upgrade starts a
+// new tree at its activation height, blocks before the first upgrade are
+// not committed to.
+type History struct {
+	upgrades []Upgrade
+	epoch    int
+	tree     *Tree
+	started  bool
+	next     uint64
+}
+
+// NewHistory returns a history for upgrades, ordered by height.
+func NewHistory(upgrades []Upgrade) *History {
+	return &History{upgrades: upgrades, epoch: -1}
+}
+
+// epochOf returns the index of the upgrade active at height, or -1.
+func (h *History) epochOf(height uint64) int {
+	epoch := -1
+	for i, u := range h.upgrades {
+		if height >= u.Height {
+			epoch = i
+		}
+	}
+	return epoch
+}
+
+// AppendBlock adds the next block of the chain.
+func (h *History) AppendBlock(b *Block) error {
+	if h.started && b.Height != h.next {
+		return errHeight
+	}
+	h.started = true
+	h.next = b.Height + 1
+	epoch := h.epochOf(b.Height)
+	if epoch < 0 {
+		return nil
+	}
+	u := h.upgrades[epoch]
+	if epoch != h.epoch {
+		h.epoch = epoch
+		h.tree = NewTree(u.Version, u.BranchID)
+	}
+	if err := h.tree.Append(NewLeaf(u.Version, u.BranchID, b)); err != nil {
+		return fmt.Errorf("block %d: %v", b.Height, err)
+	}
+	return nil
+}
+
+// Tree returns the tree of the current epoch, nil before the first
+// upgrade.
+func (h *History) Tree() *Tree {
+	return h.tree
+}
+
+// Commitment returns the hashLightClientRoot of the block following the
+// last appended one. It commits to the epoch so far and is zero for the
+// activation block of an upgrade, whose tree is still empty.
+func (h *History) Commitment() gommr.Hash {
+	epoch := h.epochOf(h.next)
+	if h.tree == nil || epoch != h.epoch {
+		return gommr.Hash{}
+	}
+	return h.tree.Root()
+}
@@ -0,0 +1,176 @@
+package zip221
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/go-mmr/gommr"
+	"golang.org/x/crypto/blake2b"
+)
+
+func TestBlake2bPersonal(t *testing.T) {
+	got := blake2b256Personal(personalization(0xf5b9230b), []byte("abc"))
+	want := "9f543df300d184c8f2c406e2e22c26b2dbe44d775a5d5550d99edcb94db153cc"
+	if hex.EncodeToString(got[:]) != want {
+		t.Fatalf("personalized hash %x, want %s", got, want)
+	}
+	// without personalization it is plain blake2b
+	for _, n := range []int{0, 1, 127, 128, 129, 256, 1000} {
+		data := make([]byte, n)
+		for i := range data {
+			data[i] = byte(i)
+		}
+		if blake2b256Personal([16]byte{}, data) != blake2b.Sum256(data) {
+			t.Fatalf("hash of %d bytes differs from blake2b", n)
+		}
+	}
+}
+
+// testBlock mirrors block() of testdata/gen_vectors.py.
+func testBlock(height uint64) *Block {
+	tag := func(s string) gommr.Hash {
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], height)
+		return sha256.Sum256(append([]byte(s), b[:]...))
+	}
+	bits := uint32(0x1d00ffff)
+	if height%3 == 0 {
+		bits = 0x1c7fffff
+	}
+	return &Block{
+		Hash:           tag("block"),
+		Time:           uint32(1600000000 + 75*height),
+		Bits:           bits,
+		SaplingRoot:    tag("sapling"),
+		Height:         height,
+		SaplingTxCount: height % 5,
+		OrchardRoot:    tag("orchard"),
+		OrchardTxCount: height % 3,
+	}
+}
+
+type vectors struct {
+	Cases []struct {
+		Name     string `json:"name"`
+		Version  int    `json:"version"`
+		BranchID uint32 `json:"branch_id"`
+		First    uint64 `json:"first"`
+		Roots    []struct {
+			Height   uint64 `json:"height"`
+			Root     string `json:"root"`
+			RootNode string `json:"root_node"`
+		} `json:"roots"`
+	} `json:"cases"`
+}
+
+// TestVectors checks hashLightClientRoot against testdata/vectors.json,
+// see testdata/gen_vectors.py.
+func TestVectors(t *testing.T) {
+	data, err := os.ReadFile("testdata/vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v vectors
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range v.Cases {
+		tree := NewTree(c.Version, c.BranchID)
+		for _, r := range c.Roots {
+			if err := tree.Append(NewLeaf(c.Version, c.BranchID, testBlock(r.Height))); err != nil {
+				t.Fatal(err)
+			}
+			if got := hex.EncodeToString(tree.RootNode().Serialize()); got != r.RootNode {
+				t.Fatalf("%s block %d: root node %s, want %s", c.Name, r.Height, got, r.RootNode)
+			}
+			if got := tree.Root(); hex.EncodeToString(got[:]) != r.Root {
+				t.Fatalf("%s block %d: root %x, want %s", c.Name, r.Height, got, r.Root)
+			}
+		}
+	}
+}
+
+func TestCombine(t *testing.T) {
+	tree := NewTree(V1, 0xe9ff75a6)
+	work := new(big.Int)
+	for h := uint64(100); h < 111; h++ {
+		b := testBlock(h)
+		work.Add(work, Work(b.Bits))
+		tree.Append(NewLeaf(V1, 0xe9ff75a6, b))
+	}
+	root := tree.RootNode()
+	if root.StartHeight != 100 || root.EndHeight != 110 || root.SubtreeTotalWork.Cmp(work) != 0 {
+		t.Fatalf("root spans %d..%d with work %v, want 100..110 with %v", root.StartHeight, root.EndHeight, root.SubtreeTotalWork, work)
+	}
+	if root.StartTime != testBlock(100).Time || root.EndTime != testBlock(110).Time {
+		t.Fatal("root time range wrong")
+	}
+	if tree.Append(NewLeaf(V1, 0xf5b9230b, testBlock(111))) == nil {
+		t.Fatal("leaf of another branch appended")
+	}
+	// difficulty 1 on bitcoin's scale
+	if Work(0x1d00ffff).String() != "4295032833" {
+		t.Fatalf("work of 0x1d00ffff is %v", Work(0x1d00ffff))
+	}
+}
+
+func TestUpgradeReset(t *testing.T) {
+	upgrades := []Upgrade{
+		{"A", 10, 0xf5b9230b, V1},
+		{"B", 17, 0xe9ff75a6, V1},
+		{"C", 30, 0xc2d6d0b4, V2},
+	}
+	h := NewHistory(upgrades)
+	for height := uint64(5); height < 40; height++ {
+		// the header at each height commits to its epoch before it
+		want := gommr.Hash{}
+		for i, u := range upgrades {
+			if height < u.Height || (i+1 < len(upgrades) && height >= upgrades[i+1].Height) {
+				continue
+			}
+			tree := NewTree(u.Version, u.BranchID)
+			for prev := u.Height; prev < height; prev++ {
+				tree.Append(NewLeaf(u.Version, u.BranchID, testBlock(prev)))
+			}
+			want = tree.Root()
+		}
+		if got := h.Commitment(); got != want {
+			t.Fatalf("commitment for block %d: %x, want %x", height, got, want)
+		}
+		if err := h.AppendBlock(testBlock(height)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if h.Tree().BranchID() != 0xc2d6d0b4 || h.Tree().Len() != 10 {
+		t.Fatalf("last epoch has %d blocks", h.Tree().Len())
+	}
+	if h.AppendBlock(testBlock(41)) == nil {
+		t.Fatal("non consecutive block appended")
+	}
+}
+
+func TestMainnet(t *testing.T) {
+	for i := 1; i < len(Mainnet); i++ {
+		if Mainnet[i].Height <= Mainnet[i-1].Height {
+			t.Fatalf("%s activates before %s", Mainnet[i].Name, Mainnet[i-1].Name)
+		}
+	}
+	// NU6 starts a tree of its own
+	h := NewHistory(Mainnet)
+	for height := uint64(2726398); height <= 2726401; height++ {
+		if height == 2726400 && h.Commitment() != (gommr.Hash{}) {
+			t.Fatal("NU6 activation block commits to the NU5 tree")
+		}
+		if err := h.AppendBlock(testBlock(height)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if h.Tree().BranchID() != 0xc8e71055 || h.Tree().Len() != 2 {
+		t.Fatalf("NU6 tree of branch %x has %d blocks", h.Tree().BranchID(), h.Tree().Len())
+	}
+}